@@ -0,0 +1,185 @@
+// Package backend abstracts over mp3 decoder implementations so programs can
+// fall back to a pure Go decoder where libmpg123 is not available.
+//
+// Which decoders are available depends on how the program is built:
+//
+//   - With cgo (the default on most platforms), libmpg123 is linked into the
+//     program and registers itself. The system loader then needs the library
+//     before the program starts, so a binary built this way does not run at
+//     all where libmpg123 is missing, and there is nothing to fall back from.
+//   - Without cgo, or with the purego build tag, libmpg123 is loaded at run
+//     time if it is installed, which also allows cross compiling with
+//     CGO_ENABLED=0. These builds always include the pure Go go-mp3 backend,
+//     which Open uses where the library cannot be loaded.
+//   - Under js/wasm and wasip1 libmpg123 can be neither linked nor loaded,
+//     and go-mp3 is the only decoder.
+//
+// A cgo build includes go-mp3 behind libmpg123 with the gomp3 build tag, and
+// drops libmpg123 with the nompg123 tag. Other decoders are plugged in with
+// Register and New.
+//
+// Open uses the backend named by the GO_MPG123_BACKEND environment variable,
+// or the one set with SetDefault, or else the registered backend with the
+// lowest priority value.
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Encodings used in Format. The values match the mpg123.ENC_* constants.
+const (
+	EncodingSigned16 = 0xd0
+	EncodingFloat32  = 0x200
+)
+
+// Format describes the PCM output of a stream
+type Format struct {
+	Rate     int
+	Channels int
+	Encoding int
+}
+
+// Stream is an open decoding stream producing interleaved PCM data
+type Stream interface {
+	io.Reader
+	Format() Format
+	Close() error
+}
+
+// Backend is a decoder implementation
+type Backend interface {
+	Name() string
+	// Priority orders backends for default selection, lower is preferred
+	Priority() int
+	Open(r io.Reader) (Stream, error)
+}
+
+// ErrNoBackend is returned by Open when no backend is registered
+var ErrNoBackend = errors.New("backend: no decoder backend available")
+
+var (
+	mu       sync.Mutex
+	backends = map[string]Backend{}
+	chosen   string
+)
+
+// Register makes a backend available, replacing one of the same name
+func Register(b Backend) {
+	mu.Lock()
+	backends[b.Name()] = b
+	mu.Unlock()
+}
+
+// Get returns the backend registered under name
+func Get(name string) (Backend, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	b, ok := backends[name]
+	return b, ok
+}
+
+// Names lists the registered backends in order of preference
+func Names() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	return sortedNames()
+}
+
+func sortedNames() []string {
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		pi, pj := backends[names[i]].Priority(), backends[names[j]].Priority()
+		if pi != pj {
+			return pi < pj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// SetDefault selects the backend used by Open, "" restores automatic selection
+func SetDefault(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := backends[name]; name != "" && !ok {
+		return fmt.Errorf("backend: unknown backend %q", name)
+	}
+	chosen = name
+	return nil
+}
+
+// Default returns the backend Open would use
+func Default() (Backend, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range []string{os.Getenv("GO_MPG123_BACKEND"), chosen} {
+		if name == "" {
+			continue
+		}
+		b, ok := backends[name]
+		if !ok {
+			return nil, fmt.Errorf("backend: unknown backend %q", name)
+		}
+		return b, nil
+	}
+	names := sortedNames()
+	if len(names) == 0 {
+		return nil, ErrNoBackend
+	}
+	return backends[names[0]], nil
+}
+
+// Open starts decoding r with the default backend
+func Open(r io.Reader) (Stream, error) {
+	b, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	return b.Open(r)
+}
+
+// funcBackend is a Backend built from an open function
+type funcBackend struct {
+	name     string
+	priority int
+	open     func(r io.Reader) (Stream, error)
+}
+
+// New creates a backend from an open function
+func New(name string, priority int, open func(r io.Reader) (Stream, error)) Backend {
+	return &funcBackend{name: name, priority: priority, open: open}
+}
+
+func (b *funcBackend) Name() string                     { return b.name }
+func (b *funcBackend) Priority() int                    { return b.priority }
+func (b *funcBackend) Open(r io.Reader) (Stream, error) { return b.open(r) }
+
+// readerStream adapts a plain PCM reader to Stream
+type readerStream struct {
+	io.Reader
+	format Format
+	close  func() error
+}
+
+// NewStream wraps a reader producing PCM in format f as a Stream. close may be nil.
+func NewStream(r io.Reader, f Format, close func() error) Stream {
+	return &readerStream{Reader: r, format: f, close: close}
+}
+
+func (s *readerStream) Format() Format { return s.format }
+
+func (s *readerStream) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
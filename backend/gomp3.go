@@ -0,0 +1,28 @@
+//go:build !cgo || purego || gomp3
+
+// gomp3.go registers the pure Go decoder github.com/hajimehoshi/go-mp3. It
+// is the only decoder under js/wasm and wasip1, and the fallback of builds
+// that load libmpg123 at run time, for systems without the library. cgo
+// builds get it with the gomp3 build tag.
+
+package backend
+
+import (
+	"io"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+func init() {
+	Register(New("go-mp3", 10, openGoMP3))
+}
+
+func openGoMP3(r io.Reader) (Stream, error) {
+	d, err := mp3.NewDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	// go-mp3 always produces little endian 16 bit stereo
+	f := Format{Rate: d.SampleRate(), Channels: 2, Encoding: EncodingSigned16}
+	return NewStream(d, f, nil), nil
+}
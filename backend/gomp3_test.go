@@ -0,0 +1,39 @@
+//go:build !cgo || purego || gomp3
+
+package backend
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestGoMP3(t *testing.T) {
+	// MPEG-1 Layer III frames at 128 kbit/s, 44100 Hz, decoding to silence
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x40})
+	b, ok := Get("go-mp3")
+	if !ok {
+		t.Fatal("go-mp3 is not registered")
+	}
+	s, err := b.Open(bytes.NewReader(bytes.Repeat(frame, 10)))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+	if f := s.Format(); f != (Format{Rate: 44100, Channels: 2, Encoding: EncodingSigned16}) {
+		t.Errorf("Format: got %+v", f)
+	}
+	pcm, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if want := 10 * 1152 * 4; len(pcm) != want {
+		t.Errorf("got %d bytes, want %d", len(pcm), want)
+	}
+	for _, v := range pcm {
+		if v != 0 {
+			t.Fatal("got sound from silent frames")
+		}
+	}
+}
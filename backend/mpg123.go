@@ -0,0 +1,52 @@
+//go:build cgo && !nompg123 && !purego
+
+// mpg123.go registers libmpg123 as the preferred backend when cgo is available
+
+package backend
+
+import (
+	"io"
+
+	"github.com/SiloCityLabs/go-mpg123/mpg123"
+)
+
+func init() {
+	Register(New("mpg123", 0, openMpg123))
+}
+
+func openMpg123(r io.Reader) (Stream, error) {
+	d, err := mpg123.NewDecoder("")
+	if err != nil {
+		return nil, err
+	}
+	if err := d.OpenReader(r); err != nil {
+		d.Delete()
+		return nil, err
+	}
+	rate, channels, encoding := d.GetFormat()
+	// keep the format stable for the lifetime of the stream
+	d.FormatNone()
+	d.Format(rate, channels, encoding)
+	return &mpg123Stream{d: d, format: Format{Rate: rate, Channels: channels, Encoding: encoding}}, nil
+}
+
+type mpg123Stream struct {
+	d      *mpg123.Decoder
+	format Format
+}
+
+func (s *mpg123Stream) Read(p []byte) (int, error) {
+	n, err := s.d.Read(p)
+	if err == mpg123.EOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (s *mpg123Stream) Format() Format { return s.format }
+
+func (s *mpg123Stream) Close() error {
+	err := s.d.Close()
+	s.d.Delete()
+	return err
+}
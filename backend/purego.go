@@ -0,0 +1,203 @@
+//go:build (purego || !cgo) && !nompg123 && (amd64 || arm64) && (darwin || linux || windows)
+
+// purego.go loads libmpg123 at run time with purego instead of linking it
+// through cgo, so binaries can be cross compiled with CGO_ENABLED=0 and still
+// use the system decoder where one is installed. It is used when cgo is
+// disabled or the purego build tag is set.
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+
+	"github.com/ebitengine/purego"
+)
+
+// libmpg123 return codes used below, from mpg123.h
+const (
+	mpgOK        = 0
+	mpgNewFormat = -11
+	mpgNeedMore  = -10
+	mpgDone      = -12
+)
+
+// lib holds the libmpg123 functions, set by loadLibrary
+var lib struct {
+	init          func() int32
+	new           func(decoder *byte, err *int32) uintptr
+	delete        func(mh uintptr)
+	openFeed      func(mh uintptr) int32
+	decode        func(mh uintptr, in unsafe.Pointer, inSize uintptr, out unsafe.Pointer, outSize uintptr, done *uintptr) int32
+	getFormat     func(mh uintptr, rate *clong, channels *int32, encoding *int32) int32
+	formatNone    func(mh uintptr) int32
+	format        func(mh uintptr, rate clong, channels int32, encodings int32) int32
+	plainStrerror func(code int32) string
+	strerror      func(mh uintptr) string
+}
+
+func init() {
+	if err := loadLibrary(); err != nil {
+		// leave the decoder to other backends
+		return
+	}
+	Register(New("mpg123-purego", 0, openPurego))
+}
+
+// loadLibrary opens the first libmpg123 found in libraryNames and binds the
+// functions used by the backend
+func loadLibrary() (err error) {
+	var handle uintptr
+	for _, name := range libraryNames {
+		if handle, err = openLibrary(name); err == nil {
+			break
+		}
+	}
+	if handle == 0 {
+		return fmt.Errorf("backend: libmpg123 not found: %v", err)
+	}
+	// RegisterLibFunc panics on missing symbols
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("backend: %v", r)
+		}
+	}()
+	purego.RegisterLibFunc(&lib.init, handle, "mpg123_init")
+	purego.RegisterLibFunc(&lib.new, handle, "mpg123_new")
+	purego.RegisterLibFunc(&lib.delete, handle, "mpg123_delete")
+	purego.RegisterLibFunc(&lib.openFeed, handle, "mpg123_open_feed")
+	purego.RegisterLibFunc(&lib.decode, handle, "mpg123_decode")
+	purego.RegisterLibFunc(&lib.getFormat, handle, "mpg123_getformat")
+	purego.RegisterLibFunc(&lib.formatNone, handle, "mpg123_format_none")
+	purego.RegisterLibFunc(&lib.format, handle, "mpg123_format")
+	purego.RegisterLibFunc(&lib.plainStrerror, handle, "mpg123_plain_strerror")
+	purego.RegisterLibFunc(&lib.strerror, handle, "mpg123_strerror")
+	if code := lib.init(); code != mpgOK {
+		return fmt.Errorf("backend: mpg123_init: %s", lib.plainStrerror(code))
+	}
+	return nil
+}
+
+// maxEmptyReads is how many reads returning no data and no error are
+// allowed in a row before the source is taken to be stuck, like in the
+// mpg123 package
+const maxEmptyReads = 100
+
+// puregoStream decodes in feed mode, so no callbacks into Go are needed
+type puregoStream struct {
+	mh     uintptr
+	src    io.Reader
+	in     []byte
+	format Format
+	eof    bool
+}
+
+func openPurego(r io.Reader) (Stream, error) {
+	var code int32
+	mh := lib.new(nil, &code)
+	if mh == 0 {
+		return nil, fmt.Errorf("mpg123 error: %s", lib.plainStrerror(code))
+	}
+	s := &puregoStream{mh: mh, src: r, in: make([]byte, 16384)}
+	if lib.openFeed(mh) != mpgOK {
+		err := s.err()
+		s.Close()
+		return nil, err
+	}
+	// feed input until the first frame header sets the output format
+	for {
+		code, _, err := s.decode(nil)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		if code == mpgNewFormat {
+			break
+		}
+	}
+	var rate clong
+	var channels, encoding int32
+	if lib.getFormat(mh, &rate, &channels, &encoding) != mpgOK {
+		err := s.err()
+		s.Close()
+		return nil, err
+	}
+	// keep the format stable for the lifetime of the stream
+	lib.formatNone(mh)
+	lib.format(mh, rate, channels, encoding)
+	s.format = Format{Rate: int(rate), Channels: int(channels), Encoding: int(encoding)}
+	return s, nil
+}
+
+// decode runs mpg123_decode once, feeding more input when the decoder asks
+// for it
+func (s *puregoStream) decode(out []byte) (int32, int, error) {
+	var done uintptr
+	code := lib.decode(s.mh, nil, 0, bytesPointer(out), uintptr(len(out)), &done)
+	empty := 0
+	for code == mpgNeedMore && done == 0 {
+		if s.eof {
+			return mpgDone, 0, io.EOF
+		}
+		n, err := s.src.Read(s.in)
+		if err == io.EOF {
+			s.eof = true
+		} else if err != nil {
+			return code, 0, err
+		}
+		if n == 0 {
+			if empty++; empty >= maxEmptyReads && !s.eof {
+				return code, 0, fmt.Errorf("backend: reading input: %w", io.ErrNoProgress)
+			}
+			continue
+		}
+		empty = 0
+		code = lib.decode(s.mh, unsafe.Pointer(&s.in[0]), uintptr(n), bytesPointer(out), uintptr(len(out)), &done)
+	}
+	switch code {
+	case mpgOK, mpgNewFormat, mpgNeedMore:
+		return code, int(done), nil
+	case mpgDone:
+		return code, int(done), io.EOF
+	}
+	return code, int(done), s.err()
+}
+
+func (s *puregoStream) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		_, n, err := s.decode(p)
+		if n > 0 || err != nil {
+			if n > 0 && err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+	}
+}
+
+func (s *puregoStream) Format() Format { return s.format }
+
+func (s *puregoStream) Close() error {
+	if s.mh == 0 {
+		return errors.New("backend: stream already closed")
+	}
+	lib.delete(s.mh)
+	s.mh = 0
+	return nil
+}
+
+func (s *puregoStream) err() error {
+	return fmt.Errorf("mpg123 error: %s", lib.strerror(s.mh))
+}
+
+func bytesPointer(b []byte) unsafe.Pointer {
+	if len(b) == 0 {
+		return nil
+	}
+	return unsafe.Pointer(&b[0])
+}
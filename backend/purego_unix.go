@@ -0,0 +1,20 @@
+//go:build (purego || !cgo) && !nompg123 && (amd64 || arm64) && (darwin || linux)
+
+package backend
+
+import "github.com/ebitengine/purego"
+
+// clong matches C long, which is 64 bits on these platforms
+type clong = int64
+
+var libraryNames = []string{
+	"libmpg123.so.0",
+	"libmpg123.so",
+	"libmpg123.0.dylib",
+	"/opt/homebrew/lib/libmpg123.0.dylib",
+	"/usr/local/lib/libmpg123.0.dylib",
+}
+
+func openLibrary(name string) (uintptr, error) {
+	return purego.Dlopen(name, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+}
@@ -0,0 +1,15 @@
+//go:build (purego || !cgo) && !nompg123 && (amd64 || arm64)
+
+package backend
+
+import "syscall"
+
+// clong matches C long, which is 32 bits on Windows
+type clong = int32
+
+var libraryNames = []string{"libmpg123-0.dll", "mpg123.dll"}
+
+func openLibrary(name string) (uintptr, error) {
+	h, err := syscall.LoadLibrary(name)
+	return uintptr(h), err
+}
@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// TestWasmBuild checks that the package and its go-mp3 backend still build
+// for the WebAssembly targets, which cannot use either libmpg123 backend
+func TestWasmBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("cross compiling in short mode")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	for _, target := range []struct{ goos, goarch string }{
+		{"js", "wasm"},
+		{"wasip1", "wasm"},
+	} {
+		t.Run(target.goos, func(t *testing.T) {
+			// vet type checks the tests too
+			cmd := exec.Command(gobin, "vet", ".")
+			cmd.Env = append(os.Environ(), "GOOS="+target.goos, "GOARCH="+target.goarch, "CGO_ENABLED=0")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Errorf("GOOS=%s GOARCH=%s go vet: %v\n%s", target.goos, target.goarch, err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// mp3bench measures decoding throughput of every decoder engine supported on
+// this machine, for several output encodings.
+//
+//	mp3bench song.mp3
+//	mp3bench -decoders generic,AVX -enc s16 -n 5 song.mp3
+//
+// With -check it instead verifies that every engine decodes the file to the
+// same audio as the reference engine, within a tolerance, and exits with
+// status 1 if one does not:
+//
+//	mp3bench -check -ref generic -tolerance 2 song.mp3
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SiloCityLabs/go-mpg123/mpg123"
+)
+
+var encodings = map[string]int{
+	"s16": mpg123.ENC_SIGNED_16,
+	"s32": mpg123.ENC_SIGNED_32,
+	"f32": mpg123.ENC_FLOAT_32,
+}
+
+func main() {
+	decoders := flag.String("decoders", "", "comma separated decoder engines, all supported ones if empty")
+	encs := flag.String("enc", "s16,s32,f32", "comma separated output encodings")
+	runs := flag.Int("n", 3, "runs per combination, the fastest one is reported")
+	check := flag.Bool("check", false, "compare the output of each engine with -ref instead of benchmarking")
+	ref := flag.String("ref", "generic", "reference engine for -check")
+	tolerance := flag.Int("tolerance", 2, "largest sample difference in 16 bit LSB accepted by -check")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mp3bench [flags] <file.mp3>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *runs < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// decode from memory so disk speed does not distort the results
+	data, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mp3bench:", err)
+		os.Exit(1)
+	}
+
+	engines := mpg123.SupportedDecoders()
+	if *decoders != "" {
+		engines = strings.Split(*decoders, ",")
+	}
+	if *check {
+		if !compare(data, *ref, engines, *tolerance) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "decoder\tencoding\ttime\tMB/s in\tMB/s out\tx realtime\t")
+	failed := false
+	for _, engine := range engines {
+		for _, name := range strings.Split(*encs, ",") {
+			enc, ok := encodings[name]
+			if !ok {
+				fmt.Fprintln(os.Stderr, "mp3bench: unknown encoding", name)
+				os.Exit(2)
+			}
+			var best result
+			for i := 0; i < *runs; i++ {
+				r, err := bench(data, engine, enc)
+				if errors.Is(err, mpg123.ErrUnsupported) {
+					fmt.Fprintf(os.Stderr, "mp3bench: skipping %s/%s: %v\n", engine, name, err)
+					break
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "mp3bench: %s/%s: %v\n", engine, name, err)
+					failed = true
+					break
+				}
+				if i == 0 || r.elapsed < best.elapsed {
+					best = r
+				}
+			}
+			if best.elapsed == 0 {
+				continue
+			}
+			secs := best.elapsed.Seconds()
+			fmt.Fprintf(w, "%s\t%s\t%v\t%.1f\t%.1f\t%.1f\t\n", engine, name,
+				best.elapsed.Round(time.Millisecond),
+				float64(len(data))/secs/1e6, float64(best.pcmBytes)/secs/1e6,
+				best.audio.Seconds()/secs)
+		}
+	}
+	w.Flush()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+type result struct {
+	elapsed  time.Duration
+	pcmBytes int64
+	audio    time.Duration
+}
+
+func bench(data []byte, engine string, encoding int) (result, error) {
+	decoder, err := mpg123.NewDecoder(engine)
+	if err != nil {
+		return result{}, err
+	}
+	defer decoder.Delete()
+	if err := decoder.SetOutput(mpg123.ConvertOptions{Encoding: encoding}); err != nil {
+		return result{}, err
+	}
+	if err := decoder.OpenReader(bytes.NewReader(data)); err != nil {
+		return result{}, err
+	}
+	defer decoder.Close()
+
+	start := time.Now()
+	n, err := decoder.WriteTo(io.Discard)
+	elapsed := time.Since(start)
+	if err != nil {
+		return result{}, err
+	}
+	rate, channels, enc := decoder.GetFormat()
+	frames := n / int64(mpg123.Format{Rate: rate, Channels: channels, Encoding: enc}.BytesPerFrame())
+	return result{
+		elapsed:  elapsed,
+		pcmBytes: n,
+		audio:    time.Duration(frames) * time.Second / time.Duration(rate),
+	}, nil
+}
+
+// compare checks every engine against the reference and reports whether all
+// of them matched
+func compare(data []byte, ref string, engines []string, tolerance int) bool {
+	diffs, err := mpg123.CompareDecoders(data, ref, engines, tolerance)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mp3bench:", err)
+		return false
+	}
+	ok := true
+	for _, diff := range diffs {
+		status := "ok"
+		if !diff.OK(tolerance) {
+			status = "MISMATCH"
+			if diff.FirstIndex >= 0 {
+				status += fmt.Sprintf(" from sample %d", diff.FirstIndex)
+			}
+			ok = false
+		}
+		fmt.Printf("%s\t%s\n", diff, status)
+	}
+	return ok
+}
@@ -0,0 +1,229 @@
+// mp3info prints the stream format, duration, bitrate, encoder (LAME/Xing)
+// details and tags of mp3 files, as text or JSON.
+//
+//	mp3info song.mp3
+//	mp3info -json *.mp3
+//	mp3info -length estimate *.mp3   # skip scanning, faster on large libraries
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SiloCityLabs/go-mpg123/mpg123"
+)
+
+// Info is everything mp3info reports about one file
+type Info struct {
+	File           string        `json:"file"`
+	Version        string        `json:"version"`
+	Layer          int           `json:"layer"`
+	Rate           int           `json:"rate"`
+	Channels       int           `json:"channels"`
+	Mode           string        `json:"mode"`
+	Duration       time.Duration `json:"duration_ns"`
+	Samples        int64         `json:"samples"`
+	Frames         int           `json:"frames"`
+	BitrateMode    string        `json:"bitrate_mode"`
+	Bitrate        int           `json:"bitrate_kbps"`
+	AverageBitrate int           `json:"average_bitrate_kbps"`
+	EncoderDelay   int64         `json:"encoder_delay"`
+	EncoderPadding int64         `json:"encoder_padding"`
+	Accurate       bool          `json:"accurate_length"`
+	CRC            bool          `json:"crc"`
+	Copyright      bool          `json:"copyright"`
+	Original       bool          `json:"original"`
+	Xing           *Xing         `json:"xing,omitempty"`
+	Tags           *Tags         `json:"tags,omitempty"`
+}
+
+// Tags are the ID3 tags of a file
+type Tags struct {
+	ID3v1   bool   `json:"id3v1"`
+	ID3v2   int    `json:"id3v2,omitempty"` // major version, 0 without an ID3v2 tag
+	Title   string `json:"title,omitempty"`
+	Artist  string `json:"artist,omitempty"`
+	Album   string `json:"album,omitempty"`
+	Year    string `json:"year,omitempty"`
+	Genre   string `json:"genre,omitempty"`
+	Track   int    `json:"track,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func main() {
+	asJSON := flag.Bool("json", false, "print JSON instead of text")
+	length := flag.String("length", "exact", "how to find the length: estimate (headers only), exact (scan if needed) or auto (scan VBR files without a Xing header)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mp3info [-json] [-length mode] <file.mp3> ...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	mode, ok := lengthModes[*length]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "mp3info: unknown length mode", *length)
+		os.Exit(2)
+	}
+
+	var infos []Info
+	failed := false
+	for _, file := range flag.Args() {
+		info, err := probe(file, mode)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mp3info: %s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(infos)
+	} else {
+		for _, info := range infos {
+			printInfo(info)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+var lengthModes = map[string]mpg123.DurationMode{
+	"estimate": mpg123.DurationEstimate,
+	"exact":    mpg123.DurationExact,
+	"auto":     mpg123.DurationAuto,
+}
+
+func probe(file string, mode mpg123.DurationMode) (Info, error) {
+	info := Info{File: file}
+	decoder, err := mpg123.NewDecoder("")
+	if err != nil {
+		return info, err
+	}
+	defer decoder.Delete()
+	if err := decoder.Open(file); err != nil {
+		return info, err
+	}
+	defer decoder.Close()
+
+	rate, channels, _ := decoder.GetFormat()
+	info.Rate, info.Channels = rate, channels
+	fi, err := decoder.FrameInfo()
+	if err != nil {
+		return info, err
+	}
+	info.Version = fi.Version.String()
+	info.Layer = int(fi.Layer)
+	info.Mode = fi.Mode.String()
+	info.BitrateMode = fi.VBR.String()
+	info.Bitrate = fi.Bitrate
+	if fi.VBR == mpg123.ABR {
+		info.Bitrate = fi.ABRRate
+	}
+	info.CRC = fi.Flags&mpg123.CRC != 0
+	info.Copyright = fi.Flags&mpg123.COPYRIGHT != 0
+	info.Original = fi.Flags&mpg123.ORIGINAL != 0
+
+	// the length stored in a Xing/LAME header is exact; without one the
+	// mode decides whether to scan the file
+	if info.Duration, err = decoder.Duration(mode); err != nil {
+		return info, err
+	}
+	accurate, _, _ := decoder.State(mpg123.ACCURATE)
+	info.Accurate = accurate != 0
+	info.Samples = decoder.LengthInPCMFrames()
+	info.Frames = decoder.GetLengthInMPEGFrames()
+	info.EncoderDelay, _, _ = decoder.State(mpg123.ENC_DELAY)
+	info.EncoderPadding, _, _ = decoder.State(mpg123.ENC_PADDING)
+
+	// a libmpg123 without ID3v2 parsing still gives everything else
+	if tag, err := decoder.ID3(); err == nil && (tag.ID3v1 || tag.ID3v2) {
+		info.Tags = &Tags{
+			ID3v1:   tag.ID3v1,
+			Title:   tag.Title,
+			Artist:  tag.Artist,
+			Album:   tag.Album,
+			Year:    tag.Year,
+			Genre:   tag.Genre,
+			Track:   tag.Track,
+			Comment: tag.Comment,
+		}
+		if tag.ID3v2 {
+			info.Tags.ID3v2 = tag.Version
+		}
+	}
+
+	// the average counts the audio only, not the tags around it
+	start, xing, err := readXing(file)
+	if err != nil {
+		return info, err
+	}
+	info.Xing = xing
+	if st, err := os.Stat(file); err == nil && info.Duration > 0 {
+		audio := st.Size() - start
+		if info.Tags != nil && info.Tags.ID3v1 {
+			audio -= 128
+		}
+		info.AverageBitrate = int(float64(audio) * 8 / info.Duration.Seconds() / 1000)
+	}
+	return info, nil
+}
+
+func printInfo(info Info) {
+	fmt.Printf("%s:\n", info.File)
+	fmt.Printf("  Format:    %s Layer %d, %d Hz, %s (%d channels)\n", info.Version, info.Layer, info.Rate, info.Mode, info.Channels)
+	fmt.Printf("  Duration:  %v (%d samples, %d frames)\n", info.Duration.Round(time.Millisecond), info.Samples, info.Frames)
+	fmt.Printf("  Bitrate:   %s %d kbit/s, average %d kbit/s\n", info.BitrateMode, info.Bitrate, info.AverageBitrate)
+	fmt.Printf("  Encoder:   delay %d, padding %d samples\n", info.EncoderDelay, info.EncoderPadding)
+	fmt.Printf("  Flags:     crc=%v copyright=%v original=%v\n", info.CRC, info.Copyright, info.Original)
+	if x := info.Xing; x != nil {
+		fmt.Printf("  %s:      %d frames, %d bytes, toc=%v, quality %d\n", x.Tag, x.Frames, x.Bytes, x.TOC, x.Quality)
+		if l := x.LAME; l != nil {
+			fmt.Printf("  LAME:      %s, %s", l.Encoder, l.Method)
+			if l.Preset != "" {
+				fmt.Printf(", preset %s", l.Preset)
+			}
+			if l.Lowpass > 0 {
+				fmt.Printf(", lowpass %d Hz", l.Lowpass)
+			}
+			fmt.Printf("\n             nogap previous=%v next=%v, music length %d bytes\n", l.NoGapPrev, l.NoGapNext, l.MusicLength)
+		}
+	}
+	if tags := info.Tags; tags != nil {
+		var kinds []string
+		if tags.ID3v2 != 0 {
+			kinds = append(kinds, fmt.Sprintf("ID3v2.%d", tags.ID3v2))
+		}
+		if tags.ID3v1 {
+			kinds = append(kinds, "ID3v1")
+		}
+		fmt.Printf("  Tags:      %s\n", strings.Join(kinds, ", "))
+		printTag("Title", tags.Title)
+		printTag("Artist", tags.Artist)
+		printTag("Album", tags.Album)
+		printTag("Year", tags.Year)
+		printTag("Genre", tags.Genre)
+		if tags.Track != 0 {
+			printTag("Track", strconv.Itoa(tags.Track))
+		}
+		printTag("Comment", tags.Comment)
+	}
+}
+
+// printTag prints one tag field, if it is set
+func printTag(name, value string) {
+	if value != "" {
+		fmt.Printf("    %-8s %s\n", name+":", value)
+	}
+}
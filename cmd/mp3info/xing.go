@@ -0,0 +1,162 @@
+// xing.go reads the Xing/Info and LAME tags of the first frame, which
+// libmpg123 uses for the length and gapless information but does not expose
+// in full
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Xing holds the Xing/Info tag of a file and the LAME tag that follows it
+type Xing struct {
+	Tag     string `json:"tag"` // "Xing" (VBR) or "Info" (CBR)
+	Frames  int    `json:"frames,omitempty"`
+	Bytes   int    `json:"bytes,omitempty"`
+	TOC     bool   `json:"toc"`
+	Quality int    `json:"quality,omitempty"`
+	LAME    *LAME  `json:"lame,omitempty"`
+}
+
+// LAME holds the fields of a LAME tag besides delay and padding, which
+// Info reports from libmpg123
+type LAME struct {
+	Encoder     string `json:"encoder"`
+	Method      string `json:"method"`
+	Preset      string `json:"preset,omitempty"`
+	Lowpass     int    `json:"lowpass_hz,omitempty"`
+	NoGapPrev   bool   `json:"nogap_previous"`
+	NoGapNext   bool   `json:"nogap_next"`
+	MusicLength int    `json:"music_length"`
+}
+
+// readXing returns the offset of the first MPEG frame of file, after any
+// ID3v2 tag, and the Xing/LAME tags of that frame, nil if it has none
+func readXing(file string) (int64, *Xing, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	// the tags fit in the first frame, which follows the ID3v2 tag and maybe
+	// some padding
+	var start int64
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(f, head); err == nil && string(head[:3]) == "ID3" {
+		start = 10 + (int64(head[6])<<21 | int64(head[7])<<14 | int64(head[8])<<7 | int64(head[9]))
+		if head[5]&0x10 != 0 {
+			start += 10 // footer
+		}
+	}
+	buf := make([]byte, 64<<10)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+	buf = buf[:n]
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xff || buf[i+1]&0xe0 != 0xe0 || buf[i+1]&0x06 == 0 || buf[i+2]&0xf0 == 0xf0 || buf[i+2]&0x0c == 0x0c {
+			continue
+		}
+		return start + int64(i), parseXing(buf[i:]), nil
+	}
+	return start, nil, nil
+}
+
+// parseXing parses the Xing/Info tag of the frame at the start of frame
+func parseXing(frame []byte) *Xing {
+	mpeg1 := frame[1]&0x18 == 0x18
+	mono := frame[3]&0xc0 == 0xc0
+	side := 17 // MPEG-1 mono, MPEG-2 and 2.5 stereo
+	switch {
+	case mpeg1 && !mono:
+		side = 32
+	case !mpeg1 && mono:
+		side = 9
+	}
+	p := 4 + side
+	if len(frame) < p+8 {
+		return nil
+	}
+	tag := string(frame[p : p+4])
+	if tag != "Xing" && tag != "Info" {
+		return nil
+	}
+	x := &Xing{Tag: tag}
+	flags := binary.BigEndian.Uint32(frame[p+4:])
+	p += 8
+	field := func(flag uint32, size int) []byte {
+		if flags&flag == 0 || len(frame) < p+size {
+			return nil
+		}
+		b := frame[p : p+size]
+		p += size
+		return b
+	}
+	if b := field(1, 4); b != nil {
+		x.Frames = int(binary.BigEndian.Uint32(b))
+	}
+	if b := field(2, 4); b != nil {
+		x.Bytes = int(binary.BigEndian.Uint32(b))
+	}
+	x.TOC = field(4, 100) != nil
+	if b := field(8, 4); b != nil {
+		x.Quality = int(binary.BigEndian.Uint32(b))
+	}
+	if len(frame) >= p+36 {
+		x.LAME = parseLAME(frame[p : p+36])
+	}
+	return x
+}
+
+// lameMethods names the VBR methods of the LAME tag
+var lameMethods = map[byte]string{
+	1: "CBR", 2: "ABR", 3: "VBR (rh)", 4: "VBR (mtrh)", 5: "VBR (mt)",
+	8: "CBR (2 pass)", 9: "ABR (2 pass)",
+}
+
+// parseLAME parses the 36 byte LAME tag in b
+func parseLAME(b []byte) *LAME {
+	encoder := strings.TrimRight(string(bytes.TrimRight(b[:9], "\x00")), " ")
+	if !strings.HasPrefix(encoder, "LAME") && !strings.HasPrefix(encoder, "Lavc") && !strings.HasPrefix(encoder, "Lavf") {
+		return nil
+	}
+	l := &LAME{
+		Encoder:     encoder,
+		Method:      lameMethods[b[9]&0x0f],
+		Lowpass:     int(b[10]) * 100,
+		NoGapNext:   b[19]&0x40 != 0,
+		NoGapPrev:   b[19]&0x80 != 0,
+		Preset:      lamePreset(int(binary.BigEndian.Uint16(b[26:]) & 0x7ff)),
+		MusicLength: int(binary.BigEndian.Uint32(b[28:])),
+	}
+	if l.Method == "" {
+		l.Method = "unknown"
+	}
+	return l
+}
+
+// lamePreset names the preset recorded in a LAME tag, "" if none
+func lamePreset(p int) string {
+	switch {
+	case p == 0:
+		return ""
+	case p >= 8 && p <= 320:
+		return fmt.Sprintf("ABR %d", p)
+	case p >= 410 && p <= 500:
+		return fmt.Sprintf("V%d", (500-p)/10)
+	}
+	names := map[int]string{
+		1000: "r3mix", 1001: "standard", 1002: "extreme", 1003: "insane",
+		1004: "standard fast", 1005: "extreme fast", 1006: "medium", 1007: "medium fast",
+	}
+	if name, ok := names[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", p)
+}
@@ -0,0 +1,79 @@
+// keys.go contains the keyboard input of mp3play: single keys when stdin is
+// a terminal, lines otherwise
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// stderr is where mp3play prints its messages. It is replaced by a
+// crlfWriter while the terminal is in raw mode.
+var stderr io.Writer = os.Stderr
+
+// readInput starts sending the commands typed on in to commands. When in is
+// a terminal it is put into raw mode so that each key is a command, and the
+// returned function restores it. Otherwise each line is a command.
+func readInput(in *os.File, commands chan<- string) (restore func()) {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		go readCommands(in, commands)
+		return func() {}
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		go readCommands(in, commands)
+		return func() {}
+	}
+	// raw mode also turns off the translation of \n to \r\n on output
+	stderr = crlfWriter{os.Stderr}
+	go readKeys(in, commands)
+	return func() {
+		stderr = os.Stderr
+		term.Restore(fd, state)
+	}
+}
+
+// readKeys sends each key typed on r to commands. Ctrl-C and Ctrl-D quit,
+// since raw mode delivers them as plain bytes instead of signals.
+func readKeys(r io.Reader, commands chan<- string) {
+	key := make([]byte, 1)
+	for {
+		if _, err := r.Read(key); err != nil {
+			close(commands)
+			return
+		}
+		switch key[0] {
+		case 3, 4:
+			commands <- "q"
+		default:
+			commands <- string(key)
+		}
+	}
+}
+
+// readCommands sends each line typed on r to commands
+func readCommands(r io.Reader, commands chan<- string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		commands <- strings.TrimSpace(scanner.Text())
+	}
+	close(commands)
+}
+
+// crlfWriter writes to w with each \n turned into \r\n
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
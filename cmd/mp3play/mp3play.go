@@ -0,0 +1,260 @@
+// mp3play plays mp3 files through libout123. While playing, press a key:
+//
+//	p      pause / resume
+//	f, b   seek 10 seconds forward / back
+//	+, -   volume up / down
+//	n      next file
+//	q      quit
+//
+// When stdin is not a terminal, each line read from it is a command instead.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SiloCityLabs/go-mpg123/mpg123"
+	"github.com/SiloCityLabs/go-mpg123/out123"
+)
+
+const (
+	seekStep   = 10 * time.Second
+	volumeStep = 0.1
+)
+
+func main() {
+	driver := flag.String("driver", "", "output driver (alsa, pulse, coreaudio, win32, ...), default if empty")
+	device := flag.String("device", "", "output device, default if empty")
+	output := flag.String("o", "", "output as driver:device, e.g. alsa:hw:1,0 or jack:system:playback_1,system:playback_2 (overrides -driver and -device)")
+	list := flag.Bool("list", false, "list output drivers and devices and exit")
+	name := flag.String("name", "mp3play", "stream name shown by the sound server (pulse, PipeWire, jack)")
+	fade := flag.Duration("fade", 10*time.Millisecond, "fade in and out on start, pause, seek and stop, 0 for hard cuts")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mp3play [flags] <file.mp3> ...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 && !*list {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output != "" {
+		*driver, *device = out123.SplitDevice(*output)
+	}
+
+	out, err := out123.New()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mp3play:", err)
+		os.Exit(1)
+	}
+	defer out.Delete()
+	if *list {
+		if err := listOutputs(out); err != nil {
+			fmt.Fprintln(os.Stderr, "mp3play:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := out.SetName(*name); err != nil {
+		fmt.Fprintln(os.Stderr, "mp3play:", err)
+		os.Exit(1)
+	}
+	if err := out.Open(*driver, *device); err != nil {
+		fmt.Fprintln(os.Stderr, "mp3play:", err)
+		os.Exit(1)
+	}
+	defer out.Close()
+	if drv, dev, err := out.DriverInfo(); err == nil {
+		fmt.Fprintf(os.Stderr, "Output: %s %s\n", drv, dev)
+	}
+
+	commands := make(chan string)
+	restore := readInput(os.Stdin, commands)
+	defer restore()
+
+	for _, file := range flag.Args() {
+		quit, err := play(out, file, commands, *fade)
+		if err != nil {
+			fmt.Fprintf(stderr, "mp3play: %s: %v\n", file, err)
+		}
+		if quit {
+			break
+		}
+	}
+}
+
+// play plays one file and reports whether the user asked to quit
+func play(out *out123.Output, file string, commands <-chan string, fade time.Duration) (bool, error) {
+	decoder, err := mpg123.NewDecoder("")
+	if err != nil {
+		return false, err
+	}
+	defer decoder.Delete()
+	if err := decoder.SetFades(fade, fade); err != nil {
+		return false, err
+	}
+	if err := decoder.Open(file); err != nil {
+		return false, err
+	}
+	defer decoder.Close()
+
+	rate, channels, encoding := decoder.GetFormat()
+	// fixed rate devices (common with CoreAudio) need the decoder to resample
+	devRate, err := out.NegotiateRate(rate, channels, encoding)
+	if err != nil {
+		return false, err
+	}
+	if devRate != rate {
+		// the output format only applies to a stream opened after it was set
+		decoder.Close()
+		decoder.FormatNone()
+		decoder.Format(devRate, channels, encoding)
+		if err := decoder.Open(file); err != nil {
+			return false, err
+		}
+		if got, _, _ := decoder.GetFormat(); got != devRate {
+			return false, fmt.Errorf("cannot resample %d Hz to %d Hz", rate, devRate)
+		}
+	}
+	if err := out.Start(devRate, channels, encoding); err != nil {
+		return false, err
+	}
+	defer out.Stop()
+	if devRate != rate {
+		fmt.Fprintf(stderr, "Playing %s (%d Hz resampled to %d Hz, %d channels)\n", file, rate, devRate, channels)
+	} else {
+		fmt.Fprintf(stderr, "Playing %s (%d Hz, %d channels)\n", file, rate, channels)
+	}
+
+	buf := make([]byte, mpg123.OUT_MAX_BUFFER_SIZE)
+	// stop ends what is playing: with fades, the fade out is played to the
+	// end, otherwise the queued audio is dropped
+	stop := func() {
+		if fade == 0 {
+			out.Drop()
+			return
+		}
+		decoder.FadeOut()
+		for {
+			n, err := decoder.Read(buf)
+			if n > 0 {
+				out.Write(buf[:n])
+			}
+			if err != nil {
+				break
+			}
+		}
+		out.Drain()
+	}
+	paused := false
+	for {
+		if paused {
+			// block until the next command
+			cmd, ok := <-commands
+			if !ok {
+				return true, nil
+			}
+			if quit, next := control(out, decoder, stop, cmd, &paused); quit || next {
+				return quit, nil
+			}
+			continue
+		}
+		select {
+		case cmd, ok := <-commands:
+			if !ok {
+				commands = nil
+				continue
+			}
+			if quit, next := control(out, decoder, stop, cmd, &paused); quit || next {
+				return quit, nil
+			}
+		default:
+		}
+
+		n, err := decoder.Read(buf)
+		if n > 0 {
+			if _, werr := out.Write(buf[:n]); werr != nil {
+				return false, werr
+			}
+		}
+		if err == mpg123.EOF {
+			out.Drain()
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// control applies a user command and reports whether to quit or skip to the next file
+func control(out *out123.Output, decoder *mpg123.Decoder, stop func(), cmd string, paused *bool) (quit bool, next bool) {
+	if *paused {
+		// nothing is playing, so there is nothing to fade
+		stop = out.Drop
+	}
+	switch cmd {
+	case "q":
+		stop()
+		return true, false
+	case "n":
+		stop()
+		return false, true
+	case "p":
+		*paused = !*paused
+		if *paused {
+			stop()
+			out.Pause()
+			fmt.Fprintln(stderr, "Paused")
+		} else {
+			out.Continue()
+			decoder.FadeIn()
+			fmt.Fprintln(stderr, "Playing")
+		}
+	case "f", "b":
+		pos := decoder.TellTime()
+		if cmd == "f" {
+			pos += seekStep
+		} else if pos -= seekStep; pos < 0 {
+			pos = 0
+		}
+		// the seek fades in again
+		stop()
+		if _, err := decoder.SeekTime(pos); err != nil {
+			fmt.Fprintln(stderr, "Seek failed:", err)
+		} else {
+			fmt.Fprintln(stderr, "Position", pos.Round(time.Second))
+		}
+	case "+", "-":
+		change := volumeStep
+		if cmd == "-" {
+			change = -change
+		}
+		decoder.VolumeChange(change)
+		base, _, _ := decoder.GetVolume()
+		fmt.Fprintf(stderr, "Volume %.0f%%\n", base*100)
+	}
+	return false, false
+}
+
+// listOutputs prints the drivers and, where the driver can enumerate them,
+// their devices in the driver:device form accepted by -o
+func listOutputs(out *out123.Output) error {
+	drivers, err := out.Drivers()
+	if err != nil {
+		return err
+	}
+	for _, drv := range drivers {
+		fmt.Printf("%-12s %s\n", drv.Name, drv.Description)
+		devices, _, err := out.Devices(drv.Name)
+		if err != nil {
+			continue
+		}
+		for _, dev := range devices {
+			fmt.Printf("  %s:%s\t%s\n", drv.Name, dev.Name, dev.Description)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+// mp3scan walks directory trees and probes every mp3 file found, several at
+// a time, printing format, duration, bitrate and tags of each as JSON lines
+// or CSV, to index a music library.
+//
+//	mp3scan ~/Music > library.jsonl
+//	mp3scan -format csv -workers 16 -length estimate /srv/music > library.csv
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SiloCityLabs/go-mpg123/mpg123"
+)
+
+// Entry is everything mp3scan reports about one file. Files that could not
+// be probed are reported with Error set.
+type Entry struct {
+	File           string        `json:"file"`
+	Size           int64         `json:"size"`
+	Rate           int           `json:"rate,omitempty"`
+	Channels       int           `json:"channels,omitempty"`
+	Duration       time.Duration `json:"duration_ns,omitempty"`
+	Samples        int64         `json:"samples,omitempty"`
+	Exact          bool          `json:"exact_length"`
+	BitrateMode    string        `json:"bitrate_mode,omitempty"`
+	Bitrate        int           `json:"bitrate_kbps,omitempty"`
+	AverageBitrate int           `json:"average_bitrate_kbps,omitempty"`
+	Title          string        `json:"title,omitempty"`
+	Artist         string        `json:"artist,omitempty"`
+	Album          string        `json:"album,omitempty"`
+	Error          string        `json:"error,omitempty"`
+}
+
+var csvHeader = []string{"file", "size", "rate", "channels", "duration_s", "samples", "exact_length",
+	"bitrate_mode", "bitrate_kbps", "average_bitrate_kbps", "title", "artist", "album", "error"}
+
+func (e Entry) record() []string {
+	return []string{
+		e.File,
+		strconv.FormatInt(e.Size, 10),
+		strconv.Itoa(e.Rate),
+		strconv.Itoa(e.Channels),
+		strconv.FormatFloat(e.Duration.Seconds(), 'f', 3, 64),
+		strconv.FormatInt(e.Samples, 10),
+		strconv.FormatBool(e.Exact),
+		e.BitrateMode,
+		strconv.Itoa(e.Bitrate),
+		strconv.Itoa(e.AverageBitrate),
+		e.Title,
+		e.Artist,
+		e.Album,
+		e.Error,
+	}
+}
+
+var lengthModes = map[string]mpg123.DurationMode{
+	"estimate": mpg123.DurationEstimate,
+	"exact":    mpg123.DurationExact,
+	"auto":     mpg123.DurationAuto,
+}
+
+func main() {
+	workers := flag.Int("workers", runtime.NumCPU(), "number of files probed at once")
+	format := flag.String("format", "json", "output format: json (one object per line) or csv")
+	length := flag.String("length", "auto", "how to find the length: estimate (headers only), exact (scan every file) or auto (scan VBR files without a Xing header)")
+	exts := flag.String("ext", ".mp3", "comma separated file extensions to probe, case insensitive")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mp3scan [-workers n] [-format json|csv] [-length mode] [-ext list] [dir ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	mode, ok := lengthModes[*length]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "mp3scan: unknown length mode", *length)
+		os.Exit(2)
+	}
+	if *format != "json" && *format != "csv" {
+		fmt.Fprintln(os.Stderr, "mp3scan: unknown output format", *format)
+		os.Exit(2)
+	}
+	if *workers < 1 {
+		*workers = 1
+	}
+	roots := flag.Args()
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	// keep one library reference for the whole run rather than one per file
+	release, err := mpg123.Acquire()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mp3scan:", err)
+		os.Exit(1)
+	}
+	defer release()
+
+	files := make(chan string, *workers)
+	entries := make(chan Entry, *workers)
+	walkFailed := false
+	go func() {
+		defer close(files)
+		for _, root := range roots {
+			if err := walk(root, extensions(*exts), files); err != nil {
+				fmt.Fprintln(os.Stderr, "mp3scan:", err)
+				walkFailed = true
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range files {
+				entries <- probe(file, mode)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(entries)
+	}()
+
+	failed, err := write(os.Stdout, *format, entries)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mp3scan:", err)
+		os.Exit(1)
+	}
+	if failed > 0 || walkFailed {
+		fmt.Fprintf(os.Stderr, "mp3scan: %d files could not be probed\n", failed)
+		os.Exit(1)
+	}
+}
+
+// extensions parses the -ext flag
+func extensions(list string) map[string]bool {
+	exts := make(map[string]bool)
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts[ext] = true
+	}
+	return exts
+}
+
+// walk sends the regular files below root with one of exts to files.
+// Unreadable directories are reported and skipped.
+func walk(root string, exts map[string]bool, files chan<- string) error {
+	return filepath.WalkDir(root, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, "mp3scan:", err)
+			return nil
+		}
+		if de.Type().IsRegular() && exts[strings.ToLower(filepath.Ext(path))] {
+			files <- path
+		}
+		return nil
+	})
+}
+
+// probe opens file with a decoder of its own and collects its Entry
+func probe(file string, mode mpg123.DurationMode) Entry {
+	entry := Entry{File: file}
+	if st, err := os.Stat(file); err == nil {
+		entry.Size = st.Size()
+	}
+	fail := func(err error) Entry {
+		entry.Error = err.Error()
+		return entry
+	}
+	decoder, err := mpg123.NewDecoder("")
+	if err != nil {
+		return fail(err)
+	}
+	defer decoder.Delete()
+	if err := decoder.Open(file); err != nil {
+		return fail(err)
+	}
+	defer decoder.Close()
+
+	// a scan chosen by mode makes the length in Info exact
+	if _, err := decoder.Duration(mode); err != nil && err != mpg123.ErrLengthUnknown {
+		return fail(err)
+	}
+	info, err := decoder.Info()
+	if err != nil {
+		return fail(err)
+	}
+	entry.Rate, entry.Channels = info.Format.Rate, info.Format.Channels
+	entry.Duration = info.Duration
+	entry.Samples = info.Samples
+	entry.Exact = info.Exact
+	entry.Title, entry.Artist, entry.Album = info.Tags.Title, info.Tags.Artist, info.Tags.Album
+	if br, err := decoder.BitrateInfo(); err == nil {
+		entry.BitrateMode = br.Mode.String()
+		entry.Bitrate = br.Nominal
+		entry.AverageBitrate = br.Average
+	}
+	return entry
+}
+
+// write prints the entries as they arrive and returns how many of them
+// report an error
+func write(w io.Writer, format string, entries <-chan Entry) (int, error) {
+	failed := 0
+	var werr error
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		werr = cw.Write(csvHeader)
+		for e := range entries {
+			if e.Error != "" {
+				failed++
+			}
+			if werr == nil {
+				werr = cw.Write(e.record())
+			}
+		}
+		cw.Flush()
+		if werr == nil {
+			werr = cw.Error()
+		}
+	default:
+		enc := json.NewEncoder(w)
+		for e := range entries {
+			if e.Error != "" {
+				failed++
+			}
+			if werr == nil {
+				werr = enc.Encode(e)
+			}
+		}
+	}
+	return failed, werr
+}
@@ -0,0 +1,135 @@
+// mp3towav converts mp3 files (or stdin) to WAV.
+//
+//	mp3towav song.mp3 other.mp3          # writes song.wav and other.wav
+//	mp3towav -rate 48000 -enc s24 -o out.wav song.mp3
+//	mp3towav -telephony -o hold.wav music.mp3   # 8 kHz mono µ-law
+//	curl -s http://example.com/a.mp3 | mp3towav > a.wav
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SiloCityLabs/go-mpg123/mpg123"
+)
+
+var encodings = map[string]int{
+	"u8":   mpg123.ENC_UNSIGNED_8,
+	"s16":  mpg123.ENC_SIGNED_16,
+	"s24":  mpg123.ENC_SIGNED_24,
+	"s32":  mpg123.ENC_SIGNED_32,
+	"f32":  mpg123.ENC_FLOAT_32,
+	"f64":  mpg123.ENC_FLOAT_64,
+	"ulaw": mpg123.ENC_ULAW_8,
+	"alaw": mpg123.ENC_ALAW_8,
+}
+
+func main() {
+	out := flag.String("o", "", "output file (only with a single input), - for stdout")
+	rate := flag.Int("rate", 0, "output sample rate, 0 keeps the rate of the input")
+	channels := flag.Int("channels", 0, "output channels (1 or 2), 0 keeps the input layout")
+	enc := flag.String("enc", "s16", "output encoding: u8, s16, s24, s32, f32, f64, ulaw or alaw")
+	gapless := flag.Bool("gapless", true, "remove encoder delay and padding")
+	progress := flag.Bool("progress", false, "show progress on stderr")
+	telephony := flag.Bool("telephony", false, "8 kHz mono µ-law for PBX/SIP systems, overrides -rate, -channels and -enc")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mp3towav [flags] [file.mp3 ...]")
+		fmt.Fprintln(os.Stderr, "reads stdin and writes stdout when no files are given")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	encoding, ok := encodings[*enc]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "mp3towav: unknown encoding", *enc)
+		os.Exit(2)
+	}
+	opts := mpg123.ConvertOptions{
+		Rate:     *rate,
+		Channels: *channels,
+		Encoding: encoding,
+		Gapless:  *gapless,
+		SkipTags: true, // WAV output carries no tags
+	}
+	if *telephony {
+		opts.Rate = mpg123.Telephony.Rate
+		opts.Channels = mpg123.Telephony.Channels
+		opts.Encoding = mpg123.Telephony.Encoding
+	}
+	if *progress {
+		opts.Progress = showProgress
+	}
+
+	inputs := flag.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	if *out != "" && len(inputs) > 1 {
+		fmt.Fprintln(os.Stderr, "mp3towav: -o needs a single input")
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, in := range inputs {
+		dst := *out
+		if dst == "" {
+			dst = wavName(in)
+		}
+		if err := convert(dst, in, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "mp3towav: %s: %v\n", in, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// showProgress prints the position and length on a single status line
+func showProgress(done, total time.Duration) {
+	if total > 0 {
+		fmt.Fprintf(os.Stderr, "\r%v / %v (%d%%) ", done.Round(time.Second), total.Round(time.Second), done*100/total)
+	} else {
+		fmt.Fprintf(os.Stderr, "\r%v ", done.Round(time.Second))
+	}
+	if done == total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// wavName derives the output name from the input name
+func wavName(in string) string {
+	if in == "-" {
+		return "-"
+	}
+	return strings.TrimSuffix(in, filepath.Ext(in)) + ".wav"
+}
+
+func convert(dst string, src string, opts mpg123.ConvertOptions) error {
+	switch {
+	case src == "-" && dst == "-":
+		return mpg123.ConvertToWAV(os.Stdout, os.Stdin, opts)
+	case src == "-":
+		f, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		if err := mpg123.ConvertToWAV(f, os.Stdin, opts); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	case dst == "-":
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return mpg123.ConvertToWAV(os.Stdout, f, opts)
+	}
+	return mpg123.ConvertFileToWAV(dst, src, opts)
+}
@@ -0,0 +1,140 @@
+// radio connects to an Icecast/SHOUTcast stream, prints the ICY metadata as
+// it changes and plays the decoded audio through libout123, or writes it as
+// WAV (or raw PCM) to a file or to stdout:
+//
+//	radio http://example.com/stream.mp3
+//	radio -device pulse http://example.com/stream.mp3
+//	radio -o recording.wav http://example.com/stream.mp3
+//	radio -o - http://example.com/stream.mp3 | aplay
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/SiloCityLabs/go-mpg123/mpg123"
+	"github.com/SiloCityLabs/go-mpg123/out123"
+)
+
+func main() {
+	out := flag.String("o", "", "output file, - for stdout; plays the stream if empty")
+	device := flag.String("device", "", "playback output as driver:device, e.g. alsa:hw:1,0, default output if empty")
+	raw := flag.Bool("raw", false, "write raw PCM instead of WAV")
+	reconnect := flag.Int("reconnect", 5, "reconnection attempts when the stream drops")
+	delay := flag.Duration("delay", 2*time.Second, "pause between reconnection attempts")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: radio [flags] <url>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *out, *device, *raw, *reconnect, *delay); err != nil {
+		fmt.Fprintln(os.Stderr, "radio:", err)
+		os.Exit(1)
+	}
+}
+
+func run(url string, out string, device string, raw bool, reconnect int, delay time.Duration) error {
+	decoder, err := mpg123.NewDecoder("")
+	if err != nil {
+		return err
+	}
+	defer decoder.Delete()
+
+	stream, err := decoder.OpenURL(url, &mpg123.URLOptions{
+		OnMeta: func(meta mpg123.ICYMeta) {
+			if meta.StreamTitle != "" {
+				fmt.Fprintln(os.Stderr, "Now playing:", meta.StreamTitle)
+			}
+		},
+		Reconnect:      reconnect,
+		ReconnectDelay: delay,
+	})
+	if err != nil {
+		return err
+	}
+
+	var o io.Writer = os.Stdout
+	var player *out123.Output
+	switch out {
+	case "":
+		if player, err = openPlayer(device); err != nil {
+			return err
+		}
+		defer player.Delete()
+		defer player.Close()
+	case "-":
+	default:
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		o = f
+	}
+
+	buf := make([]byte, mpg123.OUT_MAX_BUFFER_SIZE)
+	var w io.Writer
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 && w == nil {
+			// the format is known once the first frame is decoded
+			rate, chans, enc := decoder.GetFormat()
+			fmt.Fprintf(os.Stderr, "Format: %d Hz, %d channels, %v\n", rate, chans, mpg123.Encoding(enc))
+			w = o
+			if player != nil {
+				if err := player.Start(rate, chans, enc); err != nil {
+					return err
+				}
+				defer player.Stop()
+				w = player
+			} else if !raw {
+				wav, err := mpg123.NewWAVWriter(o, rate, chans, enc)
+				if err != nil {
+					return err
+				}
+				defer wav.Close()
+				w = wav
+			}
+		}
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			if player != nil {
+				player.Drain()
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// openPlayer opens the libout123 output given as driver:device
+func openPlayer(device string) (*out123.Output, error) {
+	player, err := out123.New()
+	if err != nil {
+		return nil, err
+	}
+	if err := player.SetName("radio"); err != nil {
+		player.Delete()
+		return nil, err
+	}
+	driver, dev := out123.SplitDevice(device)
+	if err := player.Open(driver, dev); err != nil {
+		player.Delete()
+		return nil, err
+	}
+	return player, nil
+}
@@ -0,0 +1,176 @@
+// mediastream decodes an mp3 file or HTTP stream to 8 kHz mono µ-law and
+// sends it over a WebSocket as 20 ms media messages in the JSON format of
+// telephony media stream APIs (Twilio Media Streams and compatible), paced in
+// real time:
+//
+//	mediastream ws://localhost:8080/media hold-music.mp3
+//	mediastream -sid MZ123 wss://example.com/media http://example.com/stream.mp3
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SiloCityLabs/go-mpg123/mpg123"
+)
+
+// frameDuration is the length of audio in one media message
+const frameDuration = 20 * time.Millisecond
+
+// ulawSilence is the µ-law code for a zero sample, used to pad the last frame
+const ulawSilence = 0xff
+
+type message struct {
+	Event          string       `json:"event"`
+	SequenceNumber string       `json:"sequenceNumber,omitempty"`
+	StreamSid      string       `json:"streamSid,omitempty"`
+	Start          *startInfo   `json:"start,omitempty"`
+	Media          *mediaChunk  `json:"media,omitempty"`
+	Stop           *stopDetails `json:"stop,omitempty"`
+}
+
+type startInfo struct {
+	StreamSid   string      `json:"streamSid"`
+	Tracks      []string    `json:"tracks"`
+	MediaFormat mediaFormat `json:"mediaFormat"`
+}
+
+type mediaFormat struct {
+	Encoding   string `json:"encoding"`
+	SampleRate int    `json:"sampleRate"`
+	Channels   int    `json:"channels"`
+}
+
+type mediaChunk struct {
+	Track     string `json:"track"`
+	Chunk     string `json:"chunk"`
+	Timestamp string `json:"timestamp"`
+	Payload   string `json:"payload"`
+}
+
+type stopDetails struct {
+	StreamSid string `json:"streamSid"`
+}
+
+func main() {
+	sid := flag.String("sid", "MZ00000000000000000000000000000000", "stream SID put into every message")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mediastream [flags] <ws-url> <file.mp3|http-url>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), flag.Arg(1), *sid); err != nil {
+		fmt.Fprintln(os.Stderr, "mediastream:", err)
+		os.Exit(1)
+	}
+}
+
+func run(wsURL string, src string, sid string) error {
+	decoder, err := mpg123.NewDecoder("")
+	if err != nil {
+		return err
+	}
+	defer decoder.Delete()
+	// 8 kHz mono µ-law, converted in Go where libmpg123 cannot produce it
+	pipeline, err := decoder.SetTelephony(mpg123.ENC_ULAW_8)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		resp, err := http.Get(src)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s: %s", src, resp.Status)
+		}
+		if err := decoder.OpenReader(resp.Body); err != nil {
+			return err
+		}
+	} else {
+		if err := decoder.Open(src); err != nil {
+			return err
+		}
+	}
+	defer decoder.Close()
+	audio, err := pipeline.Reader()
+	if err != nil {
+		return err
+	}
+
+	ws, err := dialWebSocket(wsURL)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	seq := 0
+	send := func(m message) error {
+		seq++
+		m.SequenceNumber = strconv.Itoa(seq)
+		m.StreamSid = sid
+		msg, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		return ws.WriteText(msg)
+	}
+
+	if err := ws.WriteText([]byte(`{"event":"connected","protocol":"Call","version":"1.0.0"}`)); err != nil {
+		return err
+	}
+	f := pipeline.Sink
+	err = send(message{Event: "start", Start: &startInfo{
+		StreamSid:   sid,
+		Tracks:      []string{"outbound"},
+		MediaFormat: mediaFormat{Encoding: "audio/x-mulaw", SampleRate: f.Rate, Channels: f.Channels},
+	}})
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, f.Rate*int(frameDuration/time.Millisecond)/1000)
+	start := time.Now()
+	for chunk := 1; ; chunk++ {
+		n, rerr := io.ReadFull(audio, frame)
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil && rerr != io.ErrUnexpectedEOF {
+			return rerr
+		}
+		for i := n; i < len(frame); i++ {
+			frame[i] = ulawSilence
+		}
+		offset := time.Duration(chunk-1) * frameDuration
+		// pace against the start time, so send delays do not add up
+		time.Sleep(time.Until(start.Add(offset)))
+		err := send(message{Event: "media", Media: &mediaChunk{
+			Track:     "outbound",
+			Chunk:     strconv.Itoa(chunk),
+			Timestamp: strconv.FormatInt(offset.Milliseconds(), 10),
+			Payload:   base64.StdEncoding.EncodeToString(frame),
+		}})
+		if err != nil {
+			return err
+		}
+		if rerr == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+	return send(message{Event: "stop", Stop: &stopDetails{StreamSid: sid}})
+}
@@ -0,0 +1,77 @@
+// outdevices lists the audio output drivers and devices known to libout123,
+// or plays a short test tone on one of them to find out which card it is:
+//
+//	outdevices
+//	outdevices alsa:hw:1,0
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/SiloCityLabs/go-mpg123/mpg123"
+	"github.com/SiloCityLabs/go-mpg123/out123"
+)
+
+func main() {
+	out, err := out123.New()
+	if err != nil {
+		panic(err)
+	}
+	defer out.Delete()
+
+	if len(os.Args) < 2 {
+		list(out)
+		return
+	}
+	if err := tone(out, os.Args[1]); err != nil {
+		fmt.Fprintln(os.Stderr, "outdevices:", err)
+		os.Exit(1)
+	}
+}
+
+// list prints every driver with the devices it reports
+func list(out *out123.Output) {
+	drivers, err := out.Drivers()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "outdevices:", err)
+		os.Exit(1)
+	}
+	for _, drv := range drivers {
+		fmt.Printf("%s\t%s\n", drv.Name, drv.Description)
+		devices, _, err := out.Devices(drv.Name)
+		if err != nil {
+			// many drivers (file writers, network sinks) cannot enumerate
+			continue
+		}
+		for _, dev := range devices {
+			fmt.Printf("\t%s:%s\t%s\n", drv.Name, dev.Name, dev.Description)
+		}
+	}
+}
+
+// tone plays one second of a 440 Hz sine on the given driver:device
+func tone(out *out123.Output, spec string) error {
+	const rate = 44100
+	if err := out.Open(out123.SplitDevice(spec)); err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := out.Start(rate, 1, mpg123.ENC_SIGNED_16); err != nil {
+		return err
+	}
+	buf := make([]byte, 2*rate)
+	for i := 0; i < rate; i++ {
+		v := 0.3 * math.Sin(2*math.Pi*440*float64(i)/rate)
+		// out123 expects host byte order, which is little endian on all
+		// common sound card hosts
+		binary.LittleEndian.PutUint16(buf[2*i:], uint16(int16(v*math.MaxInt16)))
+	}
+	if _, err := out.Write(buf); err != nil {
+		return err
+	}
+	out.Drain()
+	return nil
+}
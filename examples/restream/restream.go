@@ -0,0 +1,266 @@
+// restream relays an mp3 radio stream as uncompressed audio: one connection
+// to the upstream server is decoded in feed mode, and the PCM is fanned out
+// to any number of HTTP listeners, each with its own buffer. The stream
+// titles are passed on as server-sent events:
+//
+//	restream -listen :8000 http://example.com/stream.mp3
+//	curl -s localhost:8000/stream.wav | aplay
+//	curl -s localhost:8000/stream.pcm | aplay -f cd
+//	curl -N localhost:8000/meta
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SiloCityLabs/go-mpg123/mpg123"
+)
+
+// chunkDuration is the length of audio in one chunk sent to the listeners
+const chunkDuration = 100 * time.Millisecond
+
+func main() {
+	listen := flag.String("listen", ":8000", "address to serve listeners on")
+	rate := flag.Int("rate", 44100, "output sample rate")
+	channels := flag.Int("channels", 2, "output channels")
+	buffer := flag.Duration("buffer", 5*time.Second, "audio buffered per listener before it is dropped")
+	delay := flag.Duration("delay", 2*time.Second, "pause before reconnecting to the upstream")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: restream [flags] <upstream-url>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// a fixed output format, so listeners are not disturbed when the
+	// upstream reconnects with another one
+	f := mpg123.Format{Rate: *rate, Channels: *channels, Encoding: mpg123.ENC_SIGNED_16}
+	h := newHub(int(*buffer / chunkDuration))
+	go func() {
+		for {
+			if err := relay(flag.Arg(0), f, h); err != nil {
+				log.Println("upstream:", err)
+			}
+			time.Sleep(*delay)
+		}
+	}()
+
+	http.HandleFunc("/stream.wav", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/wav")
+		// the WAV header announces a stream of unknown length
+		wav, err := mpg123.NewWAVWriter(w, f.Rate, f.Channels, f.Encoding)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		serve(w, r, wav, h)
+	})
+	http.HandleFunc("/stream.pcm", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/L16;rate="+strconv.Itoa(f.Rate)+";channels="+strconv.Itoa(f.Channels))
+		serve(w, r, w, h)
+	})
+	http.HandleFunc("/meta", func(w http.ResponseWriter, r *http.Request) {
+		serveMeta(w, r, h)
+	})
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
+
+// relay connects to the upstream once and decodes it into the hub until the
+// connection ends
+func relay(url string, f mpg123.Format, h *hub) error {
+	client := &http.Client{Transport: &mpg123.ICYTransport{
+		OnMeta: func(_ *http.Request, m mpg123.ICYMeta) {
+			log.Println("now playing:", m.StreamTitle)
+			h.setMeta(m)
+		},
+	}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	decoder, err := mpg123.NewDecoder("")
+	if err != nil {
+		return err
+	}
+	defer decoder.Delete()
+	err = decoder.SetOutput(mpg123.ConvertOptions{Rate: f.Rate, Channels: f.Channels, Encoding: f.Encoding})
+	if err != nil {
+		return err
+	}
+	if err := decoder.OpenFeed(); err != nil {
+		return err
+	}
+	stream := decoder.FeedReader(resp.Body, f).Paranoid()
+	log.Println("connected to", url)
+
+	// profiles attribute the decoding to the upstream
+	decoder.SetLabels("upstream", url)
+	buf := make([]byte, f.BytesPerFrame()*f.Rate*int(chunkDuration/time.Millisecond)/1000)
+	decoder.Do(context.Background(), func(context.Context) {
+		for {
+			var n int
+			n, err = io.ReadFull(stream, buf)
+			if n > 0 {
+				h.broadcast(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+	return err
+}
+
+// serve copies the audio of the hub to a listener until it disconnects or
+// falls behind
+func serve(w http.ResponseWriter, r *http.Request, out io.Writer, h *hub) {
+	chunks := h.join()
+	defer h.leave(chunks)
+	rc := http.NewResponseController(w)
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				log.Println(r.RemoteAddr, "fell behind, dropped")
+				return
+			}
+			if _, err := out.Write(chunk); err != nil {
+				return
+			}
+			rc.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// serveMeta sends the current stream title and every change as server-sent
+// events
+func serveMeta(w http.ResponseWriter, r *http.Request, h *hub) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	metas, current := h.watch()
+	defer h.unwatch(metas)
+	rc := http.NewResponseController(w)
+	send := func(m mpg123.ICYMeta) error {
+		data, err := json.Marshal(map[string]string{"title": m.StreamTitle, "url": m.StreamURL})
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: meta\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	if err := send(current); err != nil {
+		return
+	}
+	for {
+		select {
+		case m := <-metas:
+			if err := send(m); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// hub fans the decoded audio and the metadata out to the listeners
+type hub struct {
+	mu        sync.Mutex
+	size      int // chunks buffered per listener
+	listeners map[chan []byte]bool
+	watchers  map[chan mpg123.ICYMeta]bool
+	meta      mpg123.ICYMeta
+}
+
+func newHub(size int) *hub {
+	if size < 1 {
+		size = 1
+	}
+	return &hub{
+		size:      size,
+		listeners: make(map[chan []byte]bool),
+		watchers:  make(map[chan mpg123.ICYMeta]bool),
+	}
+}
+
+// broadcast queues a chunk of audio for every listener. A listener whose
+// buffer is full is dropped rather than holding up the others.
+func (h *hub) broadcast(p []byte) {
+	chunk := append([]byte(nil), p...)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.listeners {
+		select {
+		case c <- chunk:
+		default:
+			delete(h.listeners, c)
+			close(c)
+		}
+	}
+}
+
+func (h *hub) join() chan []byte {
+	c := make(chan []byte, h.size)
+	h.mu.Lock()
+	h.listeners[c] = true
+	h.mu.Unlock()
+	return c
+}
+
+func (h *hub) leave(c chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.listeners[c] {
+		delete(h.listeners, c)
+		close(c)
+	}
+}
+
+// setMeta records new metadata and passes it to the watchers that keep up
+func (h *hub) setMeta(m mpg123.ICYMeta) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.meta = m
+	for c := range h.watchers {
+		select {
+		case c <- m:
+		default:
+		}
+	}
+}
+
+// watch returns a channel receiving metadata changes and the current metadata
+func (h *hub) watch() (chan mpg123.ICYMeta, mpg123.ICYMeta) {
+	c := make(chan mpg123.ICYMeta, 1)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.watchers[c] = true
+	return c, h.meta
+}
+
+func (h *hub) unwatch(c chan mpg123.ICYMeta) {
+	h.mu.Lock()
+	delete(h.watchers, c)
+	h.mu.Unlock()
+}
@@ -0,0 +1,209 @@
+// lame.go contains bindings to libmp3lame for encoding decoded (and possibly
+// processed) PCM back to mp3
+
+package lame
+
+/*
+#include <lame/lame.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// Options selects how Writer encodes. The zero value encodes 128 kbit/s CBR.
+type Options struct {
+	Bitrate    int     // CBR bitrate in kbit/s, 128 if 0; the mean bitrate for ABR
+	VBR        bool    // variable bitrate, see VBRQuality
+	ABR        bool    // average bitrate around Bitrate, ignored with VBR
+	VBRQuality float64 // 0 (best) to 9.999 (smallest), used with VBR
+	Quality    int     // encoder effort, 1 (best, slowest) to 9; 0 keeps the LAME default
+	OutRate    int     // output sample rate, 0 lets LAME choose one for the bitrate
+}
+
+// frameChunk is the most sample frames passed to LAME in one call
+const frameChunk = 4096
+
+// Writer is an io.WriteCloser encoding signed 16 bit PCM in host byte order
+// (mpg123.ENC_SIGNED_16, as produced by the decoder) to mp3. Close must be
+// called to flush the last frames.
+type Writer struct {
+	gfp      *C.lame_global_flags
+	w        io.Writer
+	channels int
+	pending  []byte  // an incomplete sample frame left from the last Write
+	samples  []int16 // aligned copy of the input passed to LAME
+	out      []byte
+}
+
+// NewWriter returns a Writer encoding audio with the given rate and channel
+// count (1 or 2) to w.
+func NewWriter(w io.Writer, rate int, channels int, opts Options) (*Writer, error) {
+	if channels != 1 && channels != 2 {
+		return nil, fmt.Errorf("lame error: unsupported channel count %d", channels)
+	}
+	gfp := C.lame_init()
+	if gfp == nil {
+		return nil, fmt.Errorf("error initializing lame")
+	}
+	C.lame_set_num_channels(gfp, C.int(channels))
+	C.lame_set_in_samplerate(gfp, C.int(rate))
+	if channels == 1 {
+		C.lame_set_mode(gfp, C.MONO)
+	}
+	if opts.OutRate > 0 {
+		C.lame_set_out_samplerate(gfp, C.int(opts.OutRate))
+	}
+	if opts.Quality > 0 {
+		C.lame_set_quality(gfp, C.int(opts.Quality))
+	}
+	bitrate := opts.Bitrate
+	if bitrate == 0 {
+		bitrate = 128
+	}
+	switch {
+	case opts.VBR:
+		C.lame_set_VBR(gfp, C.vbr_default)
+		C.lame_set_VBR_quality(gfp, C.float(opts.VBRQuality))
+	case opts.ABR:
+		C.lame_set_VBR(gfp, C.vbr_abr)
+		C.lame_set_VBR_mean_bitrate_kbps(gfp, C.int(bitrate))
+	default:
+		C.lame_set_brate(gfp, C.int(bitrate))
+	}
+	if C.lame_init_params(gfp) < 0 {
+		C.lame_close(gfp)
+		return nil, fmt.Errorf("lame error: invalid parameters (rate %d, %d channels, %d kbit/s)", rate, channels, bitrate)
+	}
+	return &Writer{
+		gfp:      gfp,
+		w:        w,
+		channels: channels,
+		samples:  make([]int16, frameChunk*channels),
+		// worst case size from lame.h: 1.25 * samples + 7200
+		out: make([]byte, frameChunk*5/4+7200),
+	}, nil
+}
+
+// Write encodes p. Bytes not making up a whole sample frame are kept for the
+// next call, so p may be split anywhere. If encoding fails, Write returns the
+// number of bytes of p that were encoded before the error.
+func (lw *Writer) Write(p []byte) (int, error) {
+	if lw.gfp == nil {
+		return 0, fmt.Errorf("lame error: write to closed writer")
+	}
+	frameSize := 2 * lw.channels
+	in := p
+	pending := len(lw.pending)
+	if pending > 0 {
+		in = append(lw.pending, p...)
+		lw.pending = nil
+	}
+	encoded := 0
+	// consumed returns how much of p was encoded after an error, keeping
+	// what is left of the bytes from the last call for the next one
+	consumed := func() int {
+		if encoded < pending {
+			lw.pending = append([]byte(nil), in[:pending-encoded]...)
+			return 0
+		}
+		return encoded - pending
+	}
+	for len(in) >= frameSize {
+		frames := len(in) / frameSize
+		if frames > frameChunk {
+			frames = frameChunk
+		}
+		raw := unsafe.Slice((*byte)(unsafe.Pointer(&lw.samples[0])), len(lw.samples)*2)
+		copy(raw, in[:frames*frameSize])
+		mp3, err := lw.encode(frames)
+		if err != nil {
+			return consumed(), err
+		}
+		in = in[frames*frameSize:]
+		encoded += frames * frameSize
+		if _, err := lw.w.Write(mp3); err != nil {
+			return consumed(), err
+		}
+	}
+	lw.pending = append([]byte(nil), in...)
+	return len(p), nil
+}
+
+// encode passes the first frames sample frames of lw.samples to LAME and
+// returns the mp3 data it produced, which stays valid until the next call
+func (lw *Writer) encode(frames int) ([]byte, error) {
+	pcm := (*C.short)(unsafe.Pointer(&lw.samples[0]))
+	out := (*C.uchar)(unsafe.Pointer(&lw.out[0]))
+	var n C.int
+	if lw.channels == 1 {
+		n = C.lame_encode_buffer(lw.gfp, pcm, nil, C.int(frames), out, C.int(len(lw.out)))
+	} else {
+		n = C.lame_encode_buffer_interleaved(lw.gfp, pcm, C.int(frames), out, C.int(len(lw.out)))
+	}
+	if n < 0 {
+		return nil, encodeError(n)
+	}
+	return lw.out[:n], nil
+}
+
+// Close flushes the encoder and frees it. If the underlying writer is an
+// io.WriteSeeker, the LAME/Xing header at the start of the stream is updated
+// with the final length, so decoders can play the result gaplessly. It does
+// not close the underlying writer.
+func (lw *Writer) Close() error {
+	if lw.gfp == nil {
+		return nil
+	}
+	defer func() {
+		C.lame_close(lw.gfp)
+		lw.gfp = nil
+	}()
+	n := C.lame_encode_flush(lw.gfp, (*C.uchar)(unsafe.Pointer(&lw.out[0])), C.int(len(lw.out)))
+	if n < 0 {
+		return encodeError(n)
+	}
+	if _, err := lw.w.Write(lw.out[:n]); err != nil {
+		return err
+	}
+	ws, ok := lw.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	tag := C.lame_get_lametag_frame(lw.gfp, (*C.uchar)(unsafe.Pointer(&lw.out[0])), C.size_t(len(lw.out)))
+	if tag == 0 || int(tag) > len(lw.out) {
+		return nil
+	}
+	if _, err := ws.Seek(0, io.SeekStart); err != nil {
+		// not actually seekable (e.g. a pipe), leave the initial header
+		return nil
+	}
+	if _, err := ws.Write(lw.out[:tag]); err != nil {
+		return err
+	}
+	_, err := ws.Seek(0, io.SeekEnd)
+	return err
+}
+
+// encodeError describes a negative return value of the encode calls
+func encodeError(code C.int) error {
+	switch code {
+	case -1:
+		return fmt.Errorf("lame error: mp3 buffer too small")
+	case -2:
+		return fmt.Errorf("lame error: out of memory")
+	case -3:
+		return fmt.Errorf("lame error: encoder not initialized")
+	case -4:
+		return fmt.Errorf("lame error: psychoacoustic model problem")
+	}
+	return fmt.Errorf("lame error: code %d", int(code))
+}
+
+// Version returns the version of libmp3lame, e.g. 3.100
+func Version() string {
+	return C.GoString(C.get_lame_version())
+}
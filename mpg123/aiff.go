@@ -0,0 +1,122 @@
+// aiff.go contains a writer for AIFF files holding decoded audio
+
+package mpg123
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+const aiffHeaderSize = 54
+
+// AIFFWriter writes PCM audio as an AIFF file. Samples are expected in the
+// byte order produced by the decoder and are stored big endian. AIFF holds
+// signed integer samples only, so the encoding must be one of ENC_SIGNED_8,
+// ENC_SIGNED_16, ENC_SIGNED_24 or ENC_SIGNED_32.
+type AIFFWriter struct {
+	w          io.Writer
+	rate       int
+	channels   int
+	sampleSize int
+	written    int64
+	swap       bool
+}
+
+// NewAIFFWriter writes an AIFF header for the given format to w and returns a
+// writer for the audio data. As with NewWAVWriter, the sizes in the header are
+// only fixed up on Close if w is an io.WriteSeeker.
+func NewAIFFWriter(w io.Writer, rate int, channels int, encoding int) (*AIFFWriter, error) {
+	switch encoding {
+	case ENC_SIGNED_8, ENC_SIGNED_16, ENC_SIGNED_24, ENC_SIGNED_32:
+	default:
+		return nil, fmt.Errorf("mpg123 error: encoding %v cannot be stored in AIFF", Encoding(encoding))
+	}
+	size := GetEncodingBitsPerSample(encoding) / 8
+	aw := &AIFFWriter{
+		w:          w,
+		rate:       rate,
+		channels:   channels,
+		sampleSize: size,
+		swap:       nativeEndian != binary.BigEndian && size > 1,
+	}
+	if err := aw.writeHeader(0xffffffff - aiffHeaderSize); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+func (aw *AIFFWriter) writeHeader(dataSize uint32) error {
+	var h [aiffHeaderSize]byte
+	be := binary.BigEndian
+	pad := dataSize & 1
+	copy(h[0:], "FORM")
+	be.PutUint32(h[4:], dataSize+pad+aiffHeaderSize-8)
+	copy(h[8:], "AIFFCOMM")
+	be.PutUint32(h[16:], 18)
+	be.PutUint16(h[20:], uint16(aw.channels))
+	be.PutUint32(h[22:], dataSize/uint32(aw.channels*aw.sampleSize))
+	be.PutUint16(h[26:], uint16(aw.sampleSize*8))
+	putExtended(h[28:38], uint64(aw.rate))
+	copy(h[38:], "SSND")
+	be.PutUint32(h[42:], dataSize+8)
+	// offset and block size stay 0
+	_, err := aw.w.Write(h[:])
+	return err
+}
+
+// putExtended stores v as the 80 bit IEEE extended float AIFF uses for the
+// sample rate
+func putExtended(b []byte, v uint64) {
+	if v == 0 {
+		return
+	}
+	shift := 64 - bits.Len64(v)
+	binary.BigEndian.PutUint16(b, uint16(16383+63-shift))
+	binary.BigEndian.PutUint64(b[2:], v<<shift)
+}
+
+// Write appends audio data to the file.
+func (aw *AIFFWriter) Write(p []byte) (int, error) {
+	data := p
+	if aw.swap {
+		data = make([]byte, len(p))
+		copy(data, p)
+		swapSamples(data, aw.sampleSize)
+	}
+	n, err := aw.w.Write(data)
+	aw.written += int64(n)
+	return n, err
+}
+
+// Close pads the sound data to an even length and fixes up the header sizes
+// if the underlying writer is seekable. It does not close the underlying
+// writer.
+func (aw *AIFFWriter) Close() error {
+	if aw.written&1 != 0 {
+		if _, err := aw.w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	ws, ok := aw.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	if _, err := ws.Seek(0, io.SeekStart); err != nil {
+		// not actually seekable (e.g. a pipe), leave the streaming header
+		return nil
+	}
+	if err := aw.writeHeader(uint32(aw.written)); err != nil {
+		return err
+	}
+	_, err := ws.Seek(0, io.SeekEnd)
+	return err
+}
+
+// SetByteOrder sets the byte order of the samples passed to Write, which
+// defaults to the host byte order (see Decoder.ByteOrder). Samples are
+// converted to the big endian order of AIFF files as needed.
+func (aw *AIFFWriter) SetByteOrder(order binary.ByteOrder) {
+	aw.swap = order != binary.BigEndian && aw.sampleSize > 1
+}
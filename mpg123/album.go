@@ -0,0 +1,92 @@
+// album.go contains gapless decoding of consecutive album tracks into one
+// continuous PCM stream
+
+package mpg123
+
+import (
+	"fmt"
+	"io"
+)
+
+// AlbumTrack reports how one file of an album was decoded
+type AlbumTrack struct {
+	File    string
+	Delay   int64 // encoder delay removed from the start, from the LAME tag
+	Padding int64 // encoder padding removed from the end, from the LAME tag
+	Samples int64 // PCM frames written for this file
+}
+
+// DecodeAlbum decodes files one after the other into w with gapless
+// decoding enabled, so the encoder delay and padding recorded in each file's
+// LAME tag are removed and the tracks join without gaps or clicks. All files
+// are decoded to the format of the first one (adjusted by opts); only tracks
+// of another sample rate are resampled to it, which needs
+// FEATURE_DECODE_NTOM. For files whose length is known exactly, the number
+// of samples written is checked against it.
+func DecodeAlbum(w io.Writer, files []string, opts ConvertOptions) ([]AlbumTrack, error) {
+	opts.Gapless = true
+	var tracks []AlbumTrack
+	albumRate := 0
+	for i, file := range files {
+		track, rate, channels, err := decodeAlbumTrack(w, file, opts, albumRate)
+		if err != nil {
+			return tracks, fmt.Errorf("%s: %w", file, err)
+		}
+		if i == 0 {
+			// pin the remaining tracks to the format of the first
+			albumRate, opts.Rate, opts.Channels = rate, 0, channels
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// decodeAlbumTrack decodes one file of an album into w. A track after the
+// first is decoded at albumRate, the rate of the first track, and is only
+// resampled when its own rate differs; albumRate is 0 for the first track.
+func decodeAlbumTrack(w io.Writer, file string, opts ConvertOptions, albumRate int) (AlbumTrack, int, int, error) {
+	track := AlbumTrack{File: file}
+	d, err := NewDecoder("")
+	if err != nil {
+		return track, 0, 0, err
+	}
+	defer d.Delete()
+	if err := d.SetOutput(opts); err != nil {
+		return track, 0, 0, err
+	}
+	if err := d.Open(file); err != nil {
+		return track, 0, 0, err
+	}
+	defer d.Close()
+
+	rate, channels, encoding := d.GetFormat()
+	if albumRate > 0 && rate != albumRate {
+		// FORCE_RATE only applies to a stream opened after it was set
+		d.Close()
+		opts.Rate = albumRate
+		if err := d.SetOutput(opts); err != nil {
+			return track, 0, 0, err
+		}
+		if err := d.Open(file); err != nil {
+			return track, 0, 0, err
+		}
+		rate, channels, encoding = d.GetFormat()
+	}
+	track.Delay, _, _ = d.State(ENC_DELAY)
+	track.Padding, _, _ = d.State(ENC_PADDING)
+	accurate, _, _ := d.State(ACCURATE)
+	expected := d.LengthInPCMFrames()
+
+	n, err := d.WriteTo(w)
+	frameSize := int64(Format{rate, channels, encoding}.BytesPerFrame())
+	if frameSize > 0 {
+		track.Samples = n / frameSize
+	}
+	if err != nil {
+		return track, rate, channels, err
+	}
+	if accurate != 0 && expected > 0 && track.Samples != expected {
+		return track, rate, channels, fmt.Errorf("decoded %d samples, LAME tag promises %d", track.Samples, expected)
+	}
+	return track, rate, channels, nil
+}
@@ -0,0 +1,130 @@
+package mpg123
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// silentFrameAt is silentFrame at 44100 or 48000 Hz
+func silentFrameAt(rate int) []byte {
+	frame := silentFrame()
+	if rate == 48000 {
+		// 128 kbit/s frames are 384 bytes at 48 kHz
+		frame = frame[:384]
+		frame[2] = 0x94
+	}
+	return frame
+}
+
+// lameTrack returns an mp3 of frames silent frames at rate, led by an Info
+// frame whose LAME tag records delay and padding, as LAME writes for CBR
+func lameTrack(rate, frames, delay, padding int) []byte {
+	info := silentFrameAt(rate)
+	copy(info[36:], "Info")
+	binary.BigEndian.PutUint32(info[40:], 0x0f) // frames, bytes, TOC and quality
+	binary.BigEndian.PutUint32(info[44:], uint32(frames))
+	binary.BigEndian.PutUint32(info[48:], uint32((frames+1)*len(info)))
+	for i := 0; i < 100; i++ {
+		info[52+i] = byte(i * 256 / 100)
+	}
+	copy(info[156:], "LAME3.100")
+	info[177] = byte(delay >> 4)
+	info[178] = byte(delay<<4 | padding>>8)
+	info[179] = byte(padding)
+	return append(info, bytes.Repeat(silentFrameAt(rate), frames)...)
+}
+
+type albumTrack struct {
+	rate, frames, delay, padding int
+}
+
+// writeAlbum writes the tracks to files in a temporary directory
+func writeAlbum(t *testing.T, tracks []albumTrack) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var files []string
+	for i, tr := range tracks {
+		file := filepath.Join(dir, string(rune('a'+i))+".mp3")
+		if err := os.WriteFile(file, lameTrack(tr.rate, tr.frames, tr.delay, tr.padding), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// TestDecodeAlbum decodes albums laid out like the usual gapless test sets,
+// one signal cut into tracks encoded with LAME's delay of 576 samples and
+// the padding that fills the last frame, and checks that exactly the
+// samples between delay and padding of each track are written
+func TestDecodeAlbum(t *testing.T) {
+	newTestDecoder(t)
+	for _, test := range []struct {
+		name   string
+		tracks []albumTrack
+	}{
+		{"one track", []albumTrack{{44100, 40, 576, 1080}}},
+		{"same rate", []albumTrack{
+			{44100, 40, 576, 1080},
+			{44100, 25, 576, 383},
+			{44100, 61, 576, 1727},
+		}},
+		{"48 kHz", []albumTrack{
+			{48000, 30, 576, 1200},
+			{48000, 30, 576, 600},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			tracks, err := DecodeAlbum(&out, writeAlbum(t, test.tracks), ConvertOptions{})
+			if err != nil {
+				t.Fatalf("DecodeAlbum: %v", err)
+			}
+			var total int64
+			for i, tr := range test.tracks {
+				want := int64(tr.frames*1152 - tr.delay - tr.padding)
+				got := tracks[i]
+				if got.Delay != int64(tr.delay) || got.Padding != int64(tr.padding) {
+					t.Errorf("track %d: delay %d, padding %d, want %d, %d", i, got.Delay, got.Padding, tr.delay, tr.padding)
+				}
+				if got.Samples != want {
+					t.Errorf("track %d: %d samples, want %d", i, got.Samples, want)
+				}
+				total += want
+			}
+			if int64(out.Len()) != total*4 {
+				t.Errorf("wrote %d bytes, want %d", out.Len(), total*4)
+			}
+		})
+	}
+}
+
+// TestDecodeAlbumMixedRates checks that only the tracks whose rate differs
+// from the first are resampled to it
+func TestDecodeAlbumMixedRates(t *testing.T) {
+	newTestDecoder(t)
+	if !HasFeature(FEATURE_DECODE_NTOM) {
+		t.Skip("libmpg123 cannot resample")
+	}
+	album := []albumTrack{
+		{44100, 40, 576, 1080},
+		{48000, 40, 576, 1080},
+		{44100, 40, 576, 1080},
+	}
+	var out bytes.Buffer
+	tracks, err := DecodeAlbum(&out, writeAlbum(t, album), ConvertOptions{})
+	if err != nil {
+		t.Fatalf("DecodeAlbum: %v", err)
+	}
+	native := int64(40*1152 - 576 - 1080)
+	if tracks[0].Samples != native || tracks[2].Samples != native {
+		t.Errorf("44.1 kHz tracks: %d and %d samples, want %d", tracks[0].Samples, tracks[2].Samples, native)
+	}
+	// NtoM resampling may be off by a sample or so at the ends
+	if want := native * 44100 / 48000; tracks[1].Samples < want-2 || tracks[1].Samples > want+2 {
+		t.Errorf("48 kHz track: %d samples, want about %d", tracks[1].Samples, want)
+	}
+}
@@ -0,0 +1,119 @@
+// bitrate.go contains BitrateInfo, the bitrate figures a player shows: the
+// bitrate mode of the stream and its average bitrate, with where that
+// average comes from
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"math"
+	"unsafe"
+)
+
+// BitrateSource tells where the average of a BitrateInfo comes from
+type BitrateSource int
+
+const (
+	// BitrateFromHeader is the bitrate in the header of the current frame,
+	// exact for constant bitrate streams
+	BitrateFromHeader BitrateSource = iota
+	// BitrateFromTag is the target bitrate of an ABR stream recorded in its
+	// LAME tag
+	BitrateFromTag
+	// BitrateMeasured is the input bytes over the playing time of the
+	// frames parsed so far, the whole stream after Scan
+	BitrateMeasured
+)
+
+func (s BitrateSource) String() string {
+	switch s {
+	case BitrateFromHeader:
+		return "header"
+	case BitrateFromTag:
+		return "tag"
+	case BitrateMeasured:
+		return "measured"
+	}
+	return "unknown"
+}
+
+// BitrateInfo describes the bitrate of a stream
+type BitrateInfo struct {
+	Mode     VBRMode
+	Nominal  int // kbit/s: the bitrate of a CBR stream, the target of an ABR stream, 0 for VBR
+	Average  int // kbit/s
+	Source   BitrateSource
+	Complete bool // Average holds for the whole stream
+}
+
+// cbrTolerance is the relative difference between the measured and header
+// bitrates beyond which a stream reported as CBR is taken to be VBR
+const cbrTolerance = 0.02
+
+// BitrateInfo returns the bitrate mode and average bitrate of the opened
+// stream. The mode comes from the Xing/Info and LAME tags as libmpg123
+// reads them; a stream without tags is reported CBR until its measured
+// average departs from its header bitrate, as happens for VBR files lacking
+// a Xing header. VBR averages are measured over the frames parsed so far;
+// call Scan first for the figure of the whole stream.
+func (d *Decoder) BitrateInfo() (BitrateInfo, error) {
+	fi, err := d.FrameInfo()
+	if err != nil {
+		return BitrateInfo{}, err
+	}
+	info := BitrateInfo{Mode: fi.VBR, Average: fi.Bitrate, Source: BitrateFromHeader}
+	switch fi.VBR {
+	case CBR:
+		info.Nominal = fi.Bitrate
+		info.Complete = true
+	case ABR:
+		info.Nominal = fi.ABRRate
+		info.Average, info.Source = fi.ABRRate, BitrateFromTag
+	}
+	measured, complete, ok := d.measuredBitrate()
+	if !ok {
+		return info, nil
+	}
+	if fi.VBR == CBR {
+		if math.Abs(measured-float64(fi.Bitrate)) <= cbrTolerance*float64(fi.Bitrate) {
+			return info, nil
+		}
+		info.Mode, info.Nominal = VBR, 0
+	}
+	info.Average = int(math.Round(measured))
+	info.Source = BitrateMeasured
+	info.Complete = complete
+	return info, nil
+}
+
+// measuredBitrate returns the average bitrate in kbit/s of the frames in
+// the decoder's frame index, and whether the index covers the whole stream
+func (d *Decoder) measuredBitrate() (kbps float64, complete bool, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0, false, false
+	}
+	var offsets *C.off_t
+	var step C.off_t
+	var fill C.size_t
+	if C.mpg123_index(d.handle, &offsets, &step, &fill) != C.MPG123_OK || fill < 2 || step <= 0 {
+		return 0, false, false
+	}
+	index := unsafe.Slice(offsets, int(fill))
+	frames := int64(fill-1) * int64(step)
+	bytes := int64(index[fill-1] - index[0])
+	tpf := float64(C.mpg123_tpf(d.handle))
+	if bytes <= 0 || tpf <= 0 {
+		return 0, false, false
+	}
+	kbps = float64(bytes) * 8 / (float64(frames) * tpf) / 1000
+	// the index holds every step-th frame, so up to step frames are left
+	// over at the end
+	total := int64(C.mpg123_framelength(d.handle))
+	accurate, _, _ := d.state(ACCURATE)
+	complete = accurate != 0 && total > 0 && frames+int64(step) >= total
+	return kbps, complete, true
+}
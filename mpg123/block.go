@@ -0,0 +1,37 @@
+// block.go contains reading of decoded audio in blocks annotated with their
+// position in the stream
+
+package mpg123
+
+import "time"
+
+// Block is a piece of decoded audio together with its exact position in the stream
+type Block struct {
+	Data   []byte        // interleaved PCM data in the current output format
+	Sample int64         // index of the first PCM frame of Data in the stream
+	Frames int           // number of PCM frames in Data
+	Time   time.Duration // start time of Data
+	Frame  int64         // MPEG frame the decoder was at when Data was decoded
+}
+
+// ReadBlock decodes into buf like Read and returns the data as a Block.
+// Block.Data aliases buf. The position accounts for seeks, gapless trimming
+// and forced output rates because it is taken from the decoder itself. With
+// SetDSP it is the source position the processed audio came from.
+func (d *Decoder) ReadBlock(buf []byte) (Block, error) {
+	sample := d.sourceSample()
+	frame := d.TellCurrentFrame()
+	n, err := d.Read(buf)
+	rate, channels, encoding := d.GetFormat()
+	if d.goMono {
+		channels = 1
+	}
+	b := Block{Data: buf[:n], Sample: sample, Frame: frame}
+	if frameSize := (Format{rate, channels, encoding}).BytesPerFrame(); frameSize > 0 {
+		b.Frames = n / frameSize
+	}
+	if rate > 0 {
+		b.Time = time.Duration(sample) * time.Second / time.Duration(rate)
+	}
+	return b, err
+}
@@ -0,0 +1,72 @@
+package mpg123
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestEmptyBuffers checks that empty and nil buffers are no-ops, as
+// io.Reader allows, instead of panicking on &buf[0]
+func TestEmptyBuffers(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		buf  []byte
+	}{
+		{"nil", nil},
+		{"empty", []byte{}},
+		{"zero length slice of a buffer", make([]byte, 16)[:0]},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := openSilence(t, 10)
+			if n, err := d.Read(test.buf); n != 0 || err != nil {
+				t.Errorf("Read: got %d, %v, want 0, nil", n, err)
+			}
+			if n, err := d.ReadAudioFrames(4, test.buf); n != 0 || err != nil {
+				t.Errorf("ReadAudioFrames: got %d, %v, want 0, nil", n, err)
+			}
+			// the empty reads left the stream where it was
+			if pos := d.TellCurrentSample(); pos != 0 {
+				t.Errorf("position after empty reads: %d", pos)
+			}
+
+			f := newTestDecoder(t)
+			if err := f.OpenFeed(); err != nil {
+				t.Fatalf("OpenFeed: %v", err)
+			}
+			if err := f.Feed(test.buf); err != nil {
+				t.Errorf("Feed: %v", err)
+			}
+			if out, err := f.Decode(test.buf); len(out) != 0 || err != nil {
+				t.Errorf("Decode with no input or pending output: got %d bytes, %v", len(out), err)
+			}
+
+			r := newTestDecoder(t)
+			if err := r.OpenFeed(); err != nil {
+				t.Fatalf("OpenFeed: %v", err)
+			}
+			dr := r.FeedReader(bytes.NewReader(silentMP3(10)), Format{Rate: 44100, Channels: STEREO, Encoding: ENC_SIGNED_16})
+			if n, err := dr.Read(test.buf); n != 0 || err != nil {
+				t.Errorf("DecoderReader.Read: got %d, %v, want 0, nil", n, err)
+			}
+		})
+	}
+}
+
+// TestDecodePending checks that Decode with an empty buffer still returns
+// the output pending in the decoder
+func TestDecodePending(t *testing.T) {
+	d := newTestDecoder(t)
+	if err := d.OpenFeed(); err != nil {
+		t.Fatalf("OpenFeed: %v", err)
+	}
+	if err := d.Feed(silentMP3(5)); err != nil {
+		t.Fatalf("Feed: %v", err)
+	}
+	out, err := d.Decode(nil)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(out) == 0 {
+		t.Error("Decode(nil) returned none of the fed audio")
+	}
+}
@@ -0,0 +1,118 @@
+// chain.go contains the detection of chained streams in feed mode: mp3 files
+// concatenated back to back, as in recorded radio dumps and joined uploads.
+// libmpg123 decodes through the joins on its own; the fed input is scanned
+// for the ID3v2 tag or Xing/Info header starting each file, so the decoder
+// can report when the output reaches the next one.
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+// chainLookahead is how many bytes a stream start candidate needs to be
+// recognized: an ID3v2 header, or a frame header up to its VBRI fields
+const chainLookahead = 4 + 32 + 18
+
+// chainState tracks the stream starts found in the fed input
+type chainState struct {
+	fed     int64   // input bytes fed so far
+	tail    []byte  // end of the input not scanned yet, kept for the next feed
+	starts  []int64 // input offsets of stream starts not reached yet
+	started bool    // audio was decoded since the input was opened
+	track   int     // number of the current track, counting from 0
+}
+
+// SetChained turns the detection of chained streams on or off. With it on,
+// the input passed to Feed, Decode or a DecoderReader is watched for the
+// start of another mp3 file, and an EventTrack is sent when decoding reaches
+// it, with the tags of the new file if it has any. Decoding just continues
+// across the join either way; a rate change shows up as an
+// EventFormatChange. It only applies to feed mode and takes effect for the
+// input fed after the call.
+func (d *Decoder) SetChained(on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !on {
+		d.chain = nil
+	} else if d.chain == nil {
+		d.chain = &chainState{}
+	}
+}
+
+// Track returns the number of the track being decoded from chained streams,
+// counting from 0. It stays 0 unless SetChained is on.
+func (d *Decoder) Track() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.chain == nil {
+		return 0
+	}
+	return d.chain.track
+}
+
+// chainInput scans fed input for stream starts. It is called with d locked.
+func (d *Decoder) chainInput(buf []byte) {
+	c := d.chain
+	if c == nil {
+		return
+	}
+	b := append(c.tail, buf...)
+	base := c.fed - int64(len(c.tail))
+	c.fed += int64(len(buf))
+	i := 0
+	for ; i+chainLookahead <= len(b); i++ {
+		if isStreamStart(b, i) {
+			c.starts = append(c.starts, base+int64(i))
+		}
+	}
+	c.tail = append([]byte(nil), b[i:]...)
+}
+
+// isStreamStart reports whether b holds an ID3v2 tag header or a Layer III
+// frame with a Xing/Info or VBRI header at pos
+func isStreamStart(b []byte, pos int) bool {
+	if b[pos] == 'I' && b[pos+1] == 'D' && b[pos+2] == '3' {
+		// version 2 to 4 and a syncsafe size
+		return b[pos+3] >= 2 && b[pos+3] <= 4 && b[pos+4] != 0xff &&
+			(b[pos+6]|b[pos+7]|b[pos+8]|b[pos+9])&0x80 == 0
+	}
+	if layer3, ok := mpegHeaderAt(b, pos); !ok || !layer3 {
+		return false
+	}
+	kind, _ := lengthTagAt(b, pos)
+	return kind != ""
+}
+
+// chainOutput checks whether a decode call that produced n bytes reached the
+// next stream and reports it. A tag and an Info header of the same file
+// count once, as do the starts ahead of the first audio. It is called with
+// d locked.
+func (d *Decoder) chainOutput(n int) {
+	c := d.chain
+	if c == nil {
+		return
+	}
+	pos := int64(C.mpg123_framepos(d.handle))
+	next := false
+	for len(c.starts) > 0 && c.starts[0] <= pos {
+		c.starts = c.starts[1:]
+		next = c.started
+	}
+	if n > 0 {
+		c.started = true
+	}
+	if !next {
+		return
+	}
+	c.track++
+	tags := d.tags()
+	d.logger().Info("track started", "track", c.track, "offset", pos, "title", tags.Title)
+	d.emit(Event{Kind: EventTrack, Track: c.track, Tags: &tags})
+}
+
+// reset forgets the input of the previous stream
+func (c *chainState) reset() {
+	if c != nil {
+		*c = chainState{}
+	}
+}
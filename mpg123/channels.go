@@ -0,0 +1,254 @@
+// channels.go contains helpers for splitting interleaved decoder output into
+// per-channel slices and joining them back together
+
+package mpg123
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+)
+
+// Deinterleave splits interleaved PCM data into one slice per channel.
+// sampleSize is the size of a single sample in bytes (see GetEncodingBitsPerSample).
+// A trailing partial frame in buf is ignored.
+func Deinterleave(buf []byte, channels int, sampleSize int) [][]byte {
+	if channels <= 0 || sampleSize <= 0 {
+		return nil
+	}
+	frameSize := channels * sampleSize
+	frames := len(buf) / frameSize
+	planes := make([][]byte, channels)
+	for ch := range planes {
+		planes[ch] = make([]byte, frames*sampleSize)
+	}
+	for i := 0; i < frames; i++ {
+		frame := buf[i*frameSize : (i+1)*frameSize]
+		for ch := range planes {
+			copy(planes[ch][i*sampleSize:], frame[ch*sampleSize:(ch+1)*sampleSize])
+		}
+	}
+	return planes
+}
+
+// Interleave joins per-channel PCM data back into a single interleaved buffer.
+// The output is as long as the shortest plane allows.
+func Interleave(planes [][]byte, sampleSize int) []byte {
+	if len(planes) == 0 || sampleSize <= 0 {
+		return nil
+	}
+	frames := shortestPlane(planes) / sampleSize
+	frameSize := len(planes) * sampleSize
+	buf := make([]byte, frames*frameSize)
+	for i := 0; i < frames; i++ {
+		frame := buf[i*frameSize : (i+1)*frameSize]
+		for ch, plane := range planes {
+			copy(frame[ch*sampleSize:], plane[i*sampleSize:(i+1)*sampleSize])
+		}
+	}
+	return buf
+}
+
+// ExtractChannel returns the samples of a single channel (counting from 0)
+// from interleaved PCM data.
+func ExtractChannel(buf []byte, channels int, sampleSize int, channel int) []byte {
+	if channels <= 0 || sampleSize <= 0 || channel < 0 || channel >= channels {
+		return nil
+	}
+	frameSize := channels * sampleSize
+	frames := len(buf) / frameSize
+	out := make([]byte, frames*sampleSize)
+	for i := 0; i < frames; i++ {
+		off := i*frameSize + channel*sampleSize
+		copy(out[i*sampleSize:], buf[off:off+sampleSize])
+	}
+	return out
+}
+
+// DeinterleaveInt16 splits interleaved 16 bit samples into one slice per channel.
+func DeinterleaveInt16(samples []int16, channels int) [][]int16 {
+	return deinterleave(samples, channels)
+}
+
+// InterleaveInt16 joins per-channel 16 bit samples into a single interleaved slice.
+func InterleaveInt16(planes [][]int16) []int16 {
+	return interleave(planes)
+}
+
+// ExtractChannelInt16 returns the 16 bit samples of a single channel.
+func ExtractChannelInt16(samples []int16, channels int, channel int) []int16 {
+	return extractChannel(samples, channels, channel)
+}
+
+// DeinterleaveFloat32 splits interleaved float samples into one slice per channel.
+func DeinterleaveFloat32(samples []float32, channels int) [][]float32 {
+	return deinterleave(samples, channels)
+}
+
+// InterleaveFloat32 joins per-channel float samples into a single interleaved slice.
+func InterleaveFloat32(planes [][]float32) []float32 {
+	return interleave(planes)
+}
+
+// ExtractChannelFloat32 returns the float samples of a single channel.
+func ExtractChannelFloat32(samples []float32, channels int, channel int) []float32 {
+	return extractChannel(samples, channels, channel)
+}
+
+// BytesToInt16 copies decoder output in ENC_SIGNED_16 (native byte order)
+// into a slice of samples.
+func BytesToInt16(buf []byte) []int16 {
+	return fromBytes[int16](buf)
+}
+
+// Int16ToBytes copies 16 bit samples into a byte slice in native byte order.
+func Int16ToBytes(samples []int16) []byte {
+	return toBytes(samples)
+}
+
+// BytesToFloat32 copies decoder output in ENC_FLOAT_32 (native byte order)
+// into a slice of samples.
+func BytesToFloat32(buf []byte) []float32 {
+	return fromBytes[float32](buf)
+}
+
+// Float32ToBytes copies float samples into a byte slice in native byte order.
+func Float32ToBytes(samples []float32) []byte {
+	return toBytes(samples)
+}
+
+func fromBytes[T int16 | float32](buf []byte) []T {
+	var zero T
+	size := int(unsafe.Sizeof(zero))
+	out := make([]T, len(buf)/size)
+	if len(out) > 0 {
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(&out[0])), len(out)*size), buf)
+	}
+	return out
+}
+
+func toBytes[T int16 | float32](samples []T) []byte {
+	if len(samples) == 0 {
+		return nil
+	}
+	size := int(unsafe.Sizeof(samples[0]))
+	out := make([]byte, len(samples)*size)
+	copy(out, unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(out)))
+	return out
+}
+
+func deinterleave[T any](samples []T, channels int) [][]T {
+	if channels <= 0 {
+		return nil
+	}
+	frames := len(samples) / channels
+	planes := make([][]T, channels)
+	for ch := range planes {
+		planes[ch] = make([]T, frames)
+	}
+	for i := 0; i < frames; i++ {
+		for ch := range planes {
+			planes[ch][i] = samples[i*channels+ch]
+		}
+	}
+	return planes
+}
+
+func interleave[T any](planes [][]T) []T {
+	if len(planes) == 0 {
+		return nil
+	}
+	frames := len(planes[0])
+	for _, plane := range planes[1:] {
+		if len(plane) < frames {
+			frames = len(plane)
+		}
+	}
+	channels := len(planes)
+	samples := make([]T, frames*channels)
+	for i := 0; i < frames; i++ {
+		for ch, plane := range planes {
+			samples[i*channels+ch] = plane[i]
+		}
+	}
+	return samples
+}
+
+func extractChannel[T any](samples []T, channels int, channel int) []T {
+	if channels <= 0 || channel < 0 || channel >= channels {
+		return nil
+	}
+	out := make([]T, len(samples)/channels)
+	for i := range out {
+		out[i] = samples[i*channels+channel]
+	}
+	return out
+}
+
+func shortestPlane(planes [][]byte) int {
+	n := len(planes[0])
+	for _, plane := range planes[1:] {
+		if len(plane) < n {
+			n = len(plane)
+		}
+	}
+	return n
+}
+
+// DeinterleaveFloat64 converts interleaved PCM data in the given encoding to
+// one slice of samples per channel, scaled to [-1, 1) like float output. This
+// is the layout most Go DSP and analysis code expects. The encodings of
+// NewConverter are supported, in host byte order.
+func DeinterleaveFloat64(buf []byte, channels int, encoding int) ([][]float64, error) {
+	return deinterleaveFloat(buf, channels, encoding, nativeEndian)
+}
+
+// deinterleaveFloat splits buf, with samples in the given byte order, into planes
+func deinterleaveFloat(buf []byte, channels int, encoding int, order binary.ByteOrder) ([][]float64, error) {
+	codec, err := codecFor(encoding, order)
+	if err != nil {
+		return nil, err
+	}
+	if channels <= 0 {
+		return nil, fmt.Errorf("mpg123 error: invalid channel count %d", channels)
+	}
+	frameSize := channels * codec.size
+	frames := len(buf) / frameSize
+	planes := make([][]float64, channels)
+	for ch := range planes {
+		planes[ch] = make([]float64, frames)
+	}
+	for i := 0; i < frames; i++ {
+		frame := buf[i*frameSize:]
+		for ch, plane := range planes {
+			plane[i] = codec.get(frame[ch*codec.size:])
+		}
+	}
+	return planes, nil
+}
+
+// ReadFloat64 decodes up to frames PCM frames like Read and returns them as
+// one slice per channel, see DeinterleaveFloat64. The output encoding must be
+// one DeinterleaveFloat64 supports; ENC_FLOAT_64 avoids any loss. At the end
+// of the stream the planes hold the last frames and the error is EOF.
+func (d *Decoder) ReadFloat64(frames int) ([][]float64, error) {
+	if frames < 0 {
+		return nil, fmt.Errorf("mpg123 error: negative frame count %d", frames)
+	}
+	f, err := d.currentFormat()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, frames*f.BytesPerFrame())
+	n, err := d.Read(buf)
+	// the data is in the format after the read, which may have changed
+	out, ferr := d.readFormat()
+	if ferr != nil {
+		return nil, ferr
+	}
+	planes, cerr := deinterleaveFloat(buf[:n], out.Channels, out.Encoding, d.ByteOrder())
+	if cerr != nil {
+		return nil, cerr
+	}
+	return planes, err
+}
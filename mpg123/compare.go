@@ -0,0 +1,111 @@
+// compare.go decodes the same data with each decoder engine and compares the
+// results, to catch output differences between the optimized (SIMD) engines
+
+package mpg123
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// DecoderDiff describes how the output of one decoder engine differs from
+// the reference engine
+type DecoderDiff struct {
+	Decoder    string
+	Samples    int64   // samples decoded, over all channels
+	Reference  int64   // samples decoded by the reference engine
+	MaxDiff    int     // largest absolute difference in 16 bit LSB
+	RMSDiff    float64 // root mean square difference in 16 bit LSB
+	FirstIndex int64   // index of the first sample over tolerance, -1 if none
+	Err        error   // decoding error, if any
+}
+
+// OK reports whether the engine decoded the same number of samples as the
+// reference, with no sample differing by more than tolerance LSB
+func (d DecoderDiff) OK(tolerance int) bool {
+	return d.Err == nil && d.Samples == d.Reference && d.MaxDiff <= tolerance
+}
+
+func (d DecoderDiff) String() string {
+	if d.Err != nil {
+		return fmt.Sprintf("%s: %v", d.Decoder, d.Err)
+	}
+	return fmt.Sprintf("%s: %d/%d samples, max diff %d, rms %.3f", d.Decoder, d.Samples, d.Reference, d.MaxDiff, d.RMSDiff)
+}
+
+// CompareDecoders decodes data to 16 bit PCM with the reference engine and
+// every other engine in decoders (all of SupportedDecoders if nil), and
+// returns one DecoderDiff per other engine. Differences of one or two LSB
+// are normal between engines because of rounding; FirstIndex marks the
+// first sample differing by more than tolerance.
+func CompareDecoders(data []byte, reference string, decoders []string, tolerance int) ([]DecoderDiff, error) {
+	if decoders == nil {
+		decoders = SupportedDecoders()
+	}
+	ref, err := decodeWith(data, reference)
+	if err != nil {
+		return nil, fmt.Errorf("reference decoder %s: %w", reference, err)
+	}
+	var diffs []DecoderDiff
+	for _, name := range decoders {
+		if name == reference {
+			continue
+		}
+		diff := DecoderDiff{Decoder: name, Reference: int64(len(ref)), FirstIndex: -1}
+		out, err := decodeWith(data, name)
+		if err != nil {
+			diff.Err = err
+			diffs = append(diffs, diff)
+			continue
+		}
+		diff.Samples = int64(len(out))
+		n := len(out)
+		if len(ref) < n {
+			n = len(ref)
+		}
+		var sum float64
+		for i := 0; i < n; i++ {
+			delta := int(out[i]) - int(ref[i])
+			if delta < 0 {
+				delta = -delta
+			}
+			if delta > diff.MaxDiff {
+				diff.MaxDiff = delta
+			}
+			if delta > tolerance && diff.FirstIndex < 0 {
+				diff.FirstIndex = int64(i)
+			}
+			sum += float64(delta * delta)
+		}
+		if n > 0 {
+			diff.RMSDiff = math.Sqrt(sum / float64(n))
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// decodeWith decodes data with the named engine to 16 bit samples
+func decodeWith(data []byte, decoder string) ([]int16, error) {
+	d, err := NewDecoder(decoder)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Delete()
+	if err := d.SetOutput(ConvertOptions{Encoding: ENC_SIGNED_16}); err != nil {
+		return nil, err
+	}
+	if err := d.OpenReader(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	if current := d.CurrentDecoder(); decoder != "" && current != decoder {
+		return nil, fmt.Errorf("mpg123 error: asked for decoder %s, got %s", decoder, current)
+	}
+	var pcm bytes.Buffer
+	if _, err := d.WriteTo(&pcm); err != nil {
+		return nil, err
+	}
+	return BytesToInt16(pcm.Bytes()), nil
+}
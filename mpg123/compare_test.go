@@ -0,0 +1,58 @@
+package mpg123
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecoderDiffOK(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		diff DecoderDiff
+		want bool
+	}{
+		{"identical", DecoderDiff{Samples: 100, Reference: 100, FirstIndex: -1}, true},
+		{"rounding", DecoderDiff{Samples: 100, Reference: 100, MaxDiff: 2, FirstIndex: -1}, true},
+		{"over tolerance", DecoderDiff{Samples: 100, Reference: 100, MaxDiff: 3, FirstIndex: 17}, false},
+		{"short", DecoderDiff{Samples: 99, Reference: 100, FirstIndex: -1}, false},
+		{"failed", DecoderDiff{Err: errors.New("no such decoder"), FirstIndex: -1}, false},
+	} {
+		if got := test.diff.OK(2); got != test.want {
+			t.Errorf("%s: OK(2) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// TestCompareDecoders runs the consistency check over every engine of the
+// library, as mp3bench -check does
+func TestCompareDecoders(t *testing.T) {
+	newTestDecoder(t)
+	decoders := SupportedDecoders()
+	if len(decoders) == 0 {
+		t.Skip("libmpg123 lists no decoders")
+	}
+	diffs, err := CompareDecoders(silentMP3(50), decoders[0], nil, 2)
+	if err != nil {
+		t.Fatalf("CompareDecoders: %v", err)
+	}
+	if len(diffs) != len(decoders)-1 {
+		t.Errorf("got %d diffs for %d decoders", len(diffs), len(decoders))
+	}
+	for _, diff := range diffs {
+		if !diff.OK(2) {
+			t.Errorf("%v", diff)
+		}
+		if diff.Reference != 50*1152*2 {
+			t.Errorf("%s: reference decoded %d samples, want %d", diff.Decoder, diff.Reference, 50*1152*2)
+		}
+	}
+
+	// an engine that cannot be selected is reported, not fatal
+	diffs, err = CompareDecoders(silentMP3(5), decoders[0], []string{"no-such-engine"}, 2)
+	if err != nil {
+		t.Fatalf("CompareDecoders: %v", err)
+	}
+	if len(diffs) != 1 || diffs[0].Err == nil {
+		t.Errorf("unknown engine: got %v, want an error", diffs)
+	}
+}
@@ -0,0 +1,40 @@
+// compat.h detects what the installed mpg123.h provides and maps anything
+// missing to fallbacks, so the package builds against older libmpg123
+// releases as well as the newest. Every cgo file of the package includes it
+// instead of mpg123.h.
+//
+// The HAVE_* macros are visible to Go as C.HAVE_*.
+
+#ifndef GO_MPG123_COMPAT_H
+#define GO_MPG123_COMPAT_H
+
+// keep enum typed parameters in libmpg123 1.31 and later, matching the
+// prototypes of older versions
+#define MPG123_ENUM_API 1
+#include <mpg123.h>
+
+// flags added in API version 46 (libmpg123 1.28); without them output is
+// always in host byte order
+#if MPG123_API_VERSION >= 46
+#define HAVE_FORCE_ENDIAN 1
+#else
+#define HAVE_FORCE_ENDIAN 0
+#define MPG123_FORCE_ENDIAN 0
+#define MPG123_BIG_ENDIAN 0
+#endif
+
+// raw tag storage, added in API version 45 (libmpg123 1.26); without it no
+// raw tags are kept
+#if MPG123_API_VERSION >= 45
+#define HAVE_ID3_RAW 1
+#else
+#define HAVE_ID3_RAW 0
+#define MPG123_STORE_RAW_ID3 0
+static inline int mpg123_id3_raw(mpg123_handle *mh, unsigned char **v1, size_t *v1_size,
+	unsigned char **v2, size_t *v2_size)
+{
+	return MPG123_ERR;
+}
+#endif
+
+#endif
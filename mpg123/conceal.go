@@ -0,0 +1,159 @@
+// conceal.go contains error concealment: audio standing in for MPEG frames
+// the decoder skipped as damaged, so the output keeps the length of the
+// stream, as broadcast chains expect
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import "math"
+
+// Concealment selects what replaces damaged frames
+type Concealment int
+
+const (
+	ConcealOff     Concealment = iota // leave the gap out, the default
+	ConcealSilence                    // silence
+	ConcealRepeat                     // the audio of the last good frame
+)
+
+// concealState tracks the input to find skipped frames
+type concealState struct {
+	mode   Concealment
+	frame  int64  // MPEG frame number at the last check, -1 before the first
+	pos    int64  // its byte offset in the input
+	bytes  int64  // input bytes of frames decoded without a gap
+	frames int64  // number of those frames, for the mean frame size
+	last   []byte // output of the last MPEG frame, for ConcealRepeat
+	rep    int    // offset in last of the next repeated byte
+	left   int64  // output bytes still to insert
+	count  int64  // frames concealed
+}
+
+// SetConcealment makes Read and DecoderReader.Read insert silence or repeat
+// the last good frame for every frame the decoder skips while resyncing
+// after damaged data. The stand-in audio follows the read that came across
+// the gap. Gaps are found in constant bitrate streams, as broadcast streams
+// are, by comparing the input consumed with the frames decoded; variable
+// bitrate streams are not checked.
+func (d *Decoder) SetConcealment(mode Concealment) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if mode == ConcealOff {
+		d.conceal = nil
+		return
+	}
+	if d.conceal == nil {
+		d.conceal = &concealState{frame: -1}
+	}
+	d.conceal.mode = mode
+}
+
+// Concealed returns the number of MPEG frames concealed since
+// SetConcealment
+func (d *Decoder) Concealed() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conceal == nil {
+		return 0
+	}
+	return d.conceal.count
+}
+
+// resetConceal starts tracking the input afresh after a seek or when a
+// stream is opened. It is called with d locked.
+func (d *Decoder) resetConceal() {
+	if c := d.conceal; c != nil {
+		c.frame, c.bytes, c.frames = -1, 0, 0
+		c.last, c.rep, c.left = nil, 0, 0
+	}
+}
+
+// concealFrameBytes returns the size of the output of one MPEG frame at the
+// input rate inRate, and the size of a PCM frame
+func (d *Decoder) concealFrameBytes(inRate int) (int, int) {
+	rate, channels, enc := d.getFormat()
+	frameSize := (Format{rate, channels, enc}).BytesPerFrame()
+	spf := int(C.mpg123_spf(d.handle))
+	if frameSize <= 0 || spf <= 0 || inRate <= 0 {
+		return 0, 0
+	}
+	return spf * rate / inRate * frameSize, frameSize
+}
+
+// concealCheck looks for frames skipped by the read that decoded out and
+// queues audio for them. It is called with d locked.
+func (d *Decoder) concealCheck(out []byte) {
+	c := d.conceal
+	if c == nil {
+		return
+	}
+	var mi C.struct_mpg123_frameinfo
+	if C.mpg123_info(d.handle, &mi) != C.MPG123_OK || mi.vbr != C.MPG123_CBR || mi.bitrate == 0 {
+		return
+	}
+	frameBytes, frameSize := d.concealFrameBytes(int(mi.rate))
+	if c.mode == ConcealRepeat && frameBytes > 0 {
+		if keep := min(len(out), frameBytes) / frameSize * frameSize; keep > 0 {
+			c.last, c.rep = append(c.last[:0], out[len(out)-keep:]...), 0
+		}
+	}
+	frame := int64(C.mpg123_tellframe(d.handle))
+	pos := int64(C.mpg123_framepos(d.handle))
+	if c.frame < 0 || frame < c.frame || pos < c.pos {
+		c.frame, c.pos = frame, pos
+		return
+	}
+	k, delta := frame-c.frame, pos-c.pos
+	c.frame, c.pos = frame, pos
+	if k == 0 && delta == 0 {
+		return
+	}
+	mean := float64(mi.framesize + 4)
+	if c.frames > 0 {
+		mean = float64(c.bytes) / float64(c.frames)
+	}
+	lost := int64(math.Round(float64(delta)/mean)) - k
+	if lost <= 0 {
+		c.bytes += delta
+		c.frames += k
+		return
+	}
+	c.count += lost
+	c.left += lost * int64(frameBytes)
+	d.logger().Warn("frames concealed", "frames", lost)
+}
+
+// concealPending reports whether stand-in audio waits to be read. It is
+// called with d locked.
+func (d *Decoder) concealPending() bool {
+	return d.conceal != nil && d.conceal.left > 0
+}
+
+// takeConceal writes stand-in audio into buf, in whole frames, and returns
+// its length. It is called with d locked.
+func (d *Decoder) takeConceal(buf []byte) int {
+	c := d.conceal
+	rate, channels, enc := d.getFormat()
+	frameSize := (Format{rate, channels, enc}).BytesPerFrame()
+	codec, err := codecFor(enc, d.byteOrder())
+	if frameSize <= 0 || err != nil {
+		c.left = 0
+		return 0
+	}
+	n := int(min(c.left, int64(len(buf))))
+	n -= n % frameSize
+	if c.mode == ConcealRepeat && len(c.last) >= frameSize {
+		for i := 0; i < n; i++ {
+			buf[i] = c.last[c.rep]
+			c.rep = (c.rep + 1) % len(c.last)
+		}
+	} else {
+		for i := 0; i+codec.size <= n; i += codec.size {
+			codec.put(buf[i:], 0)
+		}
+	}
+	c.left -= int64(n)
+	return n
+}
@@ -0,0 +1,181 @@
+// convert.go contains conversions between the PCM encodings produced by the
+// decoder, with optional TPDF dithering when reducing bit depth
+
+package mpg123
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// sampleCodec reads and writes single samples of one encoding, normalized
+// to the range [-1, 1)
+type sampleCodec struct {
+	size  int
+	bits  int // bits of precision, used to decide on dithering
+	float bool
+	get   func(b []byte) float64
+	put   func(b []byte, v float64)
+}
+
+// codecFor returns the codec for samples of encoding in the given byte order.
+// Every encoding libmpg123 can produce is covered.
+func codecFor(encoding int, order binary.ByteOrder) (*sampleCodec, error) {
+	switch encoding {
+	case ENC_ULAW_8:
+		return &sampleCodec{size: 1, bits: 14,
+			get: func(b []byte) float64 { return float64(ULawToLinear(b[0])) / (1 << 15) },
+			put: func(b []byte, v float64) { b[0] = LinearToULaw(int16(quantize(v, 15))) },
+		}, nil
+	case ENC_ALAW_8:
+		return &sampleCodec{size: 1, bits: 13,
+			get: func(b []byte) float64 { return float64(ALawToLinear(b[0])) / (1 << 15) },
+			put: func(b []byte, v float64) { b[0] = LinearToALaw(int16(quantize(v, 15))) },
+		}, nil
+	case ENC_SIGNED_8:
+		return &sampleCodec{size: 1, bits: 8,
+			get: func(b []byte) float64 { return float64(int8(b[0])) / (1 << 7) },
+			put: func(b []byte, v float64) { b[0] = byte(int8(quantize(v, 7))) },
+		}, nil
+	case ENC_UNSIGNED_8:
+		return &sampleCodec{size: 1, bits: 8,
+			get: func(b []byte) float64 { return float64(int8(b[0]^0x80)) / (1 << 7) },
+			put: func(b []byte, v float64) { b[0] = byte(int8(quantize(v, 7))) ^ 0x80 },
+		}, nil
+	case ENC_SIGNED_16:
+		return &sampleCodec{size: 2, bits: 16,
+			get: func(b []byte) float64 { return float64(int16(order.Uint16(b))) / (1 << 15) },
+			put: func(b []byte, v float64) { order.PutUint16(b, uint16(int16(quantize(v, 15)))) },
+		}, nil
+	case ENC_UNSIGNED_16:
+		return &sampleCodec{size: 2, bits: 16,
+			get: func(b []byte) float64 { return float64(int16(order.Uint16(b)^0x8000)) / (1 << 15) },
+			put: func(b []byte, v float64) { order.PutUint16(b, uint16(int16(quantize(v, 15)))^0x8000) },
+		}, nil
+	case ENC_SIGNED_24:
+		return &sampleCodec{size: 3, bits: 24,
+			get: func(b []byte) float64 { return float64(getInt24(b, order)) / (1 << 23) },
+			put: func(b []byte, v float64) { putInt24(b, order, int32(quantize(v, 23))) },
+		}, nil
+	case ENC_UNSIGNED_24:
+		return &sampleCodec{size: 3, bits: 24,
+			get: func(b []byte) float64 { return float64(getInt24(b, order)^-0x800000) / (1 << 23) },
+			put: func(b []byte, v float64) { putInt24(b, order, int32(quantize(v, 23))^-0x800000) },
+		}, nil
+	case ENC_SIGNED_32:
+		return &sampleCodec{size: 4, bits: 32,
+			get: func(b []byte) float64 { return float64(int32(order.Uint32(b))) / (1 << 31) },
+			put: func(b []byte, v float64) { order.PutUint32(b, uint32(int32(quantize(v, 31)))) },
+		}, nil
+	case ENC_UNSIGNED_32:
+		return &sampleCodec{size: 4, bits: 32,
+			get: func(b []byte) float64 { return float64(int32(order.Uint32(b)^0x80000000)) / (1 << 31) },
+			put: func(b []byte, v float64) { order.PutUint32(b, uint32(int32(quantize(v, 31)))^0x80000000) },
+		}, nil
+	case ENC_FLOAT_32:
+		return &sampleCodec{size: 4, bits: 24, float: true,
+			get: func(b []byte) float64 { return float64(math.Float32frombits(order.Uint32(b))) },
+			put: func(b []byte, v float64) { order.PutUint32(b, math.Float32bits(float32(v))) },
+		}, nil
+	case ENC_FLOAT_64:
+		return &sampleCodec{size: 8, bits: 53, float: true,
+			get: func(b []byte) float64 { return math.Float64frombits(order.Uint64(b)) },
+			put: func(b []byte, v float64) { order.PutUint64(b, math.Float64bits(v)) },
+		}, nil
+	}
+	return nil, fmt.Errorf("mpg123 error: unsupported conversion encoding %v", Encoding(encoding))
+}
+
+// quantize scales a normalized sample to a signed integer with the given
+// number of magnitude bits, rounding and clipping to the valid range
+func quantize(v float64, bits uint) int64 {
+	scale := float64(int64(1) << bits)
+	s := math.Round(v * scale)
+	if s > scale-1 {
+		return int64(scale - 1)
+	}
+	if s < -scale {
+		return int64(-scale)
+	}
+	return int64(s)
+}
+
+func getInt24(b []byte, order binary.ByteOrder) int32 {
+	var u uint32
+	if order == binary.LittleEndian {
+		u = uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+	} else {
+		u = uint32(b[2]) | uint32(b[1])<<8 | uint32(b[0])<<16
+	}
+	return int32(u<<8) >> 8
+}
+
+func putInt24(b []byte, order binary.ByteOrder, v int32) {
+	if order == binary.LittleEndian {
+		b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+	} else {
+		b[2], b[1], b[0] = byte(v), byte(v>>8), byte(v>>16)
+	}
+}
+
+// Converter converts PCM data from one output encoding to another.
+// A Converter is not safe for concurrent use.
+type Converter struct {
+	from, to *sampleCodec
+	dither   bool
+	rng      *rand.Rand
+}
+
+// NewConverter creates a converter between two of the ENC_* output
+// encodings, signed or unsigned, integer, float or companded.
+// With dither set, triangular (TPDF) dither of one LSB is added whenever the
+// target has fewer bits than the source.
+// Samples are in host byte order on both sides, as the decoder produces them.
+func NewConverter(from int, to int, dither bool) (*Converter, error) {
+	return newConverter(from, to, nativeEndian, dither)
+}
+
+// newConverter creates a converter for samples in the given byte order
+func newConverter(from int, to int, order binary.ByteOrder, dither bool) (*Converter, error) {
+	src, err := codecFor(from, order)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := codecFor(to, order)
+	if err != nil {
+		return nil, err
+	}
+	return &Converter{
+		from:   src,
+		to:     dst,
+		dither: dither && !dst.float && dst.bits < src.bits,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Convert converts all whole samples in src and returns the converted data.
+func (c *Converter) Convert(src []byte) []byte {
+	n := len(src) / c.from.size
+	out := make([]byte, n*c.to.size)
+	lsb := math.Ldexp(1, 1-c.to.bits)
+	for i := 0; i < n; i++ {
+		v := c.from.get(src[i*c.from.size : (i+1)*c.from.size])
+		if c.dither {
+			v += (c.rng.Float64() - c.rng.Float64()) * lsb
+		}
+		c.to.put(out[i*c.to.size:(i+1)*c.to.size], v)
+	}
+	return out
+}
+
+// ConvertEncoding converts PCM data between two output encodings, see NewConverter.
+func ConvertEncoding(src []byte, from int, to int, dither bool) ([]byte, error) {
+	c, err := NewConverter(from, to, dither)
+	if err != nil {
+		return nil, err
+	}
+	return c.Convert(src), nil
+}
@@ -0,0 +1,43 @@
+package mpg123
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// TestCrossBuild type checks the package for 32 bit targets and Windows,
+// where long or off_t are narrower than on the usual 64 bit hosts. cgo needs
+// a C cross compiler for each target, named by the CC_<goos>_<goarch>
+// variable or found under its usual name, and the libmpg123 headers in its
+// search path or CGO_CFLAGS; targets without a compiler are skipped.
+func TestCrossBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("cross compiling in short mode")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	for _, target := range []struct{ goos, goarch, cc string }{
+		{"linux", "arm", "arm-linux-gnueabihf-gcc"},
+		{"linux", "386", "i686-linux-gnu-gcc"},
+		{"windows", "386", "i686-w64-mingw32-gcc"},
+		{"windows", "amd64", "x86_64-w64-mingw32-gcc"},
+	} {
+		t.Run(target.goos+"_"+target.goarch, func(t *testing.T) {
+			cc := os.Getenv("CC_" + target.goos + "_" + target.goarch)
+			if cc == "" {
+				cc = target.cc
+			}
+			if _, err := exec.LookPath(cc); err != nil {
+				t.Skipf("no C compiler for %s/%s: %v", target.goos, target.goarch, err)
+			}
+			cmd := exec.Command(gobin, "vet", "-tags", "nopkgconfig", ".")
+			cmd.Env = append(os.Environ(), "GOOS="+target.goos, "GOARCH="+target.goarch, "CGO_ENABLED=1", "CC="+cc)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Errorf("GOOS=%s GOARCH=%s go vet: %v\n%s", target.goos, target.goarch, err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+// cue.go contains splitting of a decoded stream into tracks described by a
+// cue sheet or a list of timestamps
+
+package mpg123
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Track is one entry of a cue sheet or timestamp list
+type Track struct {
+	Number    int
+	Title     string
+	Performer string
+	Start     time.Duration
+}
+
+// ParseCueSheet reads the tracks of a cue sheet, using INDEX 01 as the
+// start of each track. Disc level PERFORMER entries apply to tracks without one.
+func ParseCueSheet(r io.Reader) ([]Track, error) {
+	var tracks []Track
+	var discPerformer string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value := unquote(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(scanner.Text()), fields[0])))
+		var cur *Track
+		if len(tracks) > 0 {
+			cur = &tracks[len(tracks)-1]
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "TRACK":
+			n, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("cue sheet line %d: bad track number %q", line, fields[1])
+			}
+			tracks = append(tracks, Track{Number: n, Performer: discPerformer, Start: -1})
+		case "TITLE":
+			if cur != nil {
+				cur.Title = value
+			}
+		case "PERFORMER":
+			if cur != nil {
+				cur.Performer = value
+			} else {
+				discPerformer = value
+			}
+		case "INDEX":
+			if cur == nil || len(fields) < 3 || fields[1] != "01" {
+				continue
+			}
+			start, err := parseCueTime(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("cue sheet line %d: %v", line, err)
+			}
+			cur.Start = start
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, t := range tracks {
+		if t.Start < 0 {
+			return nil, fmt.Errorf("cue sheet: track %d has no INDEX 01", t.Number)
+		}
+	}
+	return tracks, nil
+}
+
+// parseCueTime parses a cue sheet time of the form mm:ss:ff with 75 frames per second
+func parseCueTime(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("bad cue time %q", s)
+	}
+	var v [3]int64
+	for i, p := range parts {
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad cue time %q", s)
+		}
+		v[i] = n
+	}
+	return time.Duration(v[0])*time.Minute + time.Duration(v[1])*time.Second + time.Duration(v[2])*time.Second/75, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// ParseTimestamps reads a simple track list with one track per line: a start
+// time ("hh:mm:ss", "mm:ss" or seconds, with optional fraction) followed by
+// an optional title. Empty lines and lines starting with # are ignored.
+func ParseTimestamps(r io.Reader) ([]Track, error) {
+	var tracks []Track
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		stamp, title, _ := strings.Cut(text, " ")
+		var seconds float64
+		for _, part := range strings.Split(stamp, ":") {
+			v, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return nil, fmt.Errorf("timestamps line %d: bad time %q", line, stamp)
+			}
+			seconds = seconds*60 + v
+		}
+		tracks = append(tracks, Track{
+			Number: len(tracks) + 1,
+			Title:  strings.TrimSpace(title),
+			Start:  time.Duration(seconds * float64(time.Second)),
+		})
+	}
+	return tracks, scanner.Err()
+}
+
+// Split decodes every track into the writer returned by create, closing it
+// afterwards. Track boundaries are sample accurate and consecutive tracks
+// share no samples; the last track runs to the end of the stream.
+func (d *Decoder) Split(tracks []Track, create func(t Track) (io.WriteCloser, error)) error {
+	if len(tracks) == 0 {
+		return nil
+	}
+	// the exact length is needed for the last track and for exact seeking
+	if err := d.Scan(); err != nil {
+		return err
+	}
+	rate, _, _ := d.GetFormat()
+	if rate <= 0 {
+		return fmt.Errorf("mpg123 error: output format not known yet")
+	}
+	length := time.Duration(d.LengthInPCMFrames()) * time.Second / time.Duration(rate)
+	for i, t := range tracks {
+		end := length
+		if i+1 < len(tracks) {
+			end = tracks[i+1].Start
+		}
+		if end < t.Start {
+			return fmt.Errorf("mpg123 error: track %d starts after the next track", t.Number)
+		}
+		w, err := create(t)
+		if err != nil {
+			return err
+		}
+		if _, err := d.DecodeRange(w, t.Start, end); err != nil {
+			w.Close()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SplitFileToWAV splits the mp3 file src into one WAV file per track, named
+// by the name function.
+func SplitFileToWAV(src string, tracks []Track, name func(t Track) string) error {
+	d, err := NewDecoder("")
+	if err != nil {
+		return err
+	}
+	defer d.Delete()
+	if err := d.Open(src); err != nil {
+		return err
+	}
+	defer d.Close()
+	rate, channels, encoding := d.GetFormat()
+	// keep the format fixed so all tracks match
+	d.FormatNone()
+	d.Format(rate, channels, encoding)
+
+	return d.Split(tracks, func(t Track) (io.WriteCloser, error) {
+		f, err := os.Create(name(t))
+		if err != nil {
+			return nil, err
+		}
+		wav, err := NewWAVWriter(f, rate, channels, encoding)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		wav.SetByteOrder(d.ByteOrder())
+		return &wavFile{WAVWriter: wav, f: f}, nil
+	})
+}
+
+// wavFile closes both the WAV writer and its file
+type wavFile struct {
+	*WAVWriter
+	f *os.File
+}
+
+func (w *wavFile) Close() error {
+	if err := w.WAVWriter.Close(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
@@ -0,0 +1,121 @@
+// debug.go contains a dump of a decoder's state for bug reports
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"fmt"
+	"strings"
+)
+
+// debugParams are the integer parameters listed by DebugString
+var debugParams = []struct {
+	name string
+	key  C.enum_mpg123_parms
+}{
+	{"verbose", C.MPG123_VERBOSE},
+	{"force_rate", C.MPG123_FORCE_RATE},
+	{"down_sample", C.MPG123_DOWN_SAMPLE},
+	{"rva", C.MPG123_RVA},
+	{"downspeed", C.MPG123_DOWNSPEED},
+	{"upspeed", C.MPG123_UPSPEED},
+	{"start_frame", C.MPG123_START_FRAME},
+	{"decode_frames", C.MPG123_DECODE_FRAMES},
+	{"icy_interval", C.MPG123_ICY_INTERVAL},
+	{"timeout", C.MPG123_TIMEOUT},
+	{"resync_limit", C.MPG123_RESYNC_LIMIT},
+	{"index_size", C.MPG123_INDEX_SIZE},
+	{"preframes", C.MPG123_PREFRAMES},
+	{"feedpool", C.MPG123_FEEDPOOL},
+	{"feedbuffer", C.MPG123_FEEDBUFFER},
+}
+
+// debugFlags are the names of the bits of the FLAGS parameter
+var debugFlags = []struct {
+	name string
+	bit  C.long
+}{
+	{"MONO_LEFT", C.MPG123_MONO_LEFT},
+	{"MONO_RIGHT", C.MPG123_MONO_RIGHT},
+	{"MONO_MIX", C.MPG123_MONO_MIX},
+	{"FORCE_STEREO", C.MPG123_FORCE_STEREO},
+	{"FORCE_8BIT", C.MPG123_FORCE_8BIT},
+	{"QUIET", C.MPG123_QUIET},
+	{"GAPLESS", C.MPG123_GAPLESS},
+	{"NO_RESYNC", C.MPG123_NO_RESYNC},
+	{"SEEKBUFFER", C.MPG123_SEEKBUFFER},
+	{"FUZZY", C.MPG123_FUZZY},
+	{"FORCE_FLOAT", C.MPG123_FORCE_FLOAT},
+	{"PLAIN_ID3TEXT", C.MPG123_PLAIN_ID3TEXT},
+	{"IGNORE_STREAMLENGTH", C.MPG123_IGNORE_STREAMLENGTH},
+	{"SKIP_ID3V2", C.MPG123_SKIP_ID3V2},
+	{"IGNORE_INFOFRAME", C.MPG123_IGNORE_INFOFRAME},
+	{"AUTO_RESAMPLE", C.MPG123_AUTO_RESAMPLE},
+	{"PICTURE", C.MPG123_PICTURE},
+	{"FORCE_ENDIAN", C.MPG123_FORCE_ENDIAN},
+	{"BIG_ENDIAN", C.MPG123_BIG_ENDIAN},
+}
+
+// DebugString describes the decoder's current parameters, flags, output
+// format, position, buffer fill and last error in a few lines of text, for
+// pasting into bug reports. It only reads state and does not count towards
+// the metrics.
+func (d *Decoder) DebugString() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var b strings.Builder
+	if d.handle == nil {
+		fmt.Fprintf(&b, "mpg123 decoder %d: deleted\n", d.id)
+		return b.String()
+	}
+	h := d.handle
+	fmt.Fprintf(&b, "mpg123 decoder %d: %s, api %d\n",
+		d.id, C.GoString(C.mpg123_current_decoder(h)), APIVersion)
+
+	var rate C.long
+	var channels, enc C.int
+	if C.mpg123_getformat(h, &rate, &channels, &enc) == C.MPG123_OK {
+		fmt.Fprintf(&b, "  format: %d Hz, %d channels, %v\n", rate, channels, Encoding(enc))
+	} else {
+		fmt.Fprintf(&b, "  format: not known yet\n")
+	}
+	fmt.Fprintf(&b, "  position: sample %d, frame %d, input byte %d\n",
+		int64(C.mpg123_tell(h)), int64(C.mpg123_tellframe(h)), int64(C.mpg123_framepos(h)))
+	fmt.Fprintf(&b, "  length: %d samples, %d frames\n",
+		int64(C.mpg123_length(h)), int64(C.mpg123_framelength(h)))
+
+	var val C.long
+	var fval C.double
+	if C.mpg123_getstate(h, C.MPG123_BUFFERFILL, &val, &fval) == C.MPG123_OK {
+		fmt.Fprintf(&b, "  buffer fill: %d bytes\n", val)
+	}
+
+	if C.mpg123_getparam(h, C.MPG123_FLAGS, &val, &fval) == C.MPG123_OK {
+		var names []string
+		for _, f := range debugFlags {
+			// bits the library lacks are defined as 0 in compat.h
+			if f.bit != 0 && val&f.bit == f.bit {
+				names = append(names, f.name)
+			}
+		}
+		fmt.Fprintf(&b, "  flags: %#x %s\n", val, strings.Join(names, "|"))
+	}
+	b.WriteString("  params:")
+	for _, p := range debugParams {
+		if C.mpg123_getparam(h, p.key, &val, &fval) == C.MPG123_OK {
+			fmt.Fprintf(&b, " %s=%d", p.name, val)
+		}
+	}
+	if C.mpg123_getparam(h, C.MPG123_OUTSCALE, &val, &fval) == C.MPG123_OK {
+		fmt.Fprintf(&b, " outscale=%g", float64(fval))
+	}
+	b.WriteString("\n")
+
+	fmt.Fprintf(&b, "  stream open: %t, mono downmix: %t, tee: %t\n",
+		d.streaming, d.goMono, d.tee != nil)
+	code := C.mpg123_errcode(h)
+	fmt.Fprintf(&b, "  last error: %d (%s)\n", code, C.GoString(C.mpg123_plain_strerror(code)))
+	return b.String()
+}
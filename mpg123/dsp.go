@@ -0,0 +1,131 @@
+// dsp.go contains a user processing stage in the Read pipeline, for wiring
+// in time-stretch, pitch shift or other DSP libraries. Blocks read through
+// it keep the timestamps of the source audio they came from.
+
+package mpg123
+
+import "time"
+
+// DSP processes interleaved samples normalized to [-1, 1] in the decoder's
+// channel layout. It may return more or fewer samples than it got, in whole
+// frames, as a time-stretcher does, and may keep state between calls. The
+// returned slice may reuse the input. At the end of the stream it is called
+// with no samples to flush what it holds, until it returns none.
+type DSP func(samples []float32) []float32
+
+// dspSpan maps the output of one DSP call back to its source
+type dspSpan struct {
+	source int64 // source sample offset of the input
+	in     int   // input frames
+	out    int   // output frames
+}
+
+// SetDSP inserts f into Read, after the downmix, ducking and fades. Its
+// output is converted back to the output encoding and buffered, so Read may
+// return audio from an earlier call, or nothing while f gathers input.
+// ReadBlock and Stream report the source position of what they return, not
+// the count of samples produced. Passing nil removes the stage.
+func (d *Decoder) SetDSP(f DSP) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dsp = f
+	d.resetDSP()
+}
+
+// resetDSP drops the processed audio not read yet, after a seek or when a
+// stream is opened. It is called with d locked.
+func (d *Decoder) resetDSP() {
+	d.dspOut = nil
+	d.dspSpans = nil
+	d.dspPos = 0
+}
+
+// dspFormat returns the format of the audio passed to the DSP stage. It is
+// called with d locked.
+func (d *Decoder) dspFormat() Format {
+	rate, channels, enc := d.getFormat()
+	if d.goMono {
+		channels = 1
+	}
+	return Format{Rate: rate, Channels: channels, Encoding: enc}
+}
+
+// runDSP passes the n bytes decoded into buf, which started at source
+// sample source, through the DSP stage and copies as much of the output as
+// fits back into buf. With flush set the stream has ended. It returns the
+// number of bytes in buf. It is called with d locked.
+func (d *Decoder) runDSP(buf []byte, n int, source int64, flush bool) (int, error) {
+	f := d.dspFormat()
+	c, err := codecFor(f.Encoding, d.byteOrder())
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 || flush {
+		in := make([]float32, n/c.size)
+		for i := range in {
+			in[i] = float32(c.get(buf[i*c.size:]))
+		}
+		out := d.dsp(in)
+		frames := len(out) / f.Channels
+		if frames > 0 {
+			off := len(d.dspOut)
+			d.dspOut = append(d.dspOut, make([]byte, frames*f.Channels*c.size)...)
+			for i, v := range out[:frames*f.Channels] {
+				c.put(d.dspOut[off+i*c.size:], float64(v))
+			}
+			d.dspSpans = append(d.dspSpans, dspSpan{source: source, in: len(in) / f.Channels, out: frames})
+		}
+	}
+	return d.takeDSP(buf), nil
+}
+
+// takeDSP copies whole frames of processed audio into buf and returns the
+// number of bytes. It is called with d locked.
+func (d *Decoder) takeDSP(buf []byte) int {
+	frameSize := d.dspFormat().BytesPerFrame()
+	if frameSize <= 0 {
+		return 0
+	}
+	n := copy(buf[:len(buf)/frameSize*frameSize], d.dspOut)
+	d.dspOut = d.dspOut[n:]
+	if len(d.dspOut) == 0 {
+		d.dspOut = nil
+	}
+	for k := n / frameSize; k > 0 && len(d.dspSpans) > 0; {
+		s := d.dspSpans[0]
+		if rest := s.out - d.dspPos; k >= rest {
+			k -= rest
+			d.dspSpans = d.dspSpans[1:]
+			d.dspPos = 0
+		} else {
+			d.dspPos += k
+			k = 0
+		}
+	}
+	return n
+}
+
+// sourceSample returns the source position of the next audio Read returns:
+// the decoder position, or with a DSP stage the position the processed
+// audio waiting to be read came from
+func (d *Decoder) sourceSample() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.dspSpans) == 0 {
+		return d.tell()
+	}
+	s := d.dspSpans[0]
+	return s.source + int64(d.dspPos)*int64(s.in)/int64(s.out)
+}
+
+// SourceTime returns the source position of the next audio Read returns as
+// time from the start of the stream, like TellTime but mapped back through
+// the DSP stage
+func (d *Decoder) SourceTime() time.Duration {
+	rate, _, _ := d.GetFormat()
+	sample := d.sourceSample()
+	if rate <= 0 || sample <= 0 {
+		return 0
+	}
+	return time.Duration(sample) * time.Second / time.Duration(rate)
+}
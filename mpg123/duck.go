@@ -0,0 +1,150 @@
+// duck.go contains a ducking filter: a gain applied to decoded audio that
+// lowers the level on demand, e.g. while a voice-over plays, and ramps
+// smoothly between the two levels
+
+package mpg123
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Ducker attenuates PCM audio while ducked. Duck and Unduck may be called
+// from any goroutine while another one runs the audio through Process;
+// the gain then ramps to the new level over the attack or release time.
+type Ducker struct {
+	mu      sync.Mutex
+	depth   float64       // linear gain while ducked
+	attack  time.Duration // ramp time down to depth
+	release time.Duration // ramp time back to unity
+	ducked  bool
+	gain    float64 // current linear gain
+}
+
+// NewDucker returns a Ducker lowering the level by depth dB (a positive
+// number, e.g. 12) while ducked, ramping down over attack and back up over
+// release. It starts at full level.
+func NewDucker(depth float64, attack time.Duration, release time.Duration) (*Ducker, error) {
+	if depth < 0 || math.IsNaN(depth) {
+		return nil, fmt.Errorf("mpg123 error: invalid ducking depth %v dB", depth)
+	}
+	if attack < 0 || release < 0 {
+		return nil, fmt.Errorf("mpg123 error: negative ducking ramp")
+	}
+	return &Ducker{
+		depth:   math.Pow(10, -depth/20),
+		attack:  attack,
+		release: release,
+		gain:    1,
+	}, nil
+}
+
+// Duck starts lowering the level
+func (k *Ducker) Duck() {
+	k.mu.Lock()
+	k.ducked = true
+	k.mu.Unlock()
+}
+
+// Unduck starts raising the level back to full
+func (k *Ducker) Unduck() {
+	k.mu.Lock()
+	k.ducked = false
+	k.mu.Unlock()
+}
+
+// Ducked reports whether the Ducker is ducked or ramping down
+func (k *Ducker) Ducked() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.ducked
+}
+
+// Gain returns the current gain in dB, 0 at full level
+func (k *Ducker) Gain() float64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return 20 * math.Log10(k.gain)
+}
+
+// Process applies the gain in place to buf, interleaved PCM audio in format
+// f with samples in the host byte order, advancing the ramps by the
+// duration of buf. Full level leaves the audio untouched.
+func (k *Ducker) Process(buf []byte, f Format) error {
+	c, err := codecFor(f.Encoding, nativeEndian)
+	if err != nil {
+		return err
+	}
+	return k.process(buf, f, c)
+}
+
+// process applies the gain to buf, whose samples c reads and writes
+func (k *Ducker) process(buf []byte, f Format, c *sampleCodec) error {
+	if f.Rate <= 0 || f.Channels <= 0 {
+		return fmt.Errorf("mpg123 error: invalid format %v", f)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	target, ramp := 1.0, k.release
+	if k.ducked {
+		target, ramp = k.depth, k.attack
+	}
+	// the gain moves linearly, by the full range over the ramp time
+	step := math.Inf(1)
+	if ramp > 0 {
+		step = (1 - k.depth) / (ramp.Seconds() * float64(f.Rate))
+	}
+	rampGain(buf, c, f.Channels, &k.gain, target, step)
+	return nil
+}
+
+// rampGain multiplies the frames of buf by a gain moving linearly from
+// *gain toward target by step per frame, and stores the gain reached. Once
+// the gain rests at 1 the rest of buf is left untouched.
+func rampGain(buf []byte, c *sampleCodec, channels int, gain *float64, target float64, step float64) {
+	g := *gain
+	frameSize := c.size * channels
+	for off := 0; off+frameSize <= len(buf); off += frameSize {
+		switch {
+		case g < target:
+			g = math.Min(g+step, target)
+		case g > target:
+			g = math.Max(g-step, target)
+		case g == 1:
+			*gain = g
+			return
+		}
+		for ch := 0; ch < channels; ch++ {
+			b := buf[off+ch*c.size:]
+			c.put(b, c.get(b)*g)
+		}
+	}
+	*gain = g
+}
+
+// SetDucker runs the audio returned by Read through k. Passing nil removes
+// it.
+func (d *Decoder) SetDucker(k *Ducker) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ducker = k
+}
+
+// duck applies the ducker to n bytes read into buf. It is called with d
+// locked.
+func (d *Decoder) duck(buf []byte) error {
+	if d.ducker == nil || len(buf) == 0 {
+		return nil
+	}
+	rate, channels, enc := d.getFormat()
+	if d.goMono {
+		channels = 1
+	}
+	c, err := codecFor(enc, d.byteOrder())
+	if err != nil {
+		return err
+	}
+	return d.ducker.process(buf, Format{Rate: rate, Channels: channels, Encoding: enc}, c)
+}
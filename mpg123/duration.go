@@ -0,0 +1,60 @@
+// duration.go contains Duration, which trades accuracy of the stream length
+// for speed as the caller chooses
+
+package mpg123
+
+import (
+	"errors"
+	"time"
+)
+
+// DurationMode selects how Duration determines the length of a stream
+type DurationMode int
+
+const (
+	// DurationEstimate uses what the headers say: exact with a Xing/Info
+	// header, otherwise extrapolated from the file size and bitrate, which
+	// is off for VBR streams without such a header. It costs nothing.
+	DurationEstimate DurationMode = iota
+	// DurationExact scans every frame of the stream unless the length is
+	// already exact. The input must be seekable.
+	DurationExact
+	// DurationAuto scans only when the estimate is unreliable: no Xing/Info
+	// header and not constant bitrate. If the scan fails, e.g. because the
+	// input cannot seek, the estimate is returned.
+	DurationAuto
+)
+
+// ErrLengthUnknown is returned by Duration when the stream length cannot be
+// determined, e.g. for a live stream in feed mode
+var ErrLengthUnknown = errors.New("mpg123 error: stream length not known")
+
+// Duration returns the playing time of the opened stream determined as mode
+// selects. A scan keeps the current position.
+func (d *Decoder) Duration(mode DurationMode) (time.Duration, error) {
+	rate, _, _ := d.GetFormat()
+	if rate <= 0 {
+		return 0, ErrFormatUnknown
+	}
+	accurate, _, _ := d.State(ACCURATE)
+	scan := false
+	switch mode {
+	case DurationExact:
+		scan = accurate == 0
+	case DurationAuto:
+		if accurate == 0 {
+			fi, err := d.FrameInfo()
+			scan = err != nil || fi.VBR != CBR
+		}
+	}
+	if scan {
+		if err := d.Scan(); err != nil && mode == DurationExact {
+			return 0, err
+		}
+	}
+	samples := d.LengthInPCMFrames()
+	if samples < 0 {
+		return 0, ErrLengthUnknown
+	}
+	return time.Duration(samples) * time.Second / time.Duration(rate), nil
+}
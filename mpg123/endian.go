@@ -0,0 +1,46 @@
+// endian.go detects the byte order the decoder uses for its output
+
+package mpg123
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// nativeEndian is the byte order of the host, which is also the byte order
+// of multi-byte samples produced by mpg123 unless FORCE_ENDIAN is set.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// ByteOrder returns the byte order of the decoder output. This is the host
+// byte order unless the FORCE_ENDIAN flag selects a fixed one (with BIG_ENDIAN
+// for big endian output).
+func (d *Decoder) ByteOrder() binary.ByteOrder {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return nativeEndian
+	}
+	return d.byteOrder()
+}
+
+// byteOrder returns the byte order of the decoder output. It is called with
+// d locked.
+func (d *Decoder) byteOrder() binary.ByteOrder {
+	if !HaveForceEndian {
+		return nativeEndian
+	}
+	flags, _, err := d.getParam(FLAGS)
+	if err != nil || flags&FORCE_ENDIAN == 0 {
+		return nativeEndian
+	}
+	if flags&BIG_ENDIAN != 0 {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
@@ -0,0 +1,95 @@
+// events.go contains the structured event stream of the decoders. Events are
+// logged through log/slog with the decoder's ID as the "decoder" attribute,
+// so the lines belonging to one stream can be picked out of a busy log.
+//
+// Events and levels:
+//
+//	format negotiated  Info  rate, channels, encoding
+//	metadata updated   Info  id3, icy (or title, url for HTTP streams)
+//	lost sync          Warn
+//	resync failed      Warn
+//	stream dropped     Warn  url, err (HTTP streams, before reconnecting)
+//	reconnect failed   Error url, err
+//	stream resumed     Info  url, offset (ranged HTTP reconnects)
+//	feed failed        Error err
+//	track started      Info  track, offset, title (chained streams)
+//	frames concealed   Warn  frames (see SetConcealment)
+//	end of stream      Info
+//	panic recovered    Error panic, stack (not tagged with a decoder)
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+var (
+	eventLog  atomic.Pointer[slog.Logger]
+	decoderID atomic.Uint64
+)
+
+// SetLogger sets the logger receiving decoder events. Passing nil restores
+// the default, slog.Default().
+func SetLogger(l *slog.Logger) {
+	eventLog.Store(l)
+}
+
+// ID returns the decoder's ID, unique within the process, which tags its
+// events
+func (d *Decoder) ID() uint64 {
+	return d.id
+}
+
+// recovered logs the panic p, caught where it must not spread: in callbacks
+// from C, which it cannot unwind through, and in goroutines of the package,
+// where nothing could recover it. It returns p as an error.
+func recovered(p any) error {
+	l := eventLog.Load()
+	if l == nil {
+		l = slog.Default()
+	}
+	l.Error("panic recovered", "panic", p, "stack", string(debug.Stack()))
+	return fmt.Errorf("mpg123 error: panic: %v", p)
+}
+
+// logger returns the logger for d's events
+func (d *Decoder) logger() *slog.Logger {
+	l := eventLog.Load()
+	if l == nil {
+		l = slog.Default()
+	}
+	return l.With("decoder", d.id)
+}
+
+// events logs what a decode call returning code tells about the stream. It
+// is called with d locked.
+func (d *Decoder) events(code C.int) {
+	switch code {
+	case C.MPG123_NEW_FORMAT:
+		var rate C.long
+		var channels, enc C.int
+		C.mpg123_getformat(d.handle, &rate, &channels, &enc)
+		d.setFormat(rate, channels, enc)
+		d.formatGen++
+		d.logger().Info("format negotiated",
+			"rate", int(rate), "channels", int(channels), "encoding", Encoding(enc).String())
+		d.emit(Event{Kind: EventFormatChange, Format: d.format})
+	case C.MPG123_DONE:
+		d.logger().Info("end of stream")
+		d.emit(Event{Kind: EventEOF})
+	case C.MPG123_ERR:
+		switch C.mpg123_errcode(d.handle) {
+		case C.MPG123_OUT_OF_SYNC:
+			d.logger().Warn("lost sync")
+		case C.MPG123_RESYNC_FAIL:
+			d.logger().Warn("resync failed")
+		}
+	}
+	d.checkMeta()
+}
@@ -0,0 +1,132 @@
+// fade.go contains short fades applied by Read at the start of a stream,
+// after seeks and around pauses and stops, so players do not click when the
+// audio starts or ends abruptly, whatever the output
+
+package mpg123
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrFadedOut is returned by Read once a fade started by FadeOut has reached
+// silence. No audio is lost: after FadeIn, Read continues where it stopped.
+var ErrFadedOut = errors.New("mpg123 error: faded out")
+
+// fadeState is the gain ramp of SetFades
+type fadeState struct {
+	in, out time.Duration
+	gain    float64 // current linear gain
+	target  float64 // 0 while fading out, 1 otherwise
+}
+
+// SetFades makes Read fade the audio in over in when a stream starts and
+// after every seek, and fade it out over out after FadeOut. A few
+// milliseconds remove the clicks of starting or stopping mid-waveform. Zero
+// durations turn fading off. Call it before opening the stream.
+func (d *Decoder) SetFades(in time.Duration, out time.Duration) error {
+	if in < 0 || out < 0 {
+		return fmt.Errorf("mpg123 error: negative fade time")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if in == 0 && out == 0 {
+		d.fade = nil
+		return nil
+	}
+	d.fade = &fadeState{in: in, out: out, gain: 0, target: 1}
+	return nil
+}
+
+// FadeOut starts fading the audio out. Once it is silent, Read returns
+// ErrFadedOut instead of decoding on; write out what it returned up to then
+// before stopping or pausing the output. Without SetFades, Read returns
+// ErrFadedOut straight away.
+func (d *Decoder) FadeOut() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fade == nil {
+		d.fade = &fadeState{gain: 1}
+	}
+	d.fade.target = 0
+	if d.fade.out == 0 {
+		d.fade.gain = 0
+	}
+}
+
+// FadeIn fades the audio back in after FadeOut, e.g. when resuming from a
+// pause
+func (d *Decoder) FadeIn() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fade == nil {
+		return
+	}
+	if d.fade.in == 0 && d.fade.out == 0 {
+		// set up by FadeOut without SetFades
+		d.fade = nil
+		return
+	}
+	d.fade.target = 1
+}
+
+// restartFade fades in from silence, at the start of a stream or after a
+// seek. It is called with d locked.
+func (d *Decoder) restartFade() {
+	if d.fade != nil {
+		d.fade.gain, d.fade.target = 0, 1
+	}
+}
+
+// fadedOut reports whether a fade out has reached silence. It is called
+// with d locked.
+func (d *Decoder) fadedOut() bool {
+	return d.fade != nil && d.fade.target == 0 && d.fade.gain == 0
+}
+
+// fadeStep returns the change of the fade gain per PCM frame at rate
+func (s *fadeState) fadeStep(rate int) float64 {
+	ramp := s.in
+	if s.target == 0 {
+		ramp = s.out
+	}
+	if ramp <= 0 || rate <= 0 {
+		return math.Inf(1)
+	}
+	return 1 / (ramp.Seconds() * float64(rate))
+}
+
+// fadeLimit shortens a read of size bytes during a fade out to the audio
+// left until silence, so the audio after it stays in the decoder. It is
+// called with d locked.
+func (d *Decoder) fadeLimit(size int) int {
+	if d.fade == nil || d.fade.target != 0 {
+		return size
+	}
+	rate, channels, enc := d.getFormat()
+	frameSize := (Format{rate, channels, enc}).BytesPerFrame()
+	if frameSize <= 0 {
+		return size
+	}
+	frames := int(math.Ceil(d.fade.gain / d.fade.fadeStep(rate)))
+	return min(size, frames*frameSize)
+}
+
+// applyFade ramps the audio read into buf. It is called with d locked.
+func (d *Decoder) applyFade(buf []byte) error {
+	if d.fade == nil || len(buf) == 0 {
+		return nil
+	}
+	rate, channels, enc := d.getFormat()
+	if d.goMono {
+		channels = 1
+	}
+	c, err := codecFor(enc, d.byteOrder())
+	if err != nil {
+		return err
+	}
+	rampGain(buf, c, channels, &d.fade.gain, d.fade.target, d.fade.fadeStep(rate))
+	return nil
+}
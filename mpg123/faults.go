@@ -0,0 +1,57 @@
+// faults.go contains the hooks that let tests inject failures at the cgo
+// boundary. They do nothing unless the package is built with the
+// mpg123_faults tag, which adds InjectFault and ClearFaults (see
+// faults_enabled.go).
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import "fmt"
+
+// Op names a call into libmpg123 that a fault can be injected into
+type Op string
+
+// Calls that support fault injection
+const (
+	OpOpen       Op = "open"        // Open, OpenFile, OpenFeed and OpenReader
+	OpRead       Op = "read"        // Read
+	OpFeed       Op = "feed"        // Feed
+	OpDecode     Op = "decode"      // Decode
+	OpSeek       Op = "seek"        // Seek
+	OpReaderRead Op = "reader-read" // reads from the io.Reader given to OpenReader
+)
+
+// Fault describes an injected failure
+type Fault struct {
+	After int // let this many calls succeed before failing
+	Times int // number of calls to fail, 0 for all further calls
+	Code  int // mpg123 return code to simulate, e.g. ERR or DONE; OK for none
+	Limit int // if > 0, cap the bytes a read returns (a short read)
+}
+
+// faultHook is set by faults_enabled.go when built with mpg123_faults
+var faultHook func(op Op) (Fault, bool)
+
+// fault returns the fault to apply to the current call of op, if any
+func fault(op Op) (Fault, bool) {
+	if faultHook == nil {
+		return Fault{}, false
+	}
+	return faultHook(op)
+}
+
+// faultError is the error returned for an injected return code
+func faultError(code int) error {
+	countError(C.int(code))
+	return fmt.Errorf("mpg123 error: %s (injected)", C.GoString(C.mpg123_plain_strerror(C.int(code))))
+}
+
+// limitFault shortens n to the limit of an injected short read
+func limitFault(f Fault, n int) int {
+	if f.Limit > 0 && f.Limit < n {
+		return f.Limit
+	}
+	return n
+}
@@ -0,0 +1,59 @@
+//go:build mpg123_faults
+
+// faults_enabled.go provides the fault injection API for testing how
+// applications cope with decoder failures, for example
+//
+//	mpg123.InjectFault(mpg123.OpRead, mpg123.Fault{After: 10, Code: mpg123.ERR})
+//	defer mpg123.ClearFaults()
+//
+// It is only compiled with -tags mpg123_faults.
+
+package mpg123
+
+import "sync"
+
+type faultState struct {
+	Fault
+	calls int
+}
+
+var (
+	faultsMu sync.Mutex
+	faults   = map[Op]*faultState{}
+)
+
+func init() {
+	faultHook = nextFault
+}
+
+// InjectFault makes calls of op fail as described by f, replacing an earlier
+// fault for op. Faults apply to all decoders.
+func InjectFault(op Op, f Fault) {
+	faultsMu.Lock()
+	faults[op] = &faultState{Fault: f}
+	faultsMu.Unlock()
+}
+
+// ClearFaults removes all injected faults
+func ClearFaults() {
+	faultsMu.Lock()
+	faults = map[Op]*faultState{}
+	faultsMu.Unlock()
+}
+
+func nextFault(op Op) (Fault, bool) {
+	faultsMu.Lock()
+	defer faultsMu.Unlock()
+	s, ok := faults[op]
+	if !ok {
+		return Fault{}, false
+	}
+	s.calls++
+	if s.calls <= s.After {
+		return Fault{}, false
+	}
+	if s.Times > 0 && s.calls > s.After+s.Times {
+		return Fault{}, false
+	}
+	return s.Fault, true
+}
@@ -0,0 +1,126 @@
+//go:build mpg123_faults
+
+package mpg123
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// injected reports whether err is the error of an injected return code
+func injected(err error) bool {
+	return err != nil && strings.HasSuffix(err.Error(), "(injected)")
+}
+
+// TestInjectFault injects an ERR return into each op and checks that the
+// call fails with the injected error, after After calls have succeeded and
+// for Times calls only
+func TestInjectFault(t *testing.T) {
+	buf := make([]byte, 4608)
+	for _, test := range []struct {
+		name string
+		op   Op
+		open func(t *testing.T) *Decoder
+		call func(d *Decoder) error
+	}{
+		{"OpenFeed", OpOpen, newFeedDecoder, func(d *Decoder) error {
+			return d.OpenFeed()
+		}},
+		{"OpenReader", OpOpen, newFeedDecoder, func(d *Decoder) error {
+			return d.OpenReader(bytes.NewReader(silentMP3(10)))
+		}},
+		{"Read", OpRead, openSilenceT, func(d *Decoder) error {
+			_, err := d.Read(buf)
+			return err
+		}},
+		{"Feed", OpFeed, newFeedDecoder, func(d *Decoder) error {
+			return d.Feed(silentFrame())
+		}},
+		{"Decode", OpDecode, newFeedDecoder, func(d *Decoder) error {
+			_, err := d.Decode(silentFrame())
+			return err
+		}},
+		{"Seek", OpSeek, openSilenceT, func(d *Decoder) error {
+			_, err := d.Seek(0, io.SeekStart)
+			return err
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := test.open(t)
+			InjectFault(test.op, Fault{After: 1, Times: 1, Code: ERR})
+			t.Cleanup(ClearFaults)
+			if err := test.call(d); err != nil {
+				t.Fatalf("call before the fault: %v", err)
+			}
+			if err := test.call(d); !injected(err) {
+				t.Fatalf("faulted call: got %v, want the injected error", err)
+			}
+			if err := test.call(d); err != nil {
+				t.Fatalf("call after the fault: %v", err)
+			}
+		})
+	}
+}
+
+// TestInjectReadDone checks that an injected DONE ends Read with EOF
+func TestInjectReadDone(t *testing.T) {
+	d := openSilence(t, 10)
+	InjectFault(OpRead, Fault{Code: DONE})
+	t.Cleanup(ClearFaults)
+	if _, err := d.Read(make([]byte, 4608)); err != EOF {
+		t.Errorf("Read: got %v, want EOF", err)
+	}
+}
+
+// TestInjectShortRead checks that Limit caps what Read returns
+func TestInjectShortRead(t *testing.T) {
+	d := openSilence(t, 10)
+	InjectFault(OpRead, Fault{Limit: 100})
+	t.Cleanup(ClearFaults)
+	buf := make([]byte, 4608)
+	n, err := d.Read(buf)
+	if n == 0 && err == nil {
+		// the first call may only report the new format
+		n, err = d.Read(buf)
+	}
+	if err != nil || n != 100 {
+		t.Errorf("Read: got %d, %v, want 100 bytes", n, err)
+	}
+}
+
+// TestInjectReaderRead checks that a failing input read of OpenReader makes
+// Read fail, and that short input reads still decode everything
+func TestInjectReaderRead(t *testing.T) {
+	d := openSilence(t, 10)
+	InjectFault(OpReaderRead, Fault{Code: ERR})
+	t.Cleanup(ClearFaults)
+	if _, err := d.Read(make([]byte, 4608)); err == nil {
+		t.Error("Read: got no error from a failing input read")
+	}
+
+	ClearFaults()
+	d = openSilence(t, 10)
+	InjectFault(OpReaderRead, Fault{Limit: 10})
+	pcm, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if want := 10 * 1152 * 4; len(pcm) != want {
+		t.Errorf("got %d bytes with short input reads, want %d", len(pcm), want)
+	}
+}
+
+// newFeedDecoder returns a decoder opened for feeding
+func newFeedDecoder(t *testing.T) *Decoder {
+	d := newTestDecoder(t)
+	if err := d.OpenFeed(); err != nil {
+		t.Fatalf("OpenFeed: %v", err)
+	}
+	return d
+}
+
+func openSilenceT(t *testing.T) *Decoder {
+	return openSilence(t, 10)
+}
@@ -0,0 +1,135 @@
+// features.go detects optional features of the linked libmpg123, which can
+// be left out when the library is built
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Feature is an optional capability of libmpg123
+type Feature int
+
+// Features that can be queried with HasFeature
+const (
+	FEATURE_ABI_UTF8OPEN      Feature = C.MPG123_FEATURE_ABI_UTF8OPEN
+	FEATURE_OUTPUT_8BIT       Feature = C.MPG123_FEATURE_OUTPUT_8BIT
+	FEATURE_OUTPUT_16BIT      Feature = C.MPG123_FEATURE_OUTPUT_16BIT
+	FEATURE_OUTPUT_32BIT      Feature = C.MPG123_FEATURE_OUTPUT_32BIT
+	FEATURE_INDEX             Feature = C.MPG123_FEATURE_INDEX
+	FEATURE_PARSE_ID3V2       Feature = C.MPG123_FEATURE_PARSE_ID3V2
+	FEATURE_DECODE_LAYER1     Feature = C.MPG123_FEATURE_DECODE_LAYER1
+	FEATURE_DECODE_LAYER2     Feature = C.MPG123_FEATURE_DECODE_LAYER2
+	FEATURE_DECODE_LAYER3     Feature = C.MPG123_FEATURE_DECODE_LAYER3
+	FEATURE_DECODE_ACCURATE   Feature = C.MPG123_FEATURE_DECODE_ACCURATE
+	FEATURE_DECODE_DOWNSAMPLE Feature = C.MPG123_FEATURE_DECODE_DOWNSAMPLE
+	FEATURE_DECODE_NTOM       Feature = C.MPG123_FEATURE_DECODE_NTOM
+	FEATURE_PARSE_ICY         Feature = C.MPG123_FEATURE_PARSE_ICY
+	FEATURE_TIMEOUT_READ      Feature = C.MPG123_FEATURE_TIMEOUT_READ
+	FEATURE_EQUALIZER         Feature = C.MPG123_FEATURE_EQUALIZER
+	FEATURE_MOREINFO          Feature = C.MPG123_FEATURE_MOREINFO
+	FEATURE_OUTPUT_FLOAT32    Feature = C.MPG123_FEATURE_OUTPUT_FLOAT32
+	FEATURE_OUTPUT_FLOAT64    Feature = C.MPG123_FEATURE_OUTPUT_FLOAT64
+
+	// FEATURE_RAW_ID3 is not a build option but part of the API of
+	// libmpg123 1.26 and later: access to the raw ID3 tags, see RawID3
+	FEATURE_RAW_ID3 Feature = 32
+)
+
+var featureNames = map[Feature]string{
+	FEATURE_ABI_UTF8OPEN:      "UTF-8 file names",
+	FEATURE_OUTPUT_8BIT:       "8 bit output",
+	FEATURE_OUTPUT_16BIT:      "16 bit output",
+	FEATURE_OUTPUT_32BIT:      "32 bit output",
+	FEATURE_INDEX:             "frame index",
+	FEATURE_PARSE_ID3V2:       "ID3v2 parsing",
+	FEATURE_DECODE_LAYER1:     "layer I decoding",
+	FEATURE_DECODE_LAYER2:     "layer II decoding",
+	FEATURE_DECODE_LAYER3:     "layer III decoding",
+	FEATURE_DECODE_ACCURATE:   "accurate rounding",
+	FEATURE_DECODE_DOWNSAMPLE: "downsampling",
+	FEATURE_DECODE_NTOM:       "arbitrary resampling (NtoM)",
+	FEATURE_PARSE_ICY:         "ICY metadata parsing",
+	FEATURE_TIMEOUT_READ:      "read timeouts",
+	FEATURE_EQUALIZER:         "equalizer",
+	FEATURE_MOREINFO:          "extended decoder information",
+	FEATURE_OUTPUT_FLOAT32:    "32 bit float output",
+	FEATURE_OUTPUT_FLOAT64:    "64 bit float output",
+	FEATURE_RAW_ID3:           "raw ID3 tags",
+}
+
+func (f Feature) String() string {
+	if name, ok := featureNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("feature %d", int(f))
+}
+
+// int mpg123_feature(const enum mpg123_feature_set key)
+// HasFeature reports whether the linked libmpg123 was built with a feature
+func HasFeature(f Feature) bool {
+	if f == FEATURE_RAW_ID3 {
+		return HaveRawID3
+	}
+	return C.mpg123_feature(uint32(f)) != 0
+}
+
+// ErrUnsupported is matched (with errors.Is) by the errors returned when an
+// API needs a feature the linked libmpg123 was built without
+var ErrUnsupported = errors.New("not supported by libmpg123")
+
+// FeatureError reports a missing libmpg123 feature
+type FeatureError struct {
+	Feature Feature
+}
+
+func (e *FeatureError) Error() string {
+	return fmt.Sprintf("mpg123 error: %s %s", e.Feature, ErrUnsupported)
+}
+
+func (e *FeatureError) Unwrap() error {
+	return ErrUnsupported
+}
+
+// detectFeatures records the features of the library as a bit set, see
+// Decoder.require
+func detectFeatures() uint64 {
+	var set uint64
+	for f := range featureNames {
+		if HasFeature(f) {
+			set |= 1 << uint(f)
+		}
+	}
+	return set
+}
+
+// require returns a *FeatureError unless the library has feature f
+func (d *Decoder) require(f Feature) error {
+	if d.features&(1<<uint(f)) == 0 {
+		return &FeatureError{Feature: f}
+	}
+	return nil
+}
+
+// encodingFeature returns the output feature an encoding depends on
+func encodingFeature(encoding int) (Feature, bool) {
+	switch encoding {
+	case ENC_FLOAT_32:
+		return FEATURE_OUTPUT_FLOAT32, true
+	case ENC_FLOAT_64:
+		return FEATURE_OUTPUT_FLOAT64, true
+	}
+	switch GetEncodingBitsPerSample(encoding) {
+	case 8:
+		return FEATURE_OUTPUT_8BIT, true
+	case 16:
+		return FEATURE_OUTPUT_16BIT, true
+	case 24, 32:
+		return FEATURE_OUTPUT_32BIT, true
+	}
+	return 0, false
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+// file_unix.go hands the file descriptor of an *os.File directly to mpg123.
+// This works the same on Linux, the BSDs and macOS, where off_t is always 64
+// bits wide.
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"fmt"
+	"os"
+)
+
+func (d *Decoder) openFile(f *os.File) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	err := C.mpg123_open_fd(d.handle, C.int(f.Fd()))
+	if err != C.MPG123_OK {
+		return fmt.Errorf("error attaching file: %s", d.strerror())
+	}
+	// the descriptor is closed when f is collected, so hold on to it
+	d.file = f
+	d.streamOpened()
+	d.source = fileKey(f.Stat())
+	return nil
+}
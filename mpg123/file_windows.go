@@ -0,0 +1,11 @@
+// file_windows.go reads an *os.File through the Go reader callbacks, since
+// File.Fd returns a Windows handle rather than the C runtime descriptor
+// mpg123_open_fd expects
+
+package mpg123
+
+import "os"
+
+func (d *Decoder) openFile(f *os.File) error {
+	return d.OpenReader(f)
+}
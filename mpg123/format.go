@@ -0,0 +1,100 @@
+// format.go contains the Format type describing decoded PCM audio
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import "errors"
+
+// Format describes the PCM output of a decoder
+type Format struct {
+	Rate     int // samples per second
+	Channels int
+	Encoding int // one of the ENC_* constants
+}
+
+// BytesPerFrame returns the size in bytes of one PCM frame, that is one
+// sample for each channel
+func (f Format) BytesPerFrame() int {
+	return f.Channels * GetEncodingBitsPerSample(f.Encoding) / 8
+}
+
+// ErrFormatUnknown is returned by Rate, Channels and Encoding while the
+// decoder has not yet seen a frame header of the current stream, e.g. right
+// after OpenFeed
+var ErrFormatUnknown = errors.New("mpg123 error: output format not known yet")
+
+// Rate returns the output sample rate
+func (d *Decoder) Rate() (int, error) {
+	f, err := d.currentFormat()
+	return f.Rate, err
+}
+
+// Channels returns the number of channels Read produces. Unlike GetFormat
+// this is 1 when mixing down with MonoGo.
+func (d *Decoder) Channels() (int, error) {
+	f, err := d.readFormat()
+	return f.Channels, err
+}
+
+// Encoding returns the output encoding, one of the ENC_* constants
+func (d *Decoder) Encoding() (int, error) {
+	f, err := d.currentFormat()
+	return f.Encoding, err
+}
+
+// BytesPerFrame returns the size in bytes of one PCM frame of the audio
+// Read produces, for sizing buffers and converting byte counts to frames
+func (d *Decoder) BytesPerFrame() (int, error) {
+	f, err := d.readFormat()
+	return f.BytesPerFrame(), err
+}
+
+// readFormat is currentFormat adjusted for the downmix done by MonoGo
+func (d *Decoder) readFormat() (Format, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.outputFormat()
+}
+
+// outputFormat is readFormat. It is called with d locked.
+func (d *Decoder) outputFormat() (Format, error) {
+	f, err := d.cachedFormat()
+	if err == nil && d.goMono && f.Channels > 1 {
+		f.Channels = 1
+	}
+	return f, err
+}
+
+// currentFormat returns the output format, asking mpg123 only if it is not
+// cached yet. The cache is filled when a decode call reports NEW_FORMAT and
+// dropped when a stream is opened or closed.
+func (d *Decoder) currentFormat() (Format, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cachedFormat()
+}
+
+// cachedFormat is currentFormat. It is called with d locked.
+func (d *Decoder) cachedFormat() (Format, error) {
+	if d.formatKnown {
+		return d.format, nil
+	}
+	if d.handle == nil || !d.streaming {
+		return Format{}, ErrFormatUnknown
+	}
+	var rate C.long
+	var channels, enc C.int
+	if C.mpg123_getformat(d.handle, &rate, &channels, &enc) != C.MPG123_OK {
+		return Format{}, ErrFormatUnknown
+	}
+	d.setFormat(rate, channels, enc)
+	return d.format, nil
+}
+
+// setFormat caches the output format. It is called with d locked.
+func (d *Decoder) setFormat(rate C.long, channels, enc C.int) {
+	d.format = Format{Rate: int(rate), Channels: int(channels), Encoding: int(enc)}
+	d.formatKnown = true
+}
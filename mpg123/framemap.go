@@ -0,0 +1,92 @@
+// framemap.go contains the export of a table mapping MPEG frames to their
+// byte offsets in the input and their sample offsets in the output, so tools
+// outside the decoder can map time ranges to byte ranges
+
+package mpg123
+
+/*
+#include "compat.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// FrameOffset locates one MPEG frame in the input and in the decoded output
+type FrameOffset struct {
+	Frame  int64 // frame number, counting from 0
+	Byte   int64 // input byte offset of the frame header
+	Sample int64 // output sample offset (in PCM frames) of the start of the frame
+}
+
+// FrameMap lists the frames of a stream in order
+type FrameMap []FrameOffset
+
+// FrameMap parses every frame of the opened stream without decoding it and
+// returns where each starts, then returns to the current position (any audio
+// kept by Prime is dropped). Sample offsets are those of TellCurrentSample:
+// they follow the output rate and, with gapless decoding, frames within the
+// encoder delay map to 0. The stream must be seekable.
+func (d *Decoder) FrameMap() (FrameMap, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return nil, ErrDeleted
+	}
+	pos := int64(C.mpg123_tell(d.handle)) - d.primedFrames()
+	d.primed = nil
+	if C.mpg123_seek(d.handle, 0, C.int(io.SeekStart)) < 0 {
+		return nil, fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	var m FrameMap
+	for {
+		code := C.mpg123_framebyframe_next(d.handle)
+		if code == C.MPG123_DONE {
+			break
+		}
+		if code != C.MPG123_OK && code != C.MPG123_NEW_FORMAT {
+			return nil, fmt.Errorf("mpg123 error: %s", d.strerror())
+		}
+		m = append(m, FrameOffset{
+			Frame:  int64(C.mpg123_tellframe(d.handle)),
+			Byte:   int64(C.mpg123_framepos(d.handle)),
+			Sample: int64(C.mpg123_tell(d.handle)),
+		})
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	s := int64(C.mpg123_seek(d.handle, C.off_t(pos), C.int(io.SeekStart)))
+	if s < 0 {
+		return nil, fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	d.resetPacing()
+	if _, err := d.prerollTo(s); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ByteRange returns the input bytes [start, end) holding the audio of the
+// samples [from, to). Layer III frames may draw on data of the frame before
+// (the bit reservoir), so the range starts one frame early. end is -1 when
+// the range runs to the end of the stream.
+func (m FrameMap) ByteRange(from, to int64) (start, end int64) {
+	if len(m) == 0 {
+		return 0, -1
+	}
+	// first frame starting after from, the one before holds it
+	i := sort.Search(len(m), func(i int) bool { return m[i].Sample > from })
+	i -= 2
+	if i < 0 {
+		i = 0
+	}
+	j := sort.Search(len(m), func(j int) bool { return m[j].Sample >= to })
+	if j == len(m) {
+		return m[i].Byte, -1
+	}
+	return m[i].Byte, m[j].Byte
+}
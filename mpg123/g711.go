@@ -0,0 +1,118 @@
+// g711.go contains G.711 µ-law and A-law conversion, for 8 bit telephony
+// audio when libmpg123 cannot produce it and for processing its output
+
+package mpg123
+
+import "fmt"
+
+// Telephony formats: 8 kHz mono in the two G.711 companding laws
+var (
+	FormatULaw = Format{Rate: 8000, Channels: 1, Encoding: ENC_ULAW_8}
+	FormatALaw = Format{Rate: 8000, Channels: 1, Encoding: ENC_ALAW_8}
+)
+
+// SetTelephony sets the decoder up to produce 8 kHz mono in encoding, which
+// must be ENC_ULAW_8 or ENC_ALAW_8, and returns the pipeline delivering it,
+// see Negotiate. It must be called before the stream is opened.
+func (d *Decoder) SetTelephony(encoding int) (*Pipeline, error) {
+	switch encoding {
+	case ENC_ULAW_8:
+		return d.Negotiate(FormatULaw)
+	case ENC_ALAW_8:
+		return d.Negotiate(FormatALaw)
+	}
+	return nil, fmt.Errorf("mpg123 error: %v is not a telephony encoding", Encoding(encoding))
+}
+
+// segment ends of the reference G.711 implementation
+var (
+	ulawSegEnd = [8]int{0x3f, 0x7f, 0xff, 0x1ff, 0x3ff, 0x7ff, 0xfff, 0x1fff}
+	alawSegEnd = [8]int{0x1f, 0x3f, 0x7f, 0xff, 0x1ff, 0x3ff, 0x7ff, 0xfff}
+)
+
+const (
+	g711Bias  = 0x84 // µ-law bias added before encoding
+	g711Clip  = 8159 // largest µ-law magnitude, in 14 bit
+	g711Quant = 0x0f
+	g711Seg   = 0x70
+	g711Sign  = 0x80
+)
+
+func g711Segment(v int, ends *[8]int) int {
+	for i, end := range ends {
+		if v <= end {
+			return i
+		}
+	}
+	return len(ends)
+}
+
+// LinearToULaw encodes a 16 bit sample as µ-law
+func LinearToULaw(sample int16) byte {
+	v := int(sample) >> 2
+	mask := byte(0xff)
+	if v < 0 {
+		v = -v
+		mask = 0x7f
+	}
+	if v > g711Clip {
+		v = g711Clip
+	}
+	v += g711Bias >> 2
+	seg := g711Segment(v, &ulawSegEnd)
+	if seg >= 8 {
+		return 0x7f ^ mask
+	}
+	return byte(seg<<4|(v>>(seg+1))&g711Quant) ^ mask
+}
+
+// ULawToLinear decodes a µ-law byte to a 16 bit sample
+func ULawToLinear(u byte) int16 {
+	u = ^u
+	t := (int(u&g711Quant) << 3) + g711Bias
+	t <<= (u & g711Seg) >> 4
+	if u&g711Sign != 0 {
+		return int16(g711Bias - t)
+	}
+	return int16(t - g711Bias)
+}
+
+// LinearToALaw encodes a 16 bit sample as A-law
+func LinearToALaw(sample int16) byte {
+	v := int(sample) >> 3
+	mask := byte(0xd5)
+	if v < 0 {
+		mask = 0x55
+		v = -v - 1
+	}
+	seg := g711Segment(v, &alawSegEnd)
+	if seg >= 8 {
+		return 0x7f ^ mask
+	}
+	a := seg << 4
+	if seg < 2 {
+		a |= (v >> 1) & g711Quant
+	} else {
+		a |= (v >> seg) & g711Quant
+	}
+	return byte(a) ^ mask
+}
+
+// ALawToLinear decodes an A-law byte to a 16 bit sample
+func ALawToLinear(a byte) int16 {
+	a ^= 0x55
+	t := int(a&g711Quant) << 4
+	switch seg := (a & g711Seg) >> 4; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&g711Sign != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
@@ -0,0 +1,73 @@
+package mpg123
+
+import "testing"
+
+// code points from the ITU-T G.711 tables, with the standard's 14 bit
+// (µ-law) and 13 bit (A-law) decoder outputs scaled to 16 bits
+func TestG711CodePoints(t *testing.T) {
+	for _, tc := range []struct {
+		law    string
+		linear int16
+		code   byte
+	}{
+		{"µ-law", 0, 0xff},
+		{"µ-law", 32124, 0x80},
+		{"µ-law", -32124, 0x00},
+		{"µ-law", 8, 0xfe},
+		{"µ-law", -8, 0x7e},
+		{"µ-law", 132, 0xef},
+		{"µ-law", 3900, 0xb0},
+		{"µ-law", -3900, 0x30},
+		{"A-law", 8, 0xd5},
+		{"A-law", -8, 0x55},
+		{"A-law", 32256, 0xaa},
+		{"A-law", -32256, 0x2a},
+		{"A-law", 136, 0xdd},
+		{"A-law", 528, 0xf5},
+		{"A-law", -528, 0x75},
+	} {
+		encode, decode := LinearToULaw, ULawToLinear
+		if tc.law == "A-law" {
+			encode, decode = LinearToALaw, ALawToLinear
+		}
+		if got := decode(tc.code); got != tc.linear {
+			t.Errorf("%s decode 0x%02x: got %d, want %d", tc.law, tc.code, got, tc.linear)
+		}
+		if got := encode(tc.linear); got != tc.code {
+			t.Errorf("%s encode %d: got 0x%02x, want 0x%02x", tc.law, tc.linear, got, tc.code)
+		}
+	}
+	// out of range samples clip to the largest code
+	for _, tc := range []struct {
+		law    string
+		encode func(int16) byte
+		linear int16
+		code   byte
+	}{
+		{"µ-law", LinearToULaw, 32767, 0x80},
+		{"µ-law", LinearToULaw, -32768, 0x00},
+		{"A-law", LinearToALaw, 32767, 0xaa},
+		{"A-law", LinearToALaw, -32768, 0x2a},
+	} {
+		if got := tc.encode(tc.linear); got != tc.code {
+			t.Errorf("%s encode %d: got 0x%02x, want 0x%02x", tc.law, tc.linear, got, tc.code)
+		}
+	}
+}
+
+func TestG711RoundTrip(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		u := byte(i)
+		want := u
+		if u == 0x7f {
+			// negative zero decodes to 0, which encodes as positive zero
+			want = 0xff
+		}
+		if got := LinearToULaw(ULawToLinear(u)); got != want {
+			t.Errorf("µ-law 0x%02x: decoded to %d, encoded back to 0x%02x", u, ULawToLinear(u), got)
+		}
+		if got := LinearToALaw(ALawToLinear(u)); got != u {
+			t.Errorf("A-law 0x%02x: decoded to %d, encoded back to 0x%02x", u, ALawToLinear(u), got)
+		}
+	}
+}
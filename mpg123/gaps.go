@@ -0,0 +1,207 @@
+// gaps.go analyses the joins between consecutive decoded tracks, to check
+// automatically that a gapless pipeline really produces no gaps or clicks
+
+package mpg123
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// GapOptions sets the thresholds of CheckBoundaries. Zero values select the
+// defaults.
+type GapOptions struct {
+	SilenceDB float64       // level below which audio counts as silence, -60 dBFS if 0
+	MaxGap    time.Duration // silence across a join still accepted, 10ms if 0
+	MaxJump   float64       // accepted step at the join relative to the local slope, 8 if 0
+}
+
+// Boundary describes the join between track Index and the next one
+type Boundary struct {
+	Index    int
+	Trailing time.Duration // silence at the end of track Index
+	Leading  time.Duration // silence at the start of track Index+1
+	Jump     float64       // step across the join in multiples of the average step before it
+	Gap      bool          // the silence across the join exceeds MaxGap
+	Click    bool          // the step exceeds MaxJump: samples missing or doubled
+}
+
+// OK reports whether the join is inaudible
+func (b Boundary) OK() bool {
+	return !b.Gap && !b.Click
+}
+
+func (b Boundary) String() string {
+	return fmt.Sprintf("track %d/%d: silence %v + %v, jump %.1f", b.Index+1, b.Index+2, b.Trailing, b.Leading, b.Jump)
+}
+
+func (o GapOptions) withDefaults() GapOptions {
+	if o.SilenceDB == 0 {
+		o.SilenceDB = -60
+	}
+	if o.MaxGap == 0 {
+		o.MaxGap = 10 * time.Millisecond
+	}
+	if o.MaxJump == 0 {
+		o.MaxJump = 8
+	}
+	return o
+}
+
+// slopeWindow is the number of frames before a join averaged for its slope
+const slopeWindow = 32
+
+// CheckBoundaries looks at the joins between consecutive tracks of decoded
+// PCM data in format f and reports one Boundary per join. Silence running
+// across a join hints at encoder delay or padding left in; a step much
+// larger than the slope of the waveform before it hints at dropped or
+// doubled samples. Tracks with silence written into them at the ends are
+// reported as gaps too, so check with material that plays through.
+func CheckBoundaries(tracks [][]byte, f Format, opts GapOptions) ([]Boundary, error) {
+	opts = opts.withDefaults()
+	if f.Rate <= 0 {
+		return nil, fmt.Errorf("mpg123 error: invalid rate %d", f.Rate)
+	}
+	var bounds []Boundary
+	for i := 0; i+1 < len(tracks); i++ {
+		bd, err := checkJoin(tracks[i], tracks[i+1], f, opts)
+		if err != nil {
+			return nil, err
+		}
+		bd.Index = i
+		bounds = append(bounds, bd)
+	}
+	return bounds, nil
+}
+
+// checkJoin analyses the join from the end of a to the start of b
+func checkJoin(a, b []byte, f Format, opts GapOptions) (Boundary, error) {
+	pa, err := DeinterleaveFloat64(a, f.Channels, f.Encoding)
+	if err != nil {
+		return Boundary{}, err
+	}
+	pb, err := DeinterleaveFloat64(b, f.Channels, f.Encoding)
+	if err != nil {
+		return Boundary{}, err
+	}
+	silence := math.Pow(10, opts.SilenceDB/20)
+	trailing := silentRun(pa, silence, true)
+	leading := silentRun(pb, silence, false)
+	bd := Boundary{
+		Trailing: time.Duration(trailing) * time.Second / time.Duration(f.Rate),
+		Leading:  time.Duration(leading) * time.Second / time.Duration(f.Rate),
+	}
+	bd.Gap = bd.Trailing+bd.Leading > opts.MaxGap
+	if trailing == 0 && leading == 0 {
+		bd.Jump = joinJump(pa, pb)
+		bd.Click = bd.Jump > opts.MaxJump
+	}
+	return bd, nil
+}
+
+// silentRun counts the frames at the end (or start) of planes in which no
+// channel reaches level
+func silentRun(planes [][]float64, level float64, end bool) int {
+	if len(planes) == 0 {
+		return 0
+	}
+	n := len(planes[0])
+	for run := 0; run < n; run++ {
+		i := run
+		if end {
+			i = n - 1 - run
+		}
+		for _, p := range planes {
+			if math.Abs(p[i]) >= level {
+				return run
+			}
+		}
+	}
+	return n
+}
+
+// joinJump returns the step from the last frame of a to the first of b,
+// divided by the average step over the slopeWindow frames before the join,
+// taking the worst channel
+func joinJump(a, b [][]float64) float64 {
+	var worst float64
+	for ch := range a {
+		pa, pb := a[ch], b[ch]
+		if len(pa) < 2 || len(pb) == 0 {
+			continue
+		}
+		start := len(pa) - slopeWindow
+		if start < 1 {
+			start = 1
+		}
+		var slope float64
+		for i := start; i < len(pa); i++ {
+			slope += math.Abs(pa[i] - pa[i-1])
+		}
+		slope /= float64(len(pa) - start)
+		step := math.Abs(pb[0] - pa[len(pa)-1])
+		// a flat waveform makes any step stand out, floor the slope at 1 LSB of 16 bit
+		if r := step / math.Max(slope, 1.0/(1<<15)); r > worst {
+			worst = r
+		}
+	}
+	return worst
+}
+
+// edgeSize is how many bytes CheckAlbumGaps keeps of each end of a track,
+// a multiple of every frame size. That is between 2 seconds (48 kHz stereo
+// ENC_FLOAT_64) and several minutes of audio.
+const edgeSize = 48 << 16
+
+// CheckAlbumGaps decodes files gaplessly like DecodeAlbum and checks the
+// joins between them like CheckBoundaries. Only the ends of each track are
+// kept (see edgeSize), which also bounds the silence measured.
+func CheckAlbumGaps(files []string, opts ConvertOptions, gap GapOptions) ([]Boundary, error) {
+	opts.Gapless = true
+	gap = gap.withDefaults()
+	var f Format
+	var prev *edgeWriter
+	var bounds []Boundary
+	albumRate := 0
+	for i, file := range files {
+		e := &edgeWriter{}
+		_, rate, channels, err := decodeAlbumTrack(e, file, opts, albumRate)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if i == 0 {
+			// pin the remaining tracks to the format of the first
+			albumRate, opts.Rate, opts.Channels = rate, 0, channels
+			f = Format{Rate: rate, Channels: channels, Encoding: opts.Encoding}
+			if f.Encoding == 0 {
+				f.Encoding = ENC_SIGNED_16
+			}
+		} else {
+			bd, err := checkJoin(prev.tail, e.head, f, gap)
+			if err != nil {
+				return nil, err
+			}
+			bd.Index = i - 1
+			bounds = append(bounds, bd)
+		}
+		prev = e
+	}
+	return bounds, nil
+}
+
+// edgeWriter keeps the first and the last edgeSize bytes written to it
+type edgeWriter struct {
+	head, tail []byte
+}
+
+func (e *edgeWriter) Write(p []byte) (int, error) {
+	if len(e.head) < edgeSize {
+		e.head = append(e.head, p[:min(edgeSize-len(e.head), len(p))]...)
+	}
+	e.tail = append(e.tail, p...)
+	if len(e.tail) > 2*edgeSize {
+		e.tail = append(e.tail[:0], e.tail[len(e.tail)-edgeSize:]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,42 @@
+package mpg123
+
+import (
+	"bytes"
+	"testing"
+)
+
+// silentFrame is an MPEG-1 Layer III frame at 128 kbit/s, 44100 Hz, joint
+// stereo, with zeroed side info and main data. It decodes to 1152 samples
+// of silence.
+func silentFrame() []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x40})
+	return frame
+}
+
+// silentMP3 returns a stream of n silent frames
+func silentMP3(n int) []byte {
+	return bytes.Repeat(silentFrame(), n)
+}
+
+// newTestDecoder returns a decoder that is deleted when the test ends, and
+// skips the test when libmpg123 cannot create one
+func newTestDecoder(t testing.TB) *Decoder {
+	t.Helper()
+	d, err := NewDecoder("")
+	if err != nil {
+		t.Skipf("libmpg123 not usable: %v", err)
+	}
+	t.Cleanup(d.Delete)
+	return d
+}
+
+// openSilence returns a decoder reading n silent frames with OpenReader
+func openSilence(t testing.TB, n int) *Decoder {
+	t.Helper()
+	d := newTestDecoder(t)
+	if err := d.OpenReader(bytes.NewReader(silentMP3(n))); err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	return d
+}
@@ -0,0 +1,129 @@
+// icy.go contains parsing of SHOUTcast/Icecast (ICY) in-stream metadata
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// ICYMeta is one block of in-stream metadata sent by an Icecast or SHOUTcast server
+type ICYMeta struct {
+	StreamTitle string
+	StreamURL   string
+	Raw         string // the complete metadata text, e.g. "StreamTitle='...';"
+}
+
+// ParseICYMeta parses a metadata block of the form "Key='value';Key2='value2';"
+func ParseICYMeta(raw string) ICYMeta {
+	raw = strings.TrimRight(raw, "\x00")
+	meta := ICYMeta{Raw: raw}
+	for len(raw) > 0 {
+		eq := strings.Index(raw, "='")
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(raw[:eq])
+		rest := raw[eq+2:]
+		// values may contain quotes, so the value ends at the next "';"
+		end := strings.Index(rest, "';")
+		if end < 0 {
+			end = strings.LastIndex(rest, "'")
+			if end < 0 {
+				end = len(rest)
+			}
+		}
+		value := rest[:end]
+		switch key {
+		case "StreamTitle":
+			meta.StreamTitle = value
+		case "StreamUrl":
+			meta.StreamURL = value
+		}
+		if end+2 > len(rest) {
+			break
+		}
+		raw = rest[end+2:]
+	}
+	return meta
+}
+
+// ICY returns the latest ICY metadata of the open stream and whether there
+// was any. For streams from OpenURL it is the block last sent by the
+// server; for streams libmpg123 reads itself, with the metadata interval
+// set through Param(ICY_INTERVAL, ...), it is what libmpg123 parsed.
+func (d *Decoder) ICY() (ICYMeta, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.icyMeta()
+}
+
+// icyMeta does the work of ICY. It is called with d locked.
+func (d *Decoder) icyMeta() (ICYMeta, bool) {
+	if d.icy != nil {
+		return *d.icy, true
+	}
+	var meta *C.char
+	if d.handle == nil || C.mpg123_icy(d.handle, &meta) != C.MPG123_OK || meta == nil {
+		return ICYMeta{}, false
+	}
+	return ParseICYMeta(icyText([]byte(C.GoString(meta)))), true
+}
+
+// ICY returns the latest ICY metadata of the stream being decoded, such as
+// the StreamTitle of the current song, and whether there was any yet
+func (dr DecoderReader) ICY() (ICYMeta, bool) {
+	return dr.decoder.ICY()
+}
+
+// icyReader removes metadata blocks interleaved every interval bytes from
+// the audio data of an ICY stream and passes them to onMeta
+type icyReader struct {
+	src      io.Reader
+	interval int
+	left     int // audio bytes until the next metadata block
+	onMeta   func(ICYMeta)
+}
+
+func newICYReader(src io.Reader, interval int, onMeta func(ICYMeta)) *icyReader {
+	return &icyReader{src: src, interval: interval, left: interval, onMeta: onMeta}
+}
+
+func (r *icyReader) Read(p []byte) (int, error) {
+	if r.left == 0 {
+		if err := r.readMeta(); err != nil {
+			return 0, err
+		}
+		r.left = r.interval
+	}
+	if len(p) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.src.Read(p)
+	r.left -= n
+	return n, err
+}
+
+// readMeta consumes one metadata block: a length byte (in units of 16 bytes)
+// followed by the text
+func (r *icyReader) readMeta() error {
+	var size [1]byte
+	if _, err := io.ReadFull(r.src, size[:]); err != nil {
+		return err
+	}
+	if size[0] == 0 {
+		return nil
+	}
+	block := make([]byte, int(size[0])*16)
+	if _, err := io.ReadFull(r.src, block); err != nil {
+		return err
+	}
+	if r.onMeta != nil {
+		r.onMeta(ParseICYMeta(icyText(bytes.TrimRight(block, "\x00"))))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// icytransport.go contains an http.RoundTripper handling ICY metadata, for
+// code reading radio streams through a plain http.Client
+
+package mpg123
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ICYTransport is an http.RoundTripper that asks servers for ICY metadata
+// and strips the metadata blocks from response bodies, so a client using it
+// reads the bare audio of Icecast/SHOUTcast streams. Requests already
+// carrying an Icy-MetaData header are passed on as they are.
+//
+//	client := &http.Client{Transport: &mpg123.ICYTransport{OnMeta: show}}
+type ICYTransport struct {
+	// Base makes the requests, http.DefaultTransport if nil
+	Base http.RoundTripper
+	// OnMeta is called from the goroutine reading the response body for
+	// every metadata block, with the request the response belongs to
+	OnMeta func(req *http.Request, m ICYMeta)
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *ICYTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Header.Get("Icy-MetaData") == "" {
+		// a RoundTripper must not modify the caller's request
+		req = req.Clone(req.Context())
+		req.Header.Set("Icy-MetaData", "1")
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	interval, err := strconv.Atoi(resp.Header.Get("Icy-Metaint"))
+	if err != nil || interval <= 0 {
+		return resp, nil
+	}
+	var onMeta func(ICYMeta)
+	if t.OnMeta != nil {
+		onMeta = func(m ICYMeta) { t.OnMeta(req, m) }
+	}
+	resp.Body = &icyBody{icyReader: newICYReader(resp.Body, interval, onMeta), body: resp.Body}
+	// the body no longer carries metadata, and no longer has the length sent
+	resp.Header.Del("Icy-Metaint")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return resp, nil
+}
+
+// icyBody is a response body with the ICY metadata stripped
+type icyBody struct {
+	*icyReader
+	body io.Closer
+}
+
+func (b *icyBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,189 @@
+// id3.go contains ID3, the ID3 tags of the opened stream as libmpg123
+// parsed them, so applications need no tag library of their own
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// ErrNoRawID3 is returned by RawID3 when the decoder does not keep raw tags
+var ErrNoRawID3 = errors.New("mpg123 error: raw tags not stored, set the STORE_RAW_ID3 flag before opening")
+
+// ID3Tag holds the common fields of the ID3 tags of a stream. Fields come
+// from the ID3v2 tag and are completed from the ID3v1 tag. All text is
+// UTF-8, whether the tag stored it as Latin-1, UTF-16 or UTF-8.
+type ID3Tag struct {
+	ID3v1   bool // the stream has an ID3v1 tag
+	ID3v2   bool // the stream has an ID3v2 tag
+	Version int  // major version of the ID3v2 tag: 2, 3 or 4
+	Title   string
+	Artist  string
+	Album   string
+	Year    string
+	Genre   string // genre name; ID3v1 codes and "(17)" style references are named from the ID3v1 table
+	GenreID int    // ID3v1 genre code the tag refers to, -1 if none
+	Comment string // the last comment frame of the ID3v2 tag, or the ID3v1 comment
+	Track   int    // track number from the TRCK frame or an ID3v1.1 tag, 0 if unknown
+
+	Comments []TextFrame // all COMM frames of the ID3v2 tag
+	Lyrics   []TextFrame // all USLT frames (unsynchronized lyrics) of the ID3v2 tag
+}
+
+// TextFrame is an ID3v2 frame carrying text with a language and a content
+// description, such as a comment or lyrics. A tag may hold several, told
+// apart by language and description.
+type TextFrame struct {
+	ID          string // frame ID, "COMM" or "USLT"
+	Lang        string // ISO 639-2 language code, e.g. "eng"; may be empty
+	Description string
+	Text        string
+}
+
+// ID3 returns the ID3 tags of the opened stream. Tags are read together
+// with the first frame, which ID3 reads if that has not happened yet, so in
+// feed mode it returns ErrFormatUnknown until enough data was fed. A stream
+// without tags gives a zero ID3Tag. A libmpg123 built without
+// FEATURE_PARSE_ID3V2 gives a *FeatureError.
+func (d *Decoder) ID3() (ID3Tag, error) {
+	if err := d.require(FEATURE_PARSE_ID3V2); err != nil {
+		return ID3Tag{}, err
+	}
+	if _, err := d.readFormat(); err != nil {
+		return ID3Tag{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.id3(), nil
+}
+
+// RawID3 returns the ID3v2 and ID3v1 tags of the opened stream exactly as
+// stored in it, headers included, for applications with a tag parser of
+// their own. Either is nil if the stream has no such tag. libmpg123 only
+// keeps them with the STORE_RAW_ID3 flag set before Open:
+//
+//	decoder.Param(mpg123.ADD_FLAGS, mpg123.STORE_RAW_ID3, 0)
+//
+// Like ID3, it reads the first frame if that has not happened yet. Before
+// libmpg123 1.26 it returns a *FeatureError for FEATURE_RAW_ID3.
+func (d *Decoder) RawID3() (v2 []byte, v1 []byte, err error) {
+	if err := d.require(FEATURE_RAW_ID3); err != nil {
+		return nil, nil, err
+	}
+	if _, err := d.readFormat(); err != nil {
+		return nil, nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return nil, nil, ErrDeleted
+	}
+	var flags C.long
+	var fval C.double
+	if C.mpg123_getparam(d.handle, C.MPG123_FLAGS, &flags, &fval) != C.MPG123_OK ||
+		flags&C.MPG123_STORE_RAW_ID3 == 0 {
+		return nil, nil, ErrNoRawID3
+	}
+	var p1, p2 *C.uchar
+	var n1, n2 C.size_t
+	if C.mpg123_id3_raw(d.handle, &p1, &n1, &p2, &n2) != C.MPG123_OK {
+		return nil, nil, fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	// copy, as libmpg123 frees the tags with the stream
+	if p2 != nil && n2 > 0 {
+		v2 = C.GoBytes(unsafe.Pointer(p2), C.int(n2))
+	}
+	if p1 != nil && n1 > 0 {
+		v1 = C.GoBytes(unsafe.Pointer(p1), C.int(n1))
+	}
+	return v2, v1, nil
+}
+
+// id3 collects the ID3Tag fields from mpg123_id3. The strings are copied,
+// as libmpg123 may free them on the next read. It is called with d locked.
+func (d *Decoder) id3() ID3Tag {
+	t := ID3Tag{GenreID: -1}
+	var v1 *C.mpg123_id3v1
+	var v2 *C.mpg123_id3v2
+	if d.handle == nil || C.mpg123_id3(d.handle, &v1, &v2) != C.MPG123_OK {
+		return t
+	}
+	if v2 != nil {
+		// libmpg123 converts the text to UTF-8 unless PLAIN_ID3TEXT is set
+		text := mpgString
+		if d.plainID3Text() {
+			text = id3Text
+		}
+		t.ID3v2 = true
+		t.Version = int(v2.version)
+		t.Title = text(v2.title)
+		t.Artist = text(v2.artist)
+		t.Album = text(v2.album)
+		t.Year = text(v2.year)
+		t.GenreID, t.Genre = genreRef(text(v2.genre))
+		t.Comment = text(v2.comment)
+		for _, f := range unsafe.Slice(v2.comment_list, int(v2.comments)) {
+			t.Comments = append(t.Comments, textFrame(&f, text))
+		}
+		for _, f := range unsafe.Slice(v2.text, int(v2.texts)) {
+			switch fixedField(f.id[:]) {
+			case "USLT":
+				t.Lyrics = append(t.Lyrics, textFrame(&f, text))
+			case "TRCK":
+				// "3" or "3/12"
+				number, _, _ := strings.Cut(text(&f.text), "/")
+				t.Track, _ = strconv.Atoi(strings.TrimSpace(number))
+			}
+		}
+	}
+	if v1 != nil {
+		t.ID3v1 = true
+		fill := func(s *string, field []C.char) {
+			if *s == "" {
+				*s = id3v1String(field)
+			}
+		}
+		fill(&t.Title, v1.title[:])
+		fill(&t.Artist, v1.artist[:])
+		fill(&t.Album, v1.album[:])
+		fill(&t.Year, v1.year[:])
+		fill(&t.Comment, v1.comment[:])
+		if name := GenreName(int(v1.genre)); t.Genre == "" && name != "" {
+			t.GenreID, t.Genre = int(v1.genre), name
+		}
+		// ID3v1.1 keeps the track number in the last byte of the comment,
+		// after a zero
+		if t.Track == 0 && v1.comment[28] == 0 {
+			t.Track = int(uint8(v1.comment[29]))
+		}
+	}
+	return t
+}
+
+// textFrame converts an mpg123_text, using text for its strings
+func textFrame(f *C.mpg123_text, text func(*C.mpg123_string) string) TextFrame {
+	return TextFrame{
+		ID:          fixedField(f.id[:]),
+		Lang:        fixedField(f.lang[:]),
+		Description: text(&f.description),
+		Text:        text(&f.text),
+	}
+}
+
+// fixedField converts a fixed size field of an mpg123_text, such as the frame
+// ID or language, which is not zero terminated when full
+func fixedField(field []C.char) string {
+	b := C.GoBytes(unsafe.Pointer(&field[0]), C.int(len(field)))
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,103 @@
+// info.go contains Info, the summary of an opened stream most applications
+// want right after Open
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"bytes"
+	"time"
+	"unsafe"
+)
+
+// Info summarizes an opened stream
+type Info struct {
+	Format      Format
+	Duration    time.Duration // playing time, 0 if the length is unknown
+	Samples     int64         // total PCM frames, -1 if unknown
+	Bytes       int64         // total bytes of decoded audio, -1 if unknown
+	Frames      int64         // total MPEG frames, -1 if unknown
+	Exact       bool          // the length comes from a Xing/Info header or Scan rather than an estimate
+	BitrateMode VBRMode
+	Bitrate     int // kbit/s of the current frame, the target bitrate for ABR
+	Tags        TagSummary
+}
+
+// TagSummary holds the most commonly shown tag fields, taken from the ID3v2
+// tag and completed from the ID3v1 tag
+type TagSummary struct {
+	ID3v1  bool // the stream has an ID3v1 tag
+	ID3v2  bool // the stream has an ID3v2 tag
+	Title  string
+	Artist string
+	Album  string
+}
+
+// Info returns the format, length, bitrate and tags of the opened stream.
+// It reads the first frame if that has not happened yet, so in feed mode it
+// returns ErrFormatUnknown until enough data was fed. The length is an
+// estimate for streams without a Xing/Info header unless Scan was called.
+func (d *Decoder) Info() (Info, error) {
+	f, err := d.readFormat()
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{
+		Format:  f,
+		Samples: d.LengthInPCMFrames(),
+		Frames:  int64(d.GetLengthInMPEGFrames()),
+		Bytes:   -1,
+	}
+	if info.Samples >= 0 {
+		info.Bytes = info.Samples * int64(f.BytesPerFrame())
+		if f.Rate > 0 {
+			info.Duration = time.Duration(info.Samples) * time.Second / time.Duration(f.Rate)
+		}
+	}
+	if accurate, _, err := d.State(ACCURATE); err == nil {
+		info.Exact = accurate != 0
+	}
+	if fi, err := d.FrameInfo(); err == nil {
+		info.BitrateMode = fi.VBR
+		info.Bitrate = fi.Bitrate
+		if fi.VBR == ABR {
+			info.Bitrate = fi.ABRRate
+		}
+	}
+	info.Tags = d.tagSummary()
+	return info, nil
+}
+
+// tagSummary collects the TagSummary fields from mpg123_id3
+func (d *Decoder) tagSummary() TagSummary {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tags()
+}
+
+// tags does the work of tagSummary. It is called with d locked.
+func (d *Decoder) tags() TagSummary {
+	t := d.id3()
+	return TagSummary{ID3v1: t.ID3v1, ID3v2: t.ID3v2, Title: t.Title, Artist: t.Artist, Album: t.Album}
+}
+
+// mpgString converts an mpg123_string, which may be nil, to a Go string
+func mpgString(s *C.mpg123_string) string {
+	if s == nil || s.p == nil || s.fill == 0 {
+		return ""
+	}
+	// fill counts the terminating zero
+	return C.GoStringN(s.p, C.int(s.fill-1))
+}
+
+// id3v1String converts a fixed size ID3v1 field, padded with zeros or
+// spaces, to a UTF-8 Go string
+func id3v1String(field []C.char) string {
+	b := C.GoBytes(unsafe.Pointer(&field[0]), C.int(len(field)))
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return latin1Text(bytes.TrimRight(b, " "))
+}
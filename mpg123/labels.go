@@ -0,0 +1,49 @@
+// labels.go contains pprof labels for the goroutines decoding a stream, so
+// CPU and block profiles of services decoding many streams attribute time to
+// each of them
+
+package mpg123
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"strconv"
+)
+
+// SetLabels adds pprof labels, given as key-value pairs, to those of the
+// decoder, e.g. SetLabels("station", name). Goroutines started by the
+// decoder, like the one of Stream, carry them along with the label
+// "mpg123.decoder" holding the decoder's ID; a key set again replaces the
+// earlier value. Goroutines already running keep the labels they started
+// with.
+func (d *Decoder) SetLabels(kv ...string) error {
+	if len(kv)%2 != 0 {
+		return fmt.Errorf("mpg123 error: odd number of label strings")
+	}
+	d.labelMu.Lock()
+	defer d.labelMu.Unlock()
+	d.labels = append(d.labels, kv...)
+	return nil
+}
+
+// labelSet returns the pprof labels of the decoder. The labels have their
+// own lock, as reads of the input start goroutines with d locked.
+func (d *Decoder) labelSet() pprof.LabelSet {
+	d.labelMu.Lock()
+	kv := append([]string{"mpg123.decoder", strconv.FormatUint(d.id, 10)}, d.labels...)
+	d.labelMu.Unlock()
+	return pprof.Labels(kv...)
+}
+
+// Do calls f with the decoder's pprof labels added to ctx and to the
+// current goroutine, for player and feed loops run outside the package
+func (d *Decoder) Do(ctx context.Context, f func(context.Context)) {
+	pprof.Do(ctx, d.labelSet(), f)
+}
+
+// goLabeled runs f in a new goroutine carrying the decoder's pprof labels
+func (d *Decoder) goLabeled(f func()) {
+	labels := d.labelSet()
+	go pprof.Do(context.Background(), labels, func(context.Context) { f() })
+}
@@ -0,0 +1,49 @@
+package mpg123
+
+import (
+	"context"
+	"runtime/pprof"
+	"sync"
+	"testing"
+)
+
+func TestSetLabels(t *testing.T) {
+	d := &Decoder{id: 7}
+	if err := d.SetLabels("station", "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetLabels("region", "eu", "station", "two"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetLabels("odd"); err == nil {
+		t.Error("SetLabels accepted an odd number of strings")
+	}
+	ctx := pprof.WithLabels(context.Background(), d.labelSet())
+	for key, want := range map[string]string{"mpg123.decoder": "7", "region": "eu", "station": "two"} {
+		if got, _ := pprof.Label(ctx, key); got != want {
+			t.Errorf("label %s: got %q, want %q", key, got, want)
+		}
+	}
+}
+
+// TestSetLabelsConcurrent sets labels while goroutines are started with
+// them. Run it with -race.
+func TestSetLabelsConcurrent(t *testing.T) {
+	d := &Decoder{}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			d.SetLabels("key", "value")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			d.goLabeled(wg.Done)
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,198 @@
+// length.go contains a consistency check of the stream length: what the
+// Xing/Info (or VBRI) header claims, what libmpg123 estimates and what a scan
+// of every frame finds, to catch truncated uploads and mis-tagged files
+
+package mpg123
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// LengthReport compares the lengths claimed for a stream with its scanned
+// length. Counts that are not available are -1.
+type LengthReport struct {
+	FileBytes       int64  // size of the input
+	HeaderKind      string // "Xing", "Info" or "VBRI", empty without such a header
+	HeaderFrames    int64  // MPEG frames claimed by the header
+	HeaderBytes     int64  // stream bytes claimed by the header
+	EstimatedFrames int64  // frames libmpg123 assumed before the scan
+	ScannedFrames   int64  // frames found by scanning the whole stream
+	ScannedSamples  int64  // PCM frames found by the scan
+	Problems        []string
+}
+
+// OK reports whether all lengths agree
+func (r *LengthReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *LengthReport) String() string {
+	s := fmt.Sprintf("%d bytes, header %q %d frames/%d bytes, estimate %d frames, scan %d frames",
+		r.FileBytes, r.HeaderKind, r.HeaderFrames, r.HeaderBytes, r.EstimatedFrames, r.ScannedFrames)
+	for _, p := range r.Problems {
+		s += "; " + p
+	}
+	return s
+}
+
+// estimateTolerance is the relative difference between the estimated and
+// scanned frame counts reported for streams without a length header
+const estimateTolerance = 0.01
+
+// headProbeSize is how much of the start of the input is searched for the
+// length header
+const headProbeSize = 64 << 10
+
+// CheckLength compares the length claimed in the Xing/Info or VBRI header of
+// the stream in r, the estimate libmpg123 makes when opening it and the
+// length found by scanning every frame, and lists the discrepancies in the
+// report. A header claiming more frames or bytes than there are is the
+// typical sign of a truncated file.
+func CheckLength(r io.ReadSeeker) (*LengthReport, error) {
+	rep := &LengthReport{HeaderFrames: -1, HeaderBytes: -1}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	rep.FileBytes = size
+	// skip an ID3v2 tag, which may be larger than the probe with cover art
+	var id3 [10]byte
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, id3[:]); err == nil && string(id3[:3]) == "ID3" {
+		// the tag size is syncsafe, 7 bits per byte, excluding the 10 byte header
+		skip := 10 + (int64(id3[6])<<21 | int64(id3[7])<<14 | int64(id3[8])<<7 | int64(id3[9]))
+		if id3[5]&0x10 != 0 {
+			skip += 10 // footer
+		}
+		if _, err := r.Seek(skip, io.SeekStart); err != nil {
+			return nil, err
+		}
+	} else if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	head := make([]byte, headProbeSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	rep.HeaderKind, rep.HeaderFrames, rep.HeaderBytes = parseLengthHeader(head[:n])
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	d, err := NewDecoder("")
+	if err != nil {
+		return nil, err
+	}
+	defer d.Delete()
+	if err := d.OpenReader(r); err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	rep.EstimatedFrames = int64(d.GetLengthInMPEGFrames())
+	if err := d.Scan(); err != nil {
+		return nil, err
+	}
+	rep.ScannedFrames = int64(d.GetLengthInMPEGFrames())
+	rep.ScannedSamples = d.LengthInPCMFrames()
+
+	switch {
+	case rep.HeaderFrames > 0 && rep.HeaderFrames > rep.ScannedFrames:
+		rep.Problems = append(rep.Problems, fmt.Sprintf("%s header claims %d frames, scan found %d: truncated?", rep.HeaderKind, rep.HeaderFrames, rep.ScannedFrames))
+	case rep.HeaderFrames > 0 && rep.HeaderFrames < rep.ScannedFrames:
+		rep.Problems = append(rep.Problems, fmt.Sprintf("%s header claims %d frames, scan found %d: appended audio or stale header", rep.HeaderKind, rep.HeaderFrames, rep.ScannedFrames))
+	case rep.HeaderFrames < 0 && rep.EstimatedFrames > 0 && rep.ScannedFrames > 0:
+		diff := float64(rep.EstimatedFrames-rep.ScannedFrames) / float64(rep.ScannedFrames)
+		if diff > estimateTolerance || diff < -estimateTolerance {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("no length header and the estimate of %d frames is off by %.1f%% (VBR?)", rep.EstimatedFrames, diff*100))
+		}
+	}
+	if rep.HeaderBytes > 0 && rep.HeaderBytes > rep.FileBytes {
+		rep.Problems = append(rep.Problems, fmt.Sprintf("%s header claims %d bytes, the input has %d: truncated?", rep.HeaderKind, rep.HeaderBytes, rep.FileBytes))
+	}
+	if rep.ScannedFrames == 0 {
+		rep.Problems = append(rep.Problems, "no MPEG frames found")
+	}
+	return rep, nil
+}
+
+// parseLengthHeader finds the first MPEG frame in head and reads the frame
+// and byte counts of a Xing/Info or VBRI header in it. Missing counts are -1.
+func parseLengthHeader(head []byte) (kind string, frames int64, bytes int64) {
+	frames, bytes = -1, -1
+	for pos := 0; pos+4 <= len(head); pos++ {
+		layer3, ok := mpegHeaderAt(head, pos)
+		if !ok {
+			continue
+		}
+		if !layer3 {
+			// only Layer III streams carry these headers
+			return "", -1, -1
+		}
+		kind, x := lengthTagAt(head, pos)
+		switch kind {
+		case "Xing", "Info":
+			flags := binary.BigEndian.Uint32(head[x+4:])
+			off := x + 8
+			if flags&1 != 0 {
+				frames = int64(binary.BigEndian.Uint32(head[off:]))
+				off += 4
+			}
+			if flags&2 != 0 && off+4 <= len(head) {
+				bytes = int64(binary.BigEndian.Uint32(head[off:]))
+			}
+		case "VBRI":
+			bytes = int64(binary.BigEndian.Uint32(head[x+10:]))
+			frames = int64(binary.BigEndian.Uint32(head[x+14:]))
+		}
+		return kind, frames, bytes
+	}
+	return "", -1, -1
+}
+
+// mpegHeaderAt reports whether b holds a valid MPEG audio frame header at
+// pos, and whether it is Layer III
+func mpegHeaderAt(b []byte, pos int) (layer3 bool, ok bool) {
+	if pos+4 > len(b) || b[pos] != 0xff || b[pos+1]&0xe0 != 0xe0 {
+		return false, false
+	}
+	header := binary.BigEndian.Uint32(b[pos:])
+	version := header >> 19 & 3
+	layer := header >> 17 & 3
+	if version == 1 || layer == 0 || header>>12&15 == 15 || header>>10&3 == 3 {
+		return false, false
+	}
+	return layer == 1, true
+}
+
+// lengthTagAt returns the kind ("Xing", "Info" or "VBRI") and the offset in
+// b of the length header in the Layer III frame at pos, or "" if the frame
+// has none or b ends before the header fields
+func lengthTagAt(b []byte, pos int) (kind string, off int) {
+	header := binary.BigEndian.Uint32(b[pos:])
+	mono := header>>6&3 == 3
+	var side int
+	switch {
+	case header>>19&3 == 3 && mono:
+		side = 17
+	case header>>19&3 == 3:
+		side = 32
+	case mono:
+		side = 9
+	default:
+		side = 17
+	}
+	if x := pos + 4 + side; x+16 <= len(b) {
+		if tag := string(b[x : x+4]); tag == "Xing" || tag == "Info" {
+			return tag, x
+		}
+	}
+	if v := pos + 4 + 32; v+18 <= len(b) && string(b[v:v+4]) == "VBRI" {
+		return "VBRI", v
+	}
+	return "", 0
+}
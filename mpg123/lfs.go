@@ -0,0 +1,14 @@
+//go:build !windows
+
+// lfs.go makes the build fail if off_t is narrower than the int64 offsets
+// used by Seek, Tell and the length functions, for example when building for
+// a 32 bit platform without _FILE_OFFSET_BITS=64 (see mpg123.go)
+
+package mpg123
+
+// #include <sys/types.h>
+import "C"
+
+import "unsafe"
+
+var _ [unsafe.Sizeof(C.off_t(0)) - 8]byte
@@ -0,0 +1,115 @@
+// loop.go contains A-B looping: Read plays a region of the stream over and
+// over, jumping from its end back to its start without a gap, for practice
+// and language learning players
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// loopPreroll is the least number of MPEG frames decoded ahead of the loop
+// start when wrapping around. Loop starts lie mid-stream, where audio
+// decoded without the bit reservoir of the frames before is garbled.
+const loopPreroll = 2
+
+// loopState is the region set by SetLoop
+type loopState struct {
+	a, b  int64 // start and end sample offsets, b exclusive
+	count int   // wraparounds so far
+}
+
+// SetLoop makes Read loop over the samples [a, b): when the position reaches
+// b, or the end of the stream if that comes first, Read continues at a,
+// ending the read at b so the jump falls between two reads. The position
+// is not changed, so playback reaches the loop from where it is; a position
+// beyond b jumps to a on the next Read. Loop points are sample accurate when
+// seeking is (gapless decoding and a known stream length).
+func (d *Decoder) SetLoop(a int64, b int64) error {
+	if a < 0 || b <= a {
+		return fmt.Errorf("mpg123 error: invalid loop %d-%d", a, b)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.loop = &loopState{a: a, b: b}
+	return nil
+}
+
+// SetLoopTime is SetLoop with the region given as times from the start of
+// the stream
+func (d *Decoder) SetLoopTime(a time.Duration, b time.Duration) error {
+	sa, err := d.SamplesAt(a)
+	if err != nil {
+		return err
+	}
+	sb, err := d.SamplesAt(b)
+	if err != nil {
+		return err
+	}
+	return d.SetLoop(sa, sb)
+}
+
+// ClearLoop ends looping; Read plays on past the loop end
+func (d *Decoder) ClearLoop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.loop = nil
+}
+
+// Loops returns how often Read jumped back to the loop start since SetLoop
+func (d *Decoder) Loops() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.loop == nil {
+		return 0
+	}
+	return d.loop.count
+}
+
+// loopLimit shortens a read of size bytes to end at the loop end, first
+// jumping back to the loop start if the position is past it. It is called
+// with d locked.
+func (d *Decoder) loopLimit(size int) (int, error) {
+	if d.loop == nil {
+		return size, nil
+	}
+	rate, channels, enc := d.getFormat()
+	frameSize := (Format{rate, channels, enc}).BytesPerFrame()
+	if frameSize <= 0 {
+		return size, nil
+	}
+	pos := int64(C.mpg123_tell(d.handle)) - d.primedFrames()
+	if pos >= d.loop.b {
+		if err := d.loopWrap(); err != nil {
+			return 0, err
+		}
+		pos = d.loop.a
+	}
+	if left := (d.loop.b - pos) * int64(frameSize); left < int64(size) {
+		size = int(left)
+	}
+	return size, nil
+}
+
+// loopWrap jumps back to the loop start, decoding at least loopPreroll
+// frames ahead of it. Unlike Seek, it keeps fades and pacing running, so the
+// jump is seamless. It is called with d locked.
+func (d *Decoder) loopWrap() error {
+	d.primed = nil
+	s := int64(C.mpg123_seek(d.handle, C.off_t(d.loop.a), C.int(io.SeekStart)))
+	if s < 0 {
+		return fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	if _, err := d.prerollFrames(s, max(d.preroll, loopPreroll)); err != nil {
+		return err
+	}
+	d.resetPacing()
+	d.resetConceal()
+	d.loop.count++
+	return nil
+}
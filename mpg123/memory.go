@@ -0,0 +1,67 @@
+// memory.go contains MemoryUsage, an estimate of the memory one decoder
+// holds, for sizing services that run thousands of streams
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import "unsafe"
+
+// handleBytes is a rough figure for what libmpg123 allocates per handle
+// besides the buffers reported separately: the decoder state with its
+// synthesis and hybrid filter buffers and the bit reservoir
+const handleBytes = 64 << 10
+
+// MemoryUsage estimates the memory held by a decoder, in bytes
+type MemoryUsage struct {
+	Handle   int64 // libmpg123 handle and frame buffers, a fixed estimate
+	Output   int64 // output buffer of one decoded frame, mpg123_outblock
+	Feed     int64 // input fed and not decoded yet
+	FeedPool int64 // upper bound of the spare feed buffers libmpg123 keeps for reuse
+	Index    int64 // frame index used for seeking
+	Go       int64 // buffers on the Go side: primed and processed audio, concealment and chained stream state
+}
+
+// Total returns the sum of the estimates
+func (m MemoryUsage) Total() int64 {
+	return m.Handle + m.Output + m.Feed + m.FeedPool + m.Index + m.Go
+}
+
+// MemoryUsage returns an estimate of the memory the decoder holds. Input
+// and index buffers change as the stream is decoded; the rest is fixed once
+// the format is known.
+func (d *Decoder) MemoryUsage() MemoryUsage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return MemoryUsage{}
+	}
+	m := MemoryUsage{
+		Handle: handleBytes,
+		Output: int64(C.mpg123_outblock(d.handle)),
+	}
+	var val, pool C.long
+	var fval C.double
+	if C.mpg123_getstate(d.handle, C.MPG123_BUFFERFILL, &val, &fval) == C.MPG123_OK {
+		m.Feed = int64(val)
+	}
+	if C.mpg123_getparam(d.handle, C.MPG123_FEEDPOOL, &pool, &fval) == C.MPG123_OK &&
+		C.mpg123_getparam(d.handle, C.MPG123_FEEDBUFFER, &val, &fval) == C.MPG123_OK {
+		m.FeedPool = int64(pool) * int64(val)
+	}
+	var offsets *C.off_t
+	var step C.off_t
+	var fill C.size_t
+	if C.mpg123_index(d.handle, &offsets, &step, &fill) == C.MPG123_OK {
+		m.Index = int64(fill) * int64(unsafe.Sizeof(*offsets))
+	}
+	m.Go = int64(cap(d.primed) + cap(d.dspOut) + len(d.dspSpans)*int(unsafe.Sizeof(dspSpan{})))
+	if d.conceal != nil {
+		m.Go += int64(cap(d.conceal.last))
+	}
+	if d.chain != nil {
+		m.Go += int64(cap(d.chain.tail) + 8*cap(d.chain.starts))
+	}
+	return m
+}
@@ -0,0 +1,58 @@
+// meta.go contains MetaCheck and the metadata events, telling long running
+// stream decoders that the tags or ICY metadata changed while decoding
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+// Metadata flags returned by MetaCheck
+const (
+	NEW_ID3 = C.MPG123_NEW_ID3 // ID3 tags changed since they were last fetched with ID3
+	NEW_ICY = C.MPG123_NEW_ICY // ICY metadata changed since it was last fetched with ICY
+	ID3     = C.MPG123_ID3     // the stream has ID3 tags
+	ICY     = C.MPG123_ICY     // the stream has ICY metadata
+)
+
+// MetaCheck returns the metadata flags of the open stream, an or of
+// NEW_ID3, NEW_ICY, ID3 and ICY. The NEW_ flags stay set until the data is
+// fetched with ID3 or ICY, so a decoder polling between reads sees each
+// change once. Subscribing to EventMeta fetches the data for the events,
+// which clears the flags before MetaCheck sees them.
+func (d *Decoder) MetaCheck() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0
+	}
+	return int(C.mpg123_meta_check(d.handle))
+}
+
+// checkMeta reports metadata that appeared during a decode call. The flags
+// stay set until the data is fetched, so it only reports when they appear;
+// with EventMeta subscribers the data is fetched for them, clearing the
+// flags so the next change is reported again. It is called with d locked.
+func (d *Decoder) checkMeta() {
+	meta := C.mpg123_meta_check(d.handle) & (C.MPG123_NEW_ID3 | C.MPG123_NEW_ICY)
+	if meta != 0 && !d.metaSeen {
+		d.logger().Info("metadata updated",
+			"id3", meta&C.MPG123_NEW_ID3 != 0, "icy", meta&C.MPG123_NEW_ICY != 0)
+		if d.subscribed(EventMeta) {
+			e := Event{Kind: EventMeta}
+			if meta&C.MPG123_NEW_ID3 != 0 {
+				tag := d.id3()
+				e.ID3 = &tag
+			}
+			var icy *C.char
+			if meta&C.MPG123_NEW_ICY != 0 && C.mpg123_icy(d.handle, &icy) == C.MPG123_OK && icy != nil {
+				m := ParseICYMeta(icyText([]byte(C.GoString(icy))))
+				e.ICY = &m
+			}
+			d.emit(e)
+			meta = C.mpg123_meta_check(d.handle) & (C.MPG123_NEW_ID3 | C.MPG123_NEW_ICY)
+		} else {
+			d.emit(Event{Kind: EventMeta})
+		}
+	}
+	d.metaSeen = meta != 0
+}
@@ -0,0 +1,63 @@
+// metadata.go contains Metadata, the tags of a stream from whichever of
+// ID3v2, ID3v1 and ICY metadata it carries, in one struct
+
+package mpg123
+
+// Metadata describes the content of a stream, taking every field from the
+// best source present: the ID3v2 tag, then the ID3v1 tag, then for radio
+// streams the ICY metadata. Fields a stream does not provide keep their
+// zero value: empty strings and slices, a Track of 0 and false flags.
+type Metadata struct {
+	Title   string // ID3 title, or the StreamTitle of a radio stream
+	Artist  string
+	Album   string
+	Year    string
+	Genre   string
+	Comment string
+	Track   int    // track number, 0 if unknown
+	URL     string // StreamUrl of a radio stream
+
+	Comments []TextFrame // all COMM frames of the ID3v2 tag
+	Lyrics   []TextFrame // all USLT frames of the ID3v2 tag
+
+	HasID3v1 bool
+	HasID3v2 bool
+	HasICY   bool
+	Version  int // major version of the ID3v2 tag, 0 without one
+}
+
+// Metadata returns the metadata of the opened stream. Like ID3, it reads
+// the first frame if that has not happened yet, so in feed mode it returns
+// ErrFormatUnknown until enough data was fed. For radio streams the ICY
+// fields follow the stream as it plays, so call it again for the current
+// song.
+func (d *Decoder) Metadata() (Metadata, error) {
+	if _, err := d.readFormat(); err != nil {
+		return Metadata{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t := d.id3()
+	m := Metadata{
+		Title:    t.Title,
+		Artist:   t.Artist,
+		Album:    t.Album,
+		Year:     t.Year,
+		Genre:    t.Genre,
+		Comment:  t.Comment,
+		Track:    t.Track,
+		Comments: t.Comments,
+		Lyrics:   t.Lyrics,
+		HasID3v1: t.ID3v1,
+		HasID3v2: t.ID3v2,
+		Version:  t.Version,
+	}
+	if icy, ok := d.icyMeta(); ok {
+		m.HasICY = true
+		m.URL = icy.StreamURL
+		if m.Title == "" {
+			m.Title = icy.StreamTitle
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,127 @@
+// metrics.go contains the package-level expvar metrics. They are published
+// under the "mpg123" name and show up on /debug/vars when expvar's handler
+// is registered, so long-running services can watch decoder use without
+// wrapping every call. Per-decoder figures are passed to an Observer, which
+// the prommetrics package uses to feed Prometheus.
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"expvar"
+	"strconv"
+	"time"
+)
+
+var (
+	metrics = expvar.NewMap("mpg123")
+
+	// live decoder handles, from NewDecoder until Delete
+	metricHandles = new(expvar.Int)
+	// open input streams, from a successful Open* until Close
+	metricStreams = new(expvar.Int)
+	// total bytes of decoded audio returned to callers
+	metricBytes = new(expvar.Int)
+	// errors reported by libmpg123, keyed by error code
+	metricErrors = new(expvar.Map).Init()
+)
+
+func init() {
+	metrics.Set("handles", metricHandles)
+	metrics.Set("streams", metricStreams)
+	metrics.Set("bytes_decoded", metricBytes)
+	metrics.Set("errors", metricErrors)
+}
+
+// countError records an error code in the errors metric
+func countError(code C.int) {
+	metricErrors.Add(strconv.Itoa(int(code)), 1)
+}
+
+// Stats is a snapshot of the package-level metrics
+type Stats struct {
+	Handles      int64         // live decoder handles
+	Streams      int64         // open input streams
+	BytesDecoded int64         // total bytes of decoded audio
+	Errors       map[int]int64 // error counts by libmpg123 error code
+}
+
+// ReadStats returns the current values of the package-level metrics
+func ReadStats() Stats {
+	s := Stats{
+		Handles:      metricHandles.Value(),
+		Streams:      metricStreams.Value(),
+		BytesDecoded: metricBytes.Value(),
+		Errors:       make(map[int]int64),
+	}
+	metricErrors.Do(func(kv expvar.KeyValue) {
+		code, err := strconv.Atoi(kv.Key)
+		if v, ok := kv.Value.(*expvar.Int); ok && err == nil {
+			s.Errors[code] = v.Value()
+		}
+	})
+	return s
+}
+
+// Observer is told about every decode call made on a decoder: the number of
+// bytes of audio it produced, how long it took and whether libmpg123
+// reported an error. It is called with the decoder locked, so it must not
+// call back into the decoder.
+type Observer interface {
+	ObserveDecode(n int, took time.Duration, failed bool)
+}
+
+// SetObserver sets the observer for decode calls on d. Passing nil removes it.
+func (d *Decoder) SetObserver(o Observer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.observer = o
+}
+
+// decoded records a decode call that started at start, produced n bytes and
+// returned code, in the metrics and the event log
+func (d *Decoder) decoded(start time.Time, n int, code C.int) {
+	d.events(code)
+	d.chainOutput(n)
+	if n > 0 {
+		metricBytes.Add(int64(n))
+	}
+	if d.observer != nil {
+		failed := code != C.MPG123_OK && code != C.MPG123_DONE &&
+			code != C.MPG123_NEW_FORMAT && code != C.MPG123_NEED_MORE
+		d.observer.ObserveDecode(n, time.Since(start), failed)
+	}
+}
+
+// streamOpened marks the decoder's input as open, once per stream. The
+// cached output format belongs to the previous stream, so it is dropped, and
+// the pacing clock restarts.
+func (d *Decoder) streamOpened() {
+	d.formatKnown = false
+	d.primed = nil
+	d.chain.reset()
+	d.resetPacing()
+	d.restartFade()
+	d.resetDSP()
+	d.watchReset()
+	d.resetConceal()
+	d.source = sourceKey{}
+	d.icy = nil
+	d.inputErr = nil
+	if !d.streaming {
+		d.streaming = true
+		metricStreams.Add(1)
+	}
+}
+
+// streamClosed undoes streamOpened
+func (d *Decoder) streamClosed() {
+	d.formatKnown = false
+	d.primed = nil
+	if d.streaming {
+		d.streaming = false
+		metricStreams.Add(-1)
+	}
+}
@@ -0,0 +1,201 @@
+// mixer.go contains a mixer summing several PCM sources, typically decoders,
+// into one stream, for multi-track playback and layering sound effects over
+// music
+
+package mpg123
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// Mixer is an io.Reader producing the sum of its inputs in one output
+// format. Inputs in another format are adapted: resampled with a Resampler,
+// mixed down or spread to the output channels and converted to the output
+// encoding. Integer output is clipped. Inputs can be added, removed and
+// have their gain changed while the mixer is read from another goroutine.
+type Mixer struct {
+	mu     sync.Mutex
+	format Format
+	codec  *sampleCodec
+	inputs []*MixInput
+	acc    []float64 // sum of the current read, interleaved
+}
+
+// MixInput is one source of a Mixer
+type MixInput struct {
+	m        *Mixer
+	src      io.Reader // audio at the mixer's rate
+	codec    *sampleCodec
+	channels int
+	gain     float64 // linear
+	buf      []byte
+}
+
+// NewMixer returns a Mixer producing audio in format f
+func NewMixer(f Format) (*Mixer, error) {
+	if f.Rate <= 0 || f.Channels <= 0 {
+		return nil, fmt.Errorf("mpg123 error: invalid mixer format %v", f)
+	}
+	c, err := codecFor(f.Encoding, nativeEndian)
+	if err != nil {
+		return nil, err
+	}
+	return &Mixer{format: f, codec: c}, nil
+}
+
+// Format returns the output format of the mixer
+func (m *Mixer) Format() Format {
+	return m.format
+}
+
+// Add mixes in the PCM audio read from r, in format f, at gain dB (0 keeps
+// the level). The input is dropped from the mix at the end of r. Samples
+// are in host byte order.
+func (m *Mixer) Add(r io.Reader, f Format, gain float64) (*MixInput, error) {
+	return m.add(r, f, nativeEndian, gain)
+}
+
+// add mixes in the audio read from r with samples in the given byte order
+func (m *Mixer) add(r io.Reader, f Format, order binary.ByteOrder, gain float64) (*MixInput, error) {
+	if f.Rate <= 0 || f.Channels <= 0 {
+		return nil, fmt.Errorf("mpg123 error: invalid mixer input format %v", f)
+	}
+	c, err := codecFor(f.Encoding, order)
+	if err != nil {
+		return nil, err
+	}
+	if f.Rate != m.format.Rate {
+		if r, err = newResampler(r, f.Rate, m.format.Rate, f.Channels, f.Encoding, order); err != nil {
+			return nil, err
+		}
+	}
+	in := &MixInput{m: m, src: r, codec: c, channels: f.Channels, gain: math.Pow(10, gain/20)}
+	m.mu.Lock()
+	m.inputs = append(m.inputs, in)
+	m.mu.Unlock()
+	return in, nil
+}
+
+// AddDecoder mixes in the audio of d, an opened decoder, at gain dB. Its
+// output format must not change while it is mixed.
+func (m *Mixer) AddDecoder(d *Decoder, gain float64) (*MixInput, error) {
+	f, err := d.readFormat()
+	if err != nil {
+		return nil, err
+	}
+	return m.add(d, f, d.ByteOrder(), gain)
+}
+
+// SetGain changes the gain of the input to gain dB
+func (in *MixInput) SetGain(gain float64) {
+	in.m.mu.Lock()
+	in.gain = math.Pow(10, gain/20)
+	in.m.mu.Unlock()
+}
+
+// Remove takes the input out of the mix
+func (in *MixInput) Remove() {
+	in.m.mu.Lock()
+	defer in.m.mu.Unlock()
+	in.m.remove(in)
+}
+
+// remove drops in from the inputs. It is called with m locked.
+func (m *Mixer) remove(in *MixInput) {
+	for i, t := range m.inputs {
+		if t == in {
+			m.inputs = append(m.inputs[:i:i], m.inputs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Read fills p with whole frames of the mix. A read lasts as long as the
+// longest input provides audio; inputs ending sooner contribute silence. An
+// input failing with an error other than io.EOF is dropped and the error
+// returned with the mix of the others. Read returns io.EOF once no inputs
+// are left.
+func (m *Mixer) Read(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	frameSize := m.codec.size * m.format.Channels
+	frames := len(p) / frameSize
+	if frames == 0 {
+		return 0, io.ErrShortBuffer
+	}
+	if len(m.inputs) == 0 {
+		return 0, io.EOF
+	}
+	if need := frames * m.format.Channels; cap(m.acc) < need {
+		m.acc = make([]float64, need)
+	}
+	acc := m.acc[:frames*m.format.Channels]
+	clear(acc)
+	mixed := 0
+	var failed error
+	for _, in := range append([]*MixInput(nil), m.inputs...) {
+		n, err := in.mix(acc, m.format.Channels, frames)
+		mixed = max(mixed, n)
+		if err != nil {
+			m.remove(in)
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) && failed == nil {
+				failed = err
+			}
+		}
+	}
+	if mixed == 0 && failed == nil && len(m.inputs) == 0 {
+		return 0, io.EOF
+	}
+	size := m.codec.size
+	for i, v := range acc[:mixed*m.format.Channels] {
+		m.codec.put(p[i*size:], v)
+	}
+	return mixed * frameSize, failed
+}
+
+// mix reads up to frames frames from the input and adds them to acc, which
+// has outChannels channels, and returns the number of frames added
+func (in *MixInput) mix(acc []float64, outChannels int, frames int) (int, error) {
+	size := in.codec.size
+	frameSize := size * in.channels
+	if need := frames * frameSize; cap(in.buf) < need {
+		in.buf = make([]byte, need)
+	}
+	buf := in.buf[:frames*frameSize]
+	n, err := io.ReadFull(in.src, buf)
+	got := n / frameSize
+	for f := 0; f < got; f++ {
+		frame := buf[f*frameSize:]
+		out := acc[f*outChannels:]
+		switch {
+		case in.channels == outChannels:
+			for ch := 0; ch < outChannels; ch++ {
+				out[ch] += in.gain * in.codec.get(frame[ch*size:])
+			}
+		case outChannels == 1:
+			// mix down
+			var sum float64
+			for ch := 0; ch < in.channels; ch++ {
+				sum += in.codec.get(frame[ch*size:])
+			}
+			out[0] += in.gain * sum / float64(in.channels)
+		case in.channels == 1:
+			// spread mono to every channel
+			v := in.gain * in.codec.get(frame)
+			for ch := 0; ch < outChannels; ch++ {
+				out[ch] += v
+			}
+		default:
+			// map channels by position, leaving the extra ones silent
+			for ch := 0; ch < min(in.channels, outChannels); ch++ {
+				out[ch] += in.gain * in.codec.get(frame[ch*size:])
+			}
+		}
+	}
+	return got, err
+}
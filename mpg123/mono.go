@@ -0,0 +1,118 @@
+// mono.go contains the stereo to mono downmix, done either by mpg123 itself
+// or as a post-processing step in Go
+
+package mpg123
+
+import (
+	"fmt"
+	"math"
+)
+
+// MonoMode selects how (and if) decoded audio is mixed down to a single channel.
+type MonoMode int
+
+const (
+	// MonoOff keeps the channel layout of the stream
+	MonoOff MonoMode = iota
+	// MonoDecoder lets mpg123 mix the channels (MPG123_MONO_MIX). The output
+	// format must allow one channel, see Format.
+	MonoDecoder
+	// MonoGo decodes all channels and averages them in Go before Read returns.
+	MonoGo
+	// MonoAuto uses MonoDecoder and falls back to MonoGo if the negotiated
+	// output format still has more than one channel, for example because
+	// the allowed formats have no mono entry.
+	MonoAuto
+)
+
+// SetMono selects the downmix mode used for this decoder.
+// With MonoGo, Read returns one channel even though GetFormat still reports
+// the channel count of the stream.
+func (d *Decoder) SetMono(mode MonoMode) error {
+	goMono := false
+	var err error
+	switch mode {
+	case MonoOff:
+		err = d.Param(REMOVE_FLAGS, FORCE_MONO, 0)
+	case MonoDecoder:
+		err = d.Param(ADD_FLAGS, MONO_MIX, 0)
+	case MonoGo:
+		goMono = true
+		err = d.Param(REMOVE_FLAGS, FORCE_MONO, 0)
+	case MonoAuto:
+		// whether mpg123 mixed is only known from the output format, and
+		// downmix leaves output that is already mono alone
+		goMono = true
+		err = d.Param(ADD_FLAGS, MONO_MIX, 0)
+	default:
+		return fmt.Errorf("mpg123 error: unknown mono mode %d", mode)
+	}
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.goMono = goMono
+	d.mu.Unlock()
+	return nil
+}
+
+// downmix averages interleaved samples in buf in place and returns the
+// number of mono bytes at the start of buf. It is called with d locked.
+func (d *Decoder) downmix(buf []byte) (int, error) {
+	_, channels, enc := d.getFormat()
+	if channels <= 1 {
+		return len(buf), nil
+	}
+	c, err := codecFor(enc, d.byteOrder())
+	if err != nil {
+		return 0, fmt.Errorf("mpg123 error: cannot downmix encoding %v", Encoding(enc))
+	}
+	return downmixBytes(buf, channels, c.size, c.get, c.put), nil
+}
+
+func downmixBytes(buf []byte, channels int, size int, get func([]byte) float64, put func([]byte, float64)) int {
+	frameSize := channels * size
+	frames := len(buf) / frameSize
+	for i := 0; i < frames; i++ {
+		var sum float64
+		for ch := 0; ch < channels; ch++ {
+			off := i*frameSize + ch*size
+			sum += get(buf[off : off+size])
+		}
+		put(buf[i*size:(i+1)*size], sum/float64(channels))
+	}
+	return frames * size
+}
+
+// DownmixInt16 averages interleaved 16 bit samples into a single channel.
+// Averaging keeps the result within range, so the mix never clips.
+func DownmixInt16(samples []int16, channels int) []int16 {
+	if channels <= 0 {
+		return nil
+	}
+	out := make([]int16, len(samples)/channels)
+	for i := range out {
+		var sum int32
+		for _, s := range samples[i*channels : (i+1)*channels] {
+			sum += int32(s)
+		}
+		out[i] = int16(math.Round(float64(sum) / float64(channels)))
+	}
+	return out
+}
+
+// DownmixFloat32 averages interleaved float samples into a single channel.
+func DownmixFloat32(samples []float32, channels int) []float32 {
+	if channels <= 0 {
+		return nil
+	}
+	out := make([]float32, len(samples)/channels)
+	for i := range out {
+		var sum float64
+		for _, s := range samples[i*channels : (i+1)*channels] {
+			sum += float64(s)
+		}
+		out[i] = float32(sum / float64(channels))
+	}
+	return out
+}
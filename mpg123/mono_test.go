@@ -0,0 +1,48 @@
+package mpg123
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// TestMonoModes checks that MonoGo and MonoAuto give one channel whether or
+// not mpg123 did the mix itself
+func TestMonoModes(t *testing.T) {
+	for _, mode := range []MonoMode{MonoGo, MonoAuto} {
+		d := newTestDecoder(t)
+		if err := d.SetMono(mode); err != nil {
+			t.Fatalf("SetMono(%d): %v", mode, err)
+		}
+		if err := d.OpenReader(bytes.NewReader(silentMP3(10))); err != nil {
+			t.Fatalf("OpenReader: %v", err)
+		}
+		pcm, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatalf("mode %d: ReadAll: %v", mode, err)
+		}
+		if want := 10 * 1152 * 2; len(pcm) != want {
+			t.Errorf("mode %d: got %d bytes, want %d of mono audio", mode, len(pcm), want)
+		}
+	}
+}
+
+// TestDownmixRounding checks that DownmixInt16 and the downmix of Read
+// round the same way
+func TestDownmixRounding(t *testing.T) {
+	for _, stereo := range [][2]int16{{1, 2}, {-1, -2}, {3, 4}, {32767, 32766}, {-32768, -32767}, {0, 1}} {
+		want := DownmixInt16(stereo[:], 2)[0]
+		buf := make([]byte, 4)
+		binary.LittleEndian.PutUint16(buf, uint16(stereo[0]))
+		binary.LittleEndian.PutUint16(buf[2:], uint16(stereo[1]))
+		c, err := codecFor(ENC_SIGNED_16, binary.LittleEndian)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := downmixBytes(buf, 2, c.size, c.get, c.put)
+		if got := int16(binary.LittleEndian.Uint16(buf)); n != 2 || got != want {
+			t.Errorf("%v: downmix gave %d, DownmixInt16 %d", stereo, got, want)
+		}
+	}
+}
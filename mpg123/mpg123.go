@@ -3,14 +3,53 @@
 package mpg123
 
 /*
-#define MPG123_ENUM_API 1
-#include <mpg123.h>
-#cgo CFLAGS: -I/usr/local/include
-#cgo LDFLAGS: -L/usr/local/lib -lmpg123
+// use the 64 bit off_t variants of the API (mpg123_seek_64 etc.) on 32 bit
+// Linux, so sample and byte offsets are not limited to 2^31
+#cgo linux,arm linux,386 linux,mips linux,mipsle CFLAGS: -D_FILE_OFFSET_BITS=64
+
+#include "compat.h"
+#include <stdint.h>
+#include <stdlib.h>
+
+// Sample buffers are unsigned char* before libmpg123 1.31 and void* after,
+// so calls go through these wrappers, which compile against both.
 
 int do_mpg123_read(mpg123_handle *mh, void *outmemory, size_t outmemsize, size_t *done) {
 	return mpg123_read(mh, outmemory, outmemsize, done);
 }
+
+int do_mpg123_decode(mpg123_handle *mh, const void *inmemory, size_t inmemsize, void *outmemory, size_t outmemsize, size_t *done) {
+	return mpg123_decode(mh, (const unsigned char *)inmemory, inmemsize, outmemory, outmemsize, done);
+}
+
+int do_mpg123_feed(mpg123_handle *mh, const void *in, size_t size) {
+	return mpg123_feed(mh, (const unsigned char *)in, size);
+}
+
+// callbacks into Go for decoding from an io.Reader, see reader.go
+extern mpg123_ssize_t goReaderRead(uintptr_t h, void *buf, size_t count);
+extern off_t goReaderSeek(uintptr_t h, off_t offset, int whence);
+extern void goReaderCleanup(uintptr_t h);
+
+static mpg123_ssize_t reader_read(void *h, void *buf, size_t count) {
+	return goReaderRead((uintptr_t)h, buf, count);
+}
+
+static off_t reader_seek(void *h, off_t offset, int whence) {
+	return goReaderSeek((uintptr_t)h, offset, whence);
+}
+
+static void reader_cleanup(void *h) {
+	goReaderCleanup((uintptr_t)h);
+}
+
+static int open_reader(mpg123_handle *mh, uintptr_t h) {
+	int err = mpg123_replace_reader_handle(mh, reader_read, reader_seek, reader_cleanup);
+	if (err != MPG123_OK) {
+		return err;
+	}
+	return mpg123_open_handle(mh, (void *)h);
+}
 */
 import "C"
 
@@ -19,12 +58,25 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
+	"sync"
+	"time"
 	"unsafe"
 )
 
-var EOF = errors.New("EOF")
+// EOF is returned by Read at the end of the stream. It is io.EOF, so a
+// Decoder works with io.Copy and other io.Reader consumers.
+var EOF = io.EOF
+
+// ErrDeleted is returned by the decoding calls of a Decoder after Delete
+var ErrDeleted = errors.New("mpg123 error: decoder deleted")
+
+// A Decoder reads and seeks decoded audio.
+var (
+	_ io.Reader     = (*Decoder)(nil)
+	_ io.ReadSeeker = (*Decoder)(nil)
+	_ io.Closer     = (*Decoder)(nil)
+)
 
 // All output encoding formats supported by mpg123
 const (
@@ -48,8 +100,73 @@ const (
 	ENC_FLOAT_64    = C.MPG123_ENC_FLOAT_64
 	ENC_ANY         = C.MPG123_ENC_ANY
 
-	ADD_FLAGS = C.MPG123_ADD_FLAGS
-	QUIET     = C.MPG123_QUIET
+	FLAGS        = C.MPG123_FLAGS
+	ADD_FLAGS    = C.MPG123_ADD_FLAGS
+	REMOVE_FLAGS = C.MPG123_REMOVE_FLAGS
+	ICY_INTERVAL = C.MPG123_ICY_INTERVAL
+	QUIET        = C.MPG123_QUIET
+	FORCE_RATE   = C.MPG123_FORCE_RATE
+	FORCE_MONO   = C.MPG123_FORCE_MONO
+	MONO_MIX     = C.MPG123_MONO_MIX
+	FORCE_STEREO = C.MPG123_FORCE_STEREO
+	GAPLESS      = C.MPG123_GAPLESS
+	FORCE_ENDIAN = C.MPG123_FORCE_ENDIAN
+	BIG_ENDIAN   = C.MPG123_BIG_ENDIAN
+
+	SKIP_ID3V2    = C.MPG123_SKIP_ID3V2
+	PLAIN_ID3TEXT = C.MPG123_PLAIN_ID3TEXT
+	PICTURE       = C.MPG123_PICTURE
+	STORE_RAW_ID3 = C.MPG123_STORE_RAW_ID3 // keep the raw tags for RawID3
+
+	MONO   = C.MPG123_MONO
+	STEREO = C.MPG123_STEREO
+
+	OK         = C.MPG123_OK
+	ERR        = C.MPG123_ERR
+	DONE       = C.MPG123_DONE
+	NEW_FORMAT = C.MPG123_NEW_FORMAT
+	NEED_MORE  = C.MPG123_NEED_MORE
+)
+
+// MPEG audio versions
+const (
+	MPEG_1_0 Version = C.MPG123_1_0
+	MPEG_2_0 Version = C.MPG123_2_0
+	MPEG_2_5 Version = C.MPG123_2_5
+)
+
+// Channel modes of an MPEG frame
+const (
+	M_STEREO ChannelMode = C.MPG123_M_STEREO
+	M_JOINT  ChannelMode = C.MPG123_M_JOINT
+	M_DUAL   ChannelMode = C.MPG123_M_DUAL
+	M_MONO   ChannelMode = C.MPG123_M_MONO
+)
+
+// Bitrate modes
+const (
+	CBR VBRMode = C.MPG123_CBR
+	VBR VBRMode = C.MPG123_VBR
+	ABR VBRMode = C.MPG123_ABR
+)
+
+// Frame header flags
+const (
+	CRC       = C.MPG123_CRC
+	COPYRIGHT = C.MPG123_COPYRIGHT
+	PRIVATE   = C.MPG123_PRIVATE
+	ORIGINAL  = C.MPG123_ORIGINAL
+)
+
+// Decoder state keys for State
+const (
+	ACCURATE      = C.MPG123_ACCURATE
+	BUFFERFILL    = C.MPG123_BUFFERFILL
+	FRANKENSTEIN  = C.MPG123_FRANKENSTEIN
+	FRESH_DECODER = C.MPG123_FRESH_DECODER
+	ENC_DELAY     = C.MPG123_ENC_DELAY
+	ENC_PADDING   = C.MPG123_ENC_PADDING
+	DEC_DELAY     = C.MPG123_DEC_DELAY
 )
 
 const (
@@ -57,42 +174,156 @@ const (
 	OUT_MAX_BUFFER_SIZE = 32768
 )
 
-// Contains a handle for and mpg123 decoder instance
+// Contains a handle for and mpg123 decoder instance.
+//
+// A Decoder must not be used from several goroutines at once, with two
+// exceptions. Close and Delete may be called while another goroutine is in
+// Read, Feed, Decode, Seek or an Open call. They wait for that call to
+// return, so a decoder can be shut down from outside without freeing memory
+// still in use. The sound controls (Volume, VolumeChange, EQ, ResetEQ,
+// SetRVA and SetSound) may likewise be changed during playback and apply
+// from the next read. Different decoders may be used concurrently.
+//
+// The package does not panic on bad input or misuse of a non-nil Decoder:
+// calls on a deleted decoder return ErrDeleted or zero values, Delete and
+// Close may be repeated, empty buffers are accepted, a failed library
+// initialization is returned by NewDecoder, and panics of the io.Reader
+// given to OpenReader are recovered, logged and reported as read errors.
 type Decoder struct {
+	mu     sync.Mutex // serializes the calls listed above with Close and Delete
 	handle *C.mpg123_handle
-	io.Seeker
+	goMono bool
+	ducker *Ducker    // gain applied by Read, see duck.go
+	fade   *fadeState // fades applied by Read, see fade.go
+	loop   *loopState // region repeated by Read, see loop.go
+	watch  watchdog   // timeouts, see timeout.go
+	tee    io.Writer
+	file   *os.File // file opened by fd, kept alive while mpg123 reads it
+	// inputErr is why the last read of OpenReader input failed, see reader.go
+	inputErr error
+
+	features  uint64   // optional library features, see features.go
+	streaming bool     // an input stream is open, see metrics.go
+	observer  Observer // told about decode calls, see metrics.go
+	id        uint64   // tags the decoder's events, see events.go
+	metaSeen  bool     // new metadata was already reported
+	icy       *ICYMeta // latest metadata of an HTTP stream, see icy.go
+
+	format      Format // cached output format, see format.go
+	formatKnown bool
+	formatGen   uint64 // counts format changes, see stream.go
+	unaligned   bool   // reads may end inside a frame, see SetFrameAligned
+	preroll     int    // MPEG frames decoded and discarded before a seek target, see preroll.go
+
+	primed []byte      // audio decoded by Prime and not read yet, see prime.go
+	chain  *chainState // stream starts in the fed input, nil unless SetChained, see chain.go
+
+	dsp      DSP       // user processing stage of Read, see dsp.go
+	dspOut   []byte    // processed audio not read yet
+	dspSpans []dspSpan // source positions of dspOut
+	dspPos   int       // frames of dspSpans[0] already read
+
+	conceal *concealState // stand-ins for damaged frames, see conceal.go
+
+	source sourceKey   // input of the open stream, see total.go
+	total  *totalCache // length found by TotalSamples
+
+	paceSpeed float64   // playback speed Read is throttled to, 0 if off, see pace.go
+	paceStart time.Time // when the pacing clock started, zero until the next read
+	paceBase  int64     // sample position at paceStart
+
+	progress func(done, total time.Duration) // called by WriteTo, see transcode.go
+
+	labelMu sync.Mutex // guards labels
+	labels  []string   // pprof labels, see labels.go
+
+	subMu sync.Mutex      // guards subs
+	subs  []*subscription // event handlers, see subscribe.go
 }
 
-// init initializes the mpg123 library when package is loaded
+// The library is initialized when the package is loaded. libRefs counts
+// that initialization, InitializeMpg123 calls and live decoders; the library
+// is only shut down once all of them are released.
+var (
+	libMu   sync.Mutex
+	libRefs int
+)
+
+// init initializes the mpg123 library when package is loaded. If that
+// fails, the package does not panic: no reference is taken, and NewDecoder
+// tries again and returns the error.
 func init() {
-	err := C.mpg123_init()
-	if err != C.MPG123_OK {
-		//return fmt.Errorf("error initializing mpg123")
-		panic("failed to initialize mpg123")
+	if err := C.mpg123_init(); err == C.MPG123_OK {
+		libRefs = 1
 	}
-	//return nil
 }
 
 ///////////////////////////
 // DECODER INITIAL CODE //
 ///////////////////////////
 
+// InitializeMpg123 takes a reference on the library, initializing it again
+// if ExitMpg123 shut it down. Each call must be matched by ExitMpg123.
 func InitializeMpg123() {
-	C.mpg123_init()
-	return
+	acquireLib()
 }
 
+// ExitMpg123 releases a reference taken by InitializeMpg123 or, once, the
+// one taken when the package was loaded. The library is shut down when no
+// references and no decoders remain, so calling it with decoders still in
+// use is safe.
 func ExitMpg123() {
-	C.mpg123_exit()
-	return
+	releaseLib()
+}
+
+// Acquire takes a reference on the library for a component, such as a
+// plugin, that shares the process with other users of the package, and
+// returns the function releasing it. Unlike ExitMpg123 the release function
+// only ever drops its own reference, however often it is called, so one
+// component cannot shut the library down under the others.
+func Acquire() (release func(), err error) {
+	if err := acquireLib(); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() { once.Do(releaseLib) }, nil
+}
+
+func acquireLib() error {
+	libMu.Lock()
+	defer libMu.Unlock()
+	if libRefs == 0 {
+		if err := C.mpg123_init(); err != C.MPG123_OK {
+			return fmt.Errorf("mpg123 error: %s", C.GoString(C.mpg123_plain_strerror(err)))
+		}
+	}
+	libRefs++
+	return nil
+}
+
+func releaseLib() {
+	libMu.Lock()
+	defer libMu.Unlock()
+	if libRefs == 0 {
+		return
+	}
+	libRefs--
+	if libRefs == 0 {
+		C.mpg123_exit()
+	}
 }
 
 ///////////////////////////
 // DECODER INSTANCE CODE //
 ///////////////////////////
 
-// NewDecoder creates a new mpg123 decoder instance
-func NewDecoder(decoder string, params ...C.long) (*Decoder, error) {
+// NewDecoder creates a new mpg123 decoder instance. decoder names the
+// decoding engine, "" picks the best one for the machine. If flags are
+// given, the first one replaces the FLAGS parameter, e.g. QUIET|GAPLESS.
+func NewDecoder(decoder string, flags ...int64) (*Decoder, error) {
+	if err := acquireLib(); err != nil {
+		return nil, err
+	}
 	var err C.int
 	var mh *C.mpg123_handle
 	if decoder == "" {
@@ -101,30 +332,52 @@ func NewDecoder(decoder string, params ...C.long) (*Decoder, error) {
 		cdecoder := C.CString(decoder)
 		defer C.free(unsafe.Pointer(cdecoder))
 		mh = C.mpg123_new(cdecoder, &err)
-		if params != nil {
-			C.mpg123_param(mh, C.MPG123_FLAGS, params[0], 0.)
-		}
 	}
 	if mh == nil {
-		errstring := C.mpg123_plain_strerror(err)
-		err := C.GoString(errstring)
-		C.free(unsafe.Pointer(errstring))
-		return nil, fmt.Errorf("error initializing mpg123 decoder: %s", err)
+		releaseLib()
+		// the message is a static string of the library, not to be freed
+		msg := C.GoString(C.mpg123_plain_strerror(err))
+		return nil, fmt.Errorf("error initializing mpg123 decoder: %s", msg)
 	}
 	dec := new(Decoder)
 	dec.handle = mh
+	dec.features = detectFeatures()
+	dec.id = decoderID.Add(1)
+	metricHandles.Add(1)
+	if len(flags) > 0 {
+		if err := dec.Param(FLAGS, flags[0], 0); err != nil {
+			dec.Delete()
+			return nil, err
+		}
+	}
 	return dec, nil
 }
 
-// Delete frees an mpg123 decoder instance
+// Delete frees an mpg123 decoder instance. Calling it again does nothing.
 func (d *Decoder) Delete() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return
+	}
 	C.mpg123_delete(d.handle)
+	d.handle = nil
+	d.file = nil
+	d.streamClosed()
+	metricHandles.Add(-1)
+	releaseLib()
 }
 
 // returns a string containing the most recent error message corresponding to
 // an mpg123 decoder instance
+// It is called on every error path, so it also counts the error for the
+// errors metric and sends it to the EventError subscribers.
 func (d *Decoder) strerror() string {
-	return C.GoString(C.mpg123_strerror(d.handle))
+	code := C.mpg123_errcode(d.handle)
+	countError(code)
+	msg := C.GoString(C.mpg123_strerror(d.handle))
+	d.emitError(int(code), msg)
+	return msg
 }
 
 ////////////////////////
@@ -133,63 +386,206 @@ func (d *Decoder) strerror() string {
 
 // FormatNone disables all decoder output formats (used to specifying supported formats)
 func (d *Decoder) FormatNone() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle != nil {
+		d.formatNone()
+	}
+}
+
+// formatNone is FormatNone. It is called with d locked.
+func (d *Decoder) formatNone() {
 	C.mpg123_format_none(d.handle)
 }
 
 // FromatAll enables all decoder output formats (this is the default setting)
 func (d *Decoder) FormatAll() {
-	C.mpg123_format_all(d.handle)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle != nil {
+		C.mpg123_format_all(d.handle)
+	}
 }
 
 // GetFormat returns current output format
 func (d *Decoder) GetFormat() (rate int, channels int, encoding int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0, 0, 0
+	}
+	return d.getFormat()
+}
+
+// getFormat is GetFormat. It is called with d locked.
+func (d *Decoder) getFormat() (rate int, channels int, encoding int) {
 	var cRate C.long
 	var cChans, cEnc C.int
 	C.mpg123_getformat(d.handle, &cRate, &cChans, &cEnc)
 	return int(cRate), int(cChans), int(cEnc)
 }
 
+// feedFormat is GetFormat for feed mode, reporting needMore instead of a
+// format while the fed data does not yet contain a complete frame header
+func (d *Decoder) feedFormat() (f Format, needMore bool, err error) {
+	var cRate C.long
+	var cChans, cEnc C.int
+	switch C.mpg123_getformat(d.handle, &cRate, &cChans, &cEnc) {
+	case C.MPG123_OK:
+		return Format{Rate: int(cRate), Channels: int(cChans), Encoding: int(cEnc)}, false, nil
+	case C.MPG123_NEED_MORE:
+		return Format{}, true, nil
+	}
+	return Format{}, false, fmt.Errorf("mpg123 error: %s", d.strerror())
+}
+
 // Format sets the audio output format for decoder
 func (d *Decoder) Format(rate int, channels int, encodings int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle != nil {
+		d.allowFormat(rate, channels, encodings)
+	}
+}
+
+// allowFormat is Format. It is called with d locked.
+func (d *Decoder) allowFormat(rate int, channels int, encodings int) {
 	C.mpg123_format(d.handle, C.long(rate), C.int(channels), C.int(encodings))
 }
 
+//////////////////
+// VOLUME CODE //
+//////////////////
+
+// Volume sets the output volume, 1.0 being the original level
+func (d *Decoder) Volume(vol float64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	if err := C.mpg123_volume(d.handle, C.double(vol)); err != C.MPG123_OK {
+		return fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	return nil
+}
+
+// VolumeChange adjusts the output volume by change
+func (d *Decoder) VolumeChange(change float64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	if err := C.mpg123_volume_change(d.handle, C.double(change)); err != C.MPG123_OK {
+		return fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	return nil
+}
+
+// GetVolume returns the volume set with Volume (base), the volume actually
+// applied including RVA (really) and the RVA adjustment in dB
+func (d *Decoder) GetVolume() (base float64, really float64, rvaDB float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0, 0, 0
+	}
+	var cbase, creally, crva C.double
+	C.mpg123_getvolume(d.handle, &cbase, &creally, &crva)
+	return float64(cbase), float64(creally), float64(crva)
+}
+
 /////////////////////////////
 // INPUT AND DECODING CODE //
 /////////////////////////////
 
 // Open initializes a decoder for an mp3 file using a filename
 func (d *Decoder) Open(file string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	if f, ok := fault(OpOpen); ok && f.Code != OK {
+		return faultError(f.Code)
+	}
 	cfile := C.CString(file)
 	defer C.free(unsafe.Pointer(cfile))
 	err := C.mpg123_open(d.handle, cfile)
 	if err != C.MPG123_OK {
 		return fmt.Errorf("error opening %s: %s", file, d.strerror())
 	}
+	d.streamOpened()
+	d.source = fileKey(os.Stat(file))
 	return nil
 }
 
-// OpenFile binds to an fd from an open *os.File for decoding
+// OpenFile binds to an open *os.File for decoding. The file is not closed by
+// the decoder.
 func (d *Decoder) OpenFile(f *os.File) error {
-	err := C.mpg123_open_fd(d.handle, C.int(f.Fd()))
+	if fl, ok := fault(OpOpen); ok && fl.Code != OK {
+		return faultError(fl.Code)
+	}
+	return d.openFile(f)
+}
+
+// OpenReader initializes a decoder reading the mp3 data from r. Seeking and
+// exact length information are available if r also implements io.Seeker.
+// r is not closed by the decoder.
+func (d *Decoder) OpenReader(r io.Reader) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	if f, ok := fault(OpOpen); ok && f.Code != OK {
+		return faultError(f.Code)
+	}
+	h := registerReader(d, d.watched(r))
+	d.watchStart("open")
+	err := C.open_reader(d.handle, C.uintptr_t(h))
+	if terr := d.watchEnd(0); terr != nil {
+		unregisterReader(h)
+		return terr
+	}
 	if err != C.MPG123_OK {
-		return fmt.Errorf("error attaching file: %s", d.strerror())
+		unregisterReader(h)
+		return fmt.Errorf("error opening reader: %s", d.strerror())
 	}
+	d.streamOpened()
+	d.source = readerKey(r)
 	return nil
 }
 
 // OpenFeed prepares a decoder for direct feeding via Feed(..)
 func (d *Decoder) OpenFeed() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	if f, ok := fault(OpOpen); ok && f.Code != OK {
+		return faultError(f.Code)
+	}
 	err := C.mpg123_open_feed(d.handle)
 	if err != C.MPG123_OK {
 		return fmt.Errorf("mpg123 error: %s", d.strerror())
 	}
+	d.streamOpened()
 	return nil
 }
 
 // Close closes an input file if one was opened by mpg123
 func (d *Decoder) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
 	err := C.mpg123_close(d.handle)
+	d.file = nil
+	d.streamClosed()
 	if err != C.MPG123_OK {
 		return fmt.Errorf("mpg123 error: %s", d.strerror())
 	}
@@ -197,28 +593,159 @@ func (d *Decoder) Close() error {
 }
 
 // Read decodes data and into buf and returns number of bytes decoded.
+//
+// Once the output format is known, Read only returns whole PCM frames (one
+// sample for every channel): it fills buf up to the largest multiple of the
+// frame size and leaves the rest of the decoded audio in the decoder for the
+// next call, so no data is lost whatever the size of buf. A buf smaller than
+// one frame of the decoder's output (both channels' worth when mixing down
+// with MonoGo) returns io.ErrShortBuffer. SetFrameAligned turns this off. As
+// with any io.Reader, an empty buf returns 0 and no error.
+//
+// With SetPacing, Read waits (without holding the decoder) until the audio
+// is due. After FadeOut, it returns ErrFadedOut once the fade is complete.
 func (d *Decoder) Read(buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	var wait time.Duration
+	// deferred first, so it runs after the unlock below
+	defer func() {
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+	}()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0, ErrDeleted
+	}
+	if d.fadedOut() {
+		return 0, ErrFadedOut
+	}
+	d.watchStart("read")
+	defer d.watchClear()
+	d.inputErr = nil
+	start := time.Now()
+	pos := d.tell()
+	wait = d.paceWait(pos)
+	size, err := d.alignedSize(len(buf))
+	if err != nil {
+		return 0, err
+	}
+	if d.dspOut != nil {
+		// processed audio left from the last read
+		return d.takeDSP(buf), nil
+	}
+	size = d.fadeLimit(size)
+	if size, err = d.loopLimit(size); err != nil {
+		return 0, err
+	}
+	if f, ok := fault(OpRead); ok {
+		if f.Code == DONE {
+			return 0, EOF
+		} else if f.Code != OK {
+			return 0, faultError(f.Code)
+		}
+		size = limitFault(f, size)
+	}
 	var done C.size_t
-	err := C.do_mpg123_read(d.handle, (unsafe.Pointer)(&buf[0]), C.size_t(len(buf)), &done)
-	if err == C.MPG123_DONE {
-		return int(done), EOF
+	code := C.int(C.MPG123_OK)
+	if d.primed != nil {
+		done = C.size_t(d.takePrimed(buf[:size]))
+	} else if d.concealPending() {
+		done = C.size_t(d.takeConceal(buf[:size]))
+	} else {
+		code = C.do_mpg123_read(d.handle, (unsafe.Pointer)(&buf[0]), C.size_t(size), &done)
+		d.concealCheck(buf[:done])
 	}
-	if err != C.MPG123_OK {
-		return int(done), fmt.Errorf("mpg123 error: %s", d.strerror())
+	if code == C.MPG123_DONE && done == 0 && d.loop != nil {
+		// the stream ended before the loop end
+		if err := d.loopWrap(); err != nil {
+			return 0, err
+		}
+		if size, err = d.loopLimit(size); err != nil {
+			return 0, err
+		}
+		code = C.do_mpg123_read(d.handle, (unsafe.Pointer)(&buf[0]), C.size_t(size), &done)
+		d.concealCheck(buf[:done])
 	}
-	return int(done), nil
+	n := int(done)
+	if d.goMono && n > 0 {
+		var merr error
+		if n, merr = d.downmix(buf[:n]); merr != nil {
+			return 0, merr
+		}
+	}
+	if err := d.duck(buf[:n]); err != nil {
+		return 0, err
+	}
+	if err := d.applyFade(buf[:n]); err != nil {
+		return 0, err
+	}
+	d.decoded(start, n, code)
+	if err := d.watchEnd(n); err != nil {
+		return n, err
+	}
+	if d.dsp != nil {
+		flush := code == C.MPG123_DONE
+		if n, err = d.runDSP(buf, n, pos, flush); err != nil {
+			return 0, err
+		}
+		if flush && n > 0 {
+			return n, nil
+		}
+	}
+	if code == C.MPG123_DONE && (d.loop == nil || n == 0) {
+		return n, EOF
+	}
+	// a format change is reported through Rate, Channels and Encoding
+	if code != C.MPG123_OK && code != C.MPG123_NEW_FORMAT && code != C.MPG123_DONE {
+		return n, d.readError()
+	}
+	return n, nil
 }
 
+// readError returns the error of a failed read: the error of the input
+// reader if reading the input failed, or else the error mpg123 reports. It
+// is called with d locked.
+func (d *Decoder) readError() error {
+	if err := d.inputErr; err != nil {
+		d.inputErr = nil
+		return err
+	}
+	return fmt.Errorf("mpg123 error: %s", d.strerror())
+}
+
+// ReadAudioFrames decodes up to frames PCM frames into buf, or as many as
+// fit, and returns the number of bytes decoded
 func (d *Decoder) ReadAudioFrames(frames int, buf []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0, ErrDeleted
+	}
+	start := time.Now()
 	var done C.size_t
-	_, channels, enc := d.GetFormat()
-	bytesPerSample := GetEncodingBitsPerSample(enc) / 8
-	framesToBytes := bytesPerSample * frames * channels
+	rate, channels, enc := d.getFormat()
+	framesToBytes := frames * Format{rate, channels, enc}.BytesPerFrame()
+	if framesToBytes > len(buf) {
+		framesToBytes = len(buf)
+	}
+	if framesToBytes <= 0 {
+		return 0, nil
+	}
+	if d.primed != nil {
+		n := d.takePrimed(buf[:framesToBytes])
+		d.decoded(start, n, C.MPG123_OK)
+		return n, nil
+	}
 	err := C.do_mpg123_read(d.handle, (unsafe.Pointer)(&buf[0]), C.size_t(framesToBytes), &done)
+	d.decoded(start, int(done), err)
 	if err == C.MPG123_DONE {
 		return int(done), EOF
 	}
-	if err != C.MPG123_OK {
+	if err != C.MPG123_OK && err != C.MPG123_NEW_FORMAT {
 		return int(done), fmt.Errorf("mpg123 error: %s", d.strerror())
 	}
 	return int(done), nil
@@ -229,18 +756,88 @@ func (d *Decoder) DecodeSamples(samples int, audio []byte) (int, error) {
 	if err == EOF {
 		return 0, nil
 	}
-	return (rLen / 4), nil
+	rate, channels, enc := d.GetFormat()
+	if frameSize := (Format{rate, channels, enc}).BytesPerFrame(); frameSize > 0 {
+		return rLen / frameSize, nil
+	}
+	return 0, nil
 }
 
-// Feed provides data bytes into the decoder
+// Feed provides data bytes into the decoder. Feeding an empty buf does
+// nothing.
 func (d *Decoder) Feed(buf []byte) error {
-	err := C.mpg123_feed(d.handle, (*C.uchar)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)))
+	if len(buf) == 0 {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	if err := d.teeInput(buf); err != nil {
+		return err
+	}
+	d.chainInput(buf)
+	if f, ok := fault(OpFeed); ok && f.Code != OK {
+		return faultError(f.Code)
+	}
+	err := C.do_mpg123_feed(d.handle, unsafe.Pointer(&buf[0]), C.size_t(len(buf)))
 	if err != C.MPG123_OK {
 		return fmt.Errorf("mpg123 error: %s", d.strerror())
 	}
 	return nil
 }
 
+// SetFrameAligned selects whether Read and DecoderReader.Read return whole
+// PCM frames only, buffering the remainder in the decoder (the default), or
+// fill the buffer byte for byte, possibly ending in the middle of a frame.
+// Writers to audio devices want the default.
+func (d *Decoder) SetFrameAligned(on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.unaligned = !on
+}
+
+// alignedSize returns how many bytes of an n byte buffer a read may fill:
+// n rounded down to whole frames of the decoder's output once its format is
+// known, unless frame alignment is off. It is called with d locked.
+func (d *Decoder) alignedSize(n int) (int, error) {
+	if d.unaligned {
+		return n, nil
+	}
+	rate, channels, enc := d.getFormat()
+	frameSize := (Format{rate, channels, enc}).BytesPerFrame()
+	if frameSize <= 0 {
+		return n, nil
+	}
+	if n < frameSize {
+		return 0, io.ErrShortBuffer
+	}
+	return n - n%frameSize, nil
+}
+
+// Tee copies all compressed input passed to Feed, Decode or a DecoderReader,
+// or read from the reader given to OpenReader, to w before it is decoded,
+// e.g. to archive a radio stream while playing it. Input read again after a
+// seek is copied again. Passing nil disables the copy.
+func (d *Decoder) Tee(w io.Writer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tee = w
+}
+
+// teeInput writes compressed input to the tee writer if one is set. It is
+// called with d locked.
+func (d *Decoder) teeInput(buf []byte) error {
+	if d.tee == nil {
+		return nil
+	}
+	if _, err := d.tee.Write(buf); err != nil {
+		return fmt.Errorf("mpg123 error: tee write: %w", err)
+	}
+	return nil
+}
+
 // DecoderReader is the way to decode streaming MP3
 type DecoderReader struct {
 	decoder  *Decoder
@@ -248,6 +845,7 @@ type DecoderReader struct {
 	fps      int
 	channels int
 	paranoid bool
+	owned    io.Closer // closed together with the decoder, if set
 }
 
 // Paranoid mode shuts off the decoder on a non-EOF error (handy if your input is a duplex network stream).
@@ -259,12 +857,30 @@ func (dr *DecoderReader) Paranoid() *DecoderReader {
 // Nuke kills our DecoderReader appropriately
 func (dr DecoderReader) Nuke() {
 	dr.decoder.Close()
+	if dr.owned != nil {
+		dr.owned.Close()
+	}
 	// dr.decoder.Delete() // Commented-out because it causes a SIGABRT 😰
 }
 
 // Read duck-types DecoderReader into io.Reader.
 func (dr DecoderReader) Read(bytes []byte) (int, error) {
+	if len(bytes) == 0 {
+		return 0, nil
+	}
 	buf := make([]byte, 64*1024)
+	dr.decoder.mu.Lock()
+	if dr.decoder.handle == nil {
+		dr.decoder.mu.Unlock()
+		return 0, ErrDeleted
+	}
+	dr.decoder.watchStart("read")
+	dr.decoder.mu.Unlock()
+	defer func() {
+		dr.decoder.mu.Lock()
+		dr.decoder.watchClear()
+		dr.decoder.mu.Unlock()
+	}()
 	for {
 		var n int
 		var err error
@@ -272,9 +888,17 @@ func (dr DecoderReader) Read(bytes []byte) (int, error) {
 		// Feed data
 		if n, err = dr.src.Read(buf); err == nil {
 			if err = dr.decoder.Feed(buf[0:n]); err != nil {
-				log.Print("Error while feeding to mpg123: ", err)
+				dr.decoder.logger().Error("feed failed", "err", err)
+			}
+		} else if errors.Is(err, os.ErrDeadlineExceeded) {
+			dr.decoder.mu.Lock()
+			terr := dr.decoder.watchEnd(0)
+			dr.decoder.mu.Unlock()
+			if terr != nil {
+				return 0, terr
 			}
-		} else if dr.paranoid {
+			return 0, err
+		} else if dr.paranoid && err != io.EOF {
 			// Note: EOF in Feed does NOT mean EOF in Read!
 			dr.Nuke()
 			return 0, err
@@ -282,13 +906,37 @@ func (dr DecoderReader) Read(bytes []byte) (int, error) {
 
 		// Read output
 		var done C.size_t
-		msg := C.mpg123_read(dr.decoder.handle, (*C.uchar)(&bytes[0]), C.size_t(len(bytes)), &done)
+		dr.decoder.mu.Lock()
+		start := time.Now()
+		size, serr := dr.decoder.alignedSize(len(bytes))
+		if serr != nil {
+			dr.decoder.mu.Unlock()
+			return 0, serr
+		}
+		msg := C.int(C.MPG123_OK)
+		if dr.decoder.concealPending() {
+			done = C.size_t(dr.decoder.takeConceal(bytes[:size]))
+		} else {
+			msg = C.do_mpg123_read(dr.decoder.handle, unsafe.Pointer(&bytes[0]), C.size_t(size), &done)
+			dr.decoder.concealCheck(bytes[:done])
+		}
+		dr.decoder.decoded(start, int(done), msg)
+		if done > 0 {
+			dr.decoder.watchEnd(int(done))
+		}
+		var derr error
+		switch msg {
+		case C.MPG123_OK, C.MPG123_NEW_FORMAT, C.MPG123_DONE, C.MPG123_NEED_MORE:
+		default:
+			derr = fmt.Errorf("mpg123 error: %s", dr.decoder.strerror())
+		}
+		dr.decoder.mu.Unlock()
+		if derr != nil {
+			// an error code would come back on every call; do not spin
+			return int(done), derr
+		}
 		switch msg {
 		case C.MPG123_NEW_FORMAT:
-			rate, channel, encoding := dr.decoder.GetFormat()
-			log.Printf(
-				"New format with rate: %d, channels: %d, encoding: %d", rate, channel, encoding,
-			)
 			fallthrough
 		case C.MPG123_OK:
 			fallthrough
@@ -300,6 +948,7 @@ func (dr DecoderReader) Read(bytes []byte) (int, error) {
 			}
 			if err == io.EOF {
 				// Source exhausted, so signal EOF
+				dr.decoder.emit(Event{Kind: EventEOF})
 				dr.Nuke()
 				return int(done), io.EOF
 			}
@@ -307,55 +956,82 @@ func (dr DecoderReader) Read(bytes []byte) (int, error) {
 	}
 }
 
-// DecoderReader gives you an io.Reader for streaming-decoding. It performs
-// a combination of Feed and Read, and relies on you to first call OpenFeed
-// before invoking DecoderReader.Read.
-func (d *Decoder) DecoderReader(
-	src io.Reader, fps int, channels int, encoding int,
-) *DecoderReader {
+// FeedReader gives you an io.Reader for streaming-decoding src into the
+// output format f. It performs a combination of Feed and Read, and relies on
+// you to first call OpenFeed before invoking DecoderReader.Read.
+func (d *Decoder) FeedReader(src io.Reader, f Format) *DecoderReader {
 	d.FormatNone()
-	d.Format(int64(fps), channels, encoding)
+	d.Format(f.Rate, f.Channels, f.Encoding)
 	return &DecoderReader{
 		decoder:  d,
-		src:      src,
-		fps:      fps,
-		channels: channels,
+		src:      d.watched(src),
+		fps:      f.Rate,
+		channels: f.Channels,
 		paranoid: false,
 	}
 }
 
+// DecoderReader gives you an io.Reader for streaming-decoding.
+//
+// Deprecated: use FeedReader, which takes the output format as a Format.
+// DecoderReader will be removed in the next release.
+func (d *Decoder) DecoderReader(
+	src io.Reader, fps int, channels int, encoding int,
+) *DecoderReader {
+	return d.FeedReader(src, Format{Rate: fps, Channels: channels, Encoding: encoding})
+}
+
 // MonoDecoderReader is an alias that gives you an io.Reader for
 // decoding a stream that is known to be mono-channeled.
+//
+// Deprecated: use FeedReader with Channels set to 1. MonoDecoderReader
+// will be removed in the next release.
 func (d *Decoder) MonoDecoderReader(src io.Reader, fps int, encoding int) *DecoderReader {
-	return d.DecoderReader(src, fps, 1, encoding)
+	return d.FeedReader(src, Format{Rate: fps, Channels: 1, Encoding: encoding})
 }
 
 // Feed input chunk and get first chunk of decoded audio.
 func (d *Decoder) Decode(buf []byte) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return nil, ErrDeleted
+	}
+	start := time.Now()
 	var b bytes.Buffer
 	out := make([]byte, OUT_MAX_BUFFER_SIZE)
 	var outLen int
 	var size C.size_t
 
-	ret := C.mpg123_decode(d.handle, (*C.uchar)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)), (*C.uchar)(&out[0]), C.size_t(OUT_MAX_BUFFER_SIZE), &size)
+	if err := d.teeInput(buf); err != nil {
+		return nil, err
+	}
+	d.chainInput(buf)
+	if f, ok := fault(OpDecode); ok && f.Code != OK {
+		return nil, faultError(f.Code)
+	}
+	// with no input, only the output still pending in the decoder is returned
+	var in unsafe.Pointer
+	if len(buf) > 0 {
+		in = unsafe.Pointer(&buf[0])
+	}
+	ret := C.do_mpg123_decode(d.handle, in, C.size_t(len(buf)), unsafe.Pointer(&out[0]), C.size_t(OUT_MAX_BUFFER_SIZE), &size)
 	if ret == C.MPG123_NEW_FORMAT {
-		var rate C.long
-		var channels, enc C.int
-
-		C.mpg123_getformat(d.handle, &rate, &channels, &enc)
-		log.Printf("New format: %d Hz, %d channels, encoding value %d\n", rate, channels, enc)
+		d.events(ret)
+	} else if ret == C.MPG123_NEED_MORE && len(buf) == 0 {
+		d.decoded(start, 0, ret)
+		return nil, nil
 	} else if ret == C.MPG123_ERR || ret == C.MPG123_NEED_MORE {
-		log.Printf("mpg123 first decode error!!!\n")
+		d.decoded(start, 0, C.MPG123_ERR)
 		return nil, fmt.Errorf("mpg123 error: %s", d.strerror())
 	}
 	outLen = int(size)
 	if outLen > 0 {
 		b.Write(out[:outLen])
-		log.Printf("mpg123 first decode. %d\n", outLen)
 	}
 
 	for {
-		ret = C.mpg123_decode(d.handle, nil, 0, (*C.uchar)(&out[0]), C.size_t(OUT_MAX_BUFFER_SIZE), &size)
+		ret = C.do_mpg123_decode(d.handle, nil, 0, unsafe.Pointer(&out[0]), C.size_t(OUT_MAX_BUFFER_SIZE), &size)
 		if ret == C.MPG123_ERR || ret == C.MPG123_NEED_MORE {
 			break
 		}
@@ -366,24 +1042,148 @@ func (d *Decoder) Decode(buf []byte) ([]byte, error) {
 	}
 
 	if ret == C.MPG123_ERR {
-		log.Printf("mpg123 decode error!!!\n")
+		d.decoded(start, b.Len(), ret)
 		return nil, fmt.Errorf("mpg123 error: %s", d.strerror())
 	}
 
+	d.decoded(start, b.Len(), C.MPG123_OK)
 	return b.Bytes(), nil
 }
 
+// FrameByFrameNext parses the next MPEG frame without decoding it, for use
+// with FrameData and FrameByFrameDecode. It reports whether the output format
+// changed and returns EOF at the end of the stream.
+func (d *Decoder) FrameByFrameNext() (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return false, ErrDeleted
+	}
+	switch err := C.mpg123_framebyframe_next(d.handle); err {
+	case C.MPG123_OK:
+		return false, nil
+	case C.MPG123_NEW_FORMAT:
+		return true, nil
+	case C.MPG123_DONE:
+		return false, EOF
+	}
+	return false, fmt.Errorf("mpg123 error: %s", d.strerror())
+}
+
+// FrameData returns the header and body of the frame parsed by
+// FrameByFrameNext. The body is copied out of the decoder's buffer.
+func (d *Decoder) FrameData() (header uint32, body []byte, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0, nil, ErrDeleted
+	}
+	var cheader C.ulong
+	var cbody *C.uchar
+	var size C.size_t
+	if e := C.mpg123_framedata(d.handle, &cheader, &cbody, &size); e != C.MPG123_OK {
+		return 0, nil, fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	return uint32(cheader), C.GoBytes(unsafe.Pointer(cbody), C.int(size)), nil
+}
+
+// FrameByFrameDecode decodes the frame parsed by FrameByFrameNext and returns
+// its frame number and audio. The audio aliases the decoder's internal buffer
+// and is only valid until the next call.
+func (d *Decoder) FrameByFrameDecode() (num int64, audio []byte, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0, nil, ErrDeleted
+	}
+	start := time.Now()
+	var cnum C.off_t
+	var caudio *C.uchar
+	var size C.size_t
+	e := C.mpg123_framebyframe_decode(d.handle, &cnum, &caudio, &size)
+	if e != C.MPG123_OK && e != C.MPG123_NEW_FORMAT {
+		d.decoded(start, 0, e)
+		return int64(cnum), nil, fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	if caudio != nil && size > 0 {
+		audio = unsafe.Slice((*byte)(unsafe.Pointer(caudio)), int(size))
+	}
+	d.decoded(start, len(audio), e)
+	return int64(cnum), audio, nil
+}
+
+// off_t mpg123_framepos(mpg123_handle *mh)
+// FramePos returns the input byte offset of the current frame
+func (d *Decoder) FramePos() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0
+	}
+	return int64(C.mpg123_framepos(d.handle))
+}
+
 // const char* mpg123_current_decoder(mpg123_handle *mh)
 func (d *Decoder) CurrentDecoder() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ""
+	}
 	dec := C.mpg123_current_decoder(d.handle)
 	return C.GoString(dec)
 }
 
+// readRaw decodes into buf with no downmix, metrics or fault injection. It
+// is called with d locked.
+func (d *Decoder) readRaw(buf []byte) (int, C.int) {
+	var done C.size_t
+	code := C.do_mpg123_read(d.handle, unsafe.Pointer(&buf[0]), C.size_t(len(buf)), &done)
+	return int(done), code
+}
+
+// Seek moves to a sample offset (in PCM frames) and returns the new position.
+// whence is io.SeekStart, io.SeekCurrent or io.SeekEnd as for io.Seeker, but
+// offsets count PCM frames, not bytes. Seeking before the start is an error.
+// With SetSeekPreroll, it decodes and discards a few frames before the
+// target first.
 func (d *Decoder) Seek(offset int64, whence int) (int64, error) {
-	c_offset := (C.off_t)(offset)
+	switch whence {
+	case io.SeekStart:
+		if offset < 0 {
+			return 0, fmt.Errorf("mpg123 error: seek to negative position %d", offset)
+		}
+	case io.SeekCurrent, io.SeekEnd:
+	default:
+		return 0, fmt.Errorf("mpg123 error: invalid whence %d", whence)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0, ErrDeleted
+	}
+	if f, ok := fault(OpSeek); ok && f.Code != OK {
+		return int64(f.Code), faultError(f.Code)
+	}
+	if whence == io.SeekCurrent {
+		// the library is ahead of the reader by the audio kept by Prime
+		offset -= d.primedFrames()
+	}
+	d.primed = nil
+	c_offset, ok := offT(offset)
+	if !ok {
+		return 0, offsetError(offset)
+	}
 	c_whence := (C.int)(whence)
 	s_offset := (int64)(C.mpg123_seek(d.handle, c_offset, c_whence))
-	return s_offset, nil
+	if s_offset < 0 {
+		return s_offset, fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	d.resetPacing()
+	d.restartFade()
+	d.resetDSP()
+	d.resetConceal()
+	return d.prerollTo(s_offset)
 }
 
 // const char** mpg123_supported_decoders(void)
@@ -391,22 +1191,63 @@ func SupportedDecoders() []string {
 	dec := C.mpg123_supported_decoders()
 
 	var strings []string
-	q := uintptr(unsafe.Pointer(dec))
-	for {
-		dec = (**C.char)(unsafe.Pointer(q))
-		if *dec == nil {
+	// the list ends with a NULL entry
+	for n := 1; ; n++ {
+		names := unsafe.Slice(dec, n)
+		if names[n-1] == nil {
 			break
 		}
-		strings = append(strings, C.GoString(*dec))
-		q += unsafe.Sizeof(q)
+		strings = append(strings, C.GoString(names[n-1]))
 	}
 
 	return strings
 }
 
+// void mpg123_rates(const long **list, size_t *number)
+func SupportedRates() []int {
+	var list *C.long
+	var number C.size_t
+	C.mpg123_rates(&list, &number)
+	var rates []int
+	for _, r := range unsafe.Slice(list, int(number)) {
+		rates = append(rates, int(r))
+	}
+	return rates
+}
+
 // off_t mpg123_tell(mpg123_handle *mh)
 func (d *Decoder) TellCurrentSample() int64 {
-	return int64(C.mpg123_tell(d.handle))
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0
+	}
+	return d.tell()
+}
+
+// tell is TellCurrentSample. It is called with d locked.
+func (d *Decoder) tell() int64 {
+	return int64(C.mpg123_tell(d.handle)) - d.primedFrames()
+}
+
+// off_t mpg123_tellframe(mpg123_handle *mh)
+func (d *Decoder) TellCurrentFrame() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0
+	}
+	return int64(C.mpg123_tellframe(d.handle))
+}
+
+// off_t mpg123_tell_stream(mpg123_handle *mh)
+func (d *Decoder) TellStream() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0
+	}
+	return int64(C.mpg123_tell_stream(d.handle))
 }
 
 // int mpg123_encsize	(	int 	encoding	)
@@ -415,15 +1256,180 @@ func GetEncodingBitsPerSample(encoding int) int {
 }
 
 // off_t mpg123_length(mpg123_handle * 	mh)
+func (d *Decoder) LengthInPCMFrames() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0
+	}
+	return d.pcmLength()
+}
+
+// GetLengthInPCMFrames returns the length in samples per channel.
+//
+// Deprecated: use LengthInPCMFrames, which returns an int64 so long files
+// do not overflow on 32 bit platforms. GetLengthInPCMFrames will be removed
+// in the next release.
 func (d *Decoder) GetLengthInPCMFrames() int {
-	return int(C.mpg123_length(d.handle))
+	return int(d.LengthInPCMFrames())
+}
+
+// pcmLength is LengthInPCMFrames. It is called with d locked.
+func (d *Decoder) pcmLength() int64 {
+	return int64(C.mpg123_length(d.handle))
 }
 
 // Param sets a specific parameter on an mpg123 handle.
 func (d *Decoder) Param(paramType int, value int64, fvalue float64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	return d.param(paramType, value, fvalue)
+}
+
+// param is Param. It is called with d locked.
+func (d *Decoder) param(paramType int, value int64, fvalue float64) error {
 	err := C.mpg123_param(d.handle, uint32(paramType), C.long(value), C.double(fvalue))
 	if err != C.MPG123_OK {
 		return fmt.Errorf("mpg123 error: %s", d.strerror())
 	}
 	return nil
 }
+
+// GetParam returns the current value of a parameter on an mpg123 handle.
+func (d *Decoder) GetParam(paramType int) (int64, float64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0, 0, ErrDeleted
+	}
+	return d.getParam(paramType)
+}
+
+// getParam is GetParam. It is called with d locked.
+func (d *Decoder) getParam(paramType int) (int64, float64, error) {
+	var value C.long
+	var fvalue C.double
+	err := C.mpg123_getparam(d.handle, uint32(paramType), &value, &fvalue)
+	if err != C.MPG123_OK {
+		return 0, 0, fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	return int64(value), float64(fvalue), nil
+}
+
+//////////////////////////////
+// STREAM INFORMATION CODE //
+//////////////////////////////
+
+// Version is the MPEG audio version of a stream
+type Version int
+
+// ChannelMode is the channel mode of an MPEG frame
+type ChannelMode int
+
+// VBRMode tells whether a stream uses a constant, variable or average bitrate
+type VBRMode int
+
+// FrameInfo describes the MPEG frame most recently parsed by the decoder
+type FrameInfo struct {
+	Version   Version
+	Layer     Layer
+	Rate      int
+	Mode      ChannelMode
+	ModeExt   int
+	FrameSize int // size of the frame in bytes, without the header
+	Flags     int // CRC, COPYRIGHT, PRIVATE and ORIGINAL bits
+	Emphasis  int
+	Bitrate   int // kbit/s, 0 for free format
+	ABRRate   int // target bitrate of an ABR stream in kbit/s
+	VBR       VBRMode
+}
+
+// int mpg123_info(mpg123_handle *mh, struct mpg123_frameinfo *mi)
+func (d *Decoder) FrameInfo() (FrameInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return FrameInfo{}, ErrDeleted
+	}
+	return d.frameInfo()
+}
+
+// frameInfo is FrameInfo. It is called with d locked.
+func (d *Decoder) frameInfo() (FrameInfo, error) {
+	var mi C.struct_mpg123_frameinfo
+	if err := C.mpg123_info(d.handle, &mi); err != C.MPG123_OK {
+		return FrameInfo{}, fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	return FrameInfo{
+		Version:   Version(mi.version),
+		Layer:     Layer(mi.layer),
+		Rate:      int(mi.rate),
+		Mode:      ChannelMode(mi.mode),
+		ModeExt:   int(mi.mode_ext),
+		FrameSize: int(mi.framesize),
+		Flags:     int(mi.flags),
+		Emphasis:  int(mi.emphasis),
+		Bitrate:   int(mi.bitrate),
+		ABRRate:   int(mi.abr_rate),
+		VBR:       VBRMode(mi.vbr),
+	}, nil
+}
+
+// int mpg123_scan(mpg123_handle *mh)
+// Scan reads the whole stream to determine its exact length, then returns
+// to the current position.
+func (d *Decoder) Scan() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	if err := C.mpg123_scan(d.handle); err != C.MPG123_OK {
+		return fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	return nil
+}
+
+// off_t mpg123_framelength(mpg123_handle *mh)
+func (d *Decoder) GetLengthInMPEGFrames() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0
+	}
+	return int(C.mpg123_framelength(d.handle))
+}
+
+// int mpg123_spf(mpg123_handle *mh)
+func (d *Decoder) SamplesPerFrame() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0
+	}
+	return int(C.mpg123_spf(d.handle))
+}
+
+// int mpg123_getstate(mpg123_handle *mh, enum mpg123_state key, long *val, double *fval)
+// State queries decoder state such as ENC_DELAY, ENC_PADDING or ACCURATE.
+func (d *Decoder) State(key int) (int64, float64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0, 0, ErrDeleted
+	}
+	return d.state(key)
+}
+
+// state is State. It is called with d locked.
+func (d *Decoder) state(key int) (int64, float64, error) {
+	var val C.long
+	var fval C.double
+	if err := C.mpg123_getstate(d.handle, uint32(key), &val, &fval); err != C.MPG123_OK {
+		return 0, 0, fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	return int64(val), float64(fval), nil
+}
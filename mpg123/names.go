@@ -0,0 +1,114 @@
+// names.go contains the String methods of the audio enums, so logs and user
+// interfaces can show "MPEG-1 Layer III, joint stereo, s16le" instead of
+// numbers
+
+package mpg123
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Encoding is one of the ENC_* constants, typed for its String method:
+// Encoding(enc).String()
+type Encoding int
+
+// Layer is the MPEG audio layer of a stream, 1 to 3
+type Layer int
+
+var encodingNames = map[Encoding]string{
+	ENC_UNSIGNED_8:  "u8",
+	ENC_SIGNED_8:    "s8",
+	ENC_ULAW_8:      "ulaw",
+	ENC_ALAW_8:      "alaw",
+	ENC_SIGNED_16:   "s16",
+	ENC_UNSIGNED_16: "u16",
+	ENC_SIGNED_24:   "s24",
+	ENC_UNSIGNED_24: "u24",
+	ENC_SIGNED_32:   "s32",
+	ENC_UNSIGNED_32: "u32",
+	ENC_FLOAT_32:    "f32",
+	ENC_FLOAT_64:    "f64",
+}
+
+// String returns the short name of the encoding as used by sox and ffmpeg,
+// e.g. "s16le". Multi-byte encodings get the host byte order, which the
+// decoder produces unless FORCE_ENDIAN is set.
+func (e Encoding) String() string {
+	name, ok := encodingNames[e]
+	if !ok {
+		return fmt.Sprintf("Encoding(%#x)", int(e))
+	}
+	if GetEncodingBitsPerSample(int(e)) > 8 {
+		if binary.NativeEndian.Uint16([]byte{1, 0}) == 1 {
+			name += "le"
+		} else {
+			name += "be"
+		}
+	}
+	return name
+}
+
+func (v Version) String() string {
+	switch v {
+	case MPEG_1_0:
+		return "MPEG-1"
+	case MPEG_2_0:
+		return "MPEG-2"
+	case MPEG_2_5:
+		return "MPEG-2.5"
+	}
+	return fmt.Sprintf("Version(%d)", int(v))
+}
+
+func (l Layer) String() string {
+	switch l {
+	case 1:
+		return "Layer I"
+	case 2:
+		return "Layer II"
+	case 3:
+		return "Layer III"
+	}
+	return fmt.Sprintf("Layer(%d)", int(l))
+}
+
+func (m ChannelMode) String() string {
+	switch m {
+	case M_STEREO:
+		return "stereo"
+	case M_JOINT:
+		return "joint stereo"
+	case M_DUAL:
+		return "dual channel"
+	case M_MONO:
+		return "mono"
+	}
+	return fmt.Sprintf("ChannelMode(%d)", int(m))
+}
+
+func (v VBRMode) String() string {
+	switch v {
+	case CBR:
+		return "CBR"
+	case VBR:
+		return "VBR"
+	case ABR:
+		return "ABR"
+	}
+	return fmt.Sprintf("VBRMode(%d)", int(v))
+}
+
+// String describes the format, e.g. "44100 Hz, 2 channels, s16le"
+func (f Format) String() string {
+	return fmt.Sprintf("%d Hz, %d channels, %v", f.Rate, f.Channels, Encoding(f.Encoding))
+}
+
+// String describes the frame, e.g. "MPEG-1 Layer III, joint stereo, 128 kbit/s CBR"
+func (fi FrameInfo) String() string {
+	rate := fi.Bitrate
+	if fi.VBR == ABR {
+		rate = fi.ABRRate
+	}
+	return fmt.Sprintf("%v %v, %v, %d kbit/s %v", fi.Version, fi.Layer, fi.Mode, rate, fi.VBR)
+}
@@ -0,0 +1,149 @@
+// negotiate.go contains output format negotiation: the decoder is set up to
+// produce as much of a sink format as the library can, and Go conversion
+// stages make up for the rest
+
+package mpg123
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Pipeline is the chain of stages that turns the decoder output into a sink
+// format, as set up by Negotiate
+type Pipeline struct {
+	Sink   Format   // the format asked for
+	Source Format   // what the decoder produces, known once Reader was called
+	Stages []string // a description of each stage, filled in by Reader
+
+	d         *Decoder
+	libStages []string // work done inside libmpg123
+	encoding  int      // encoding the decoder was restricted to
+}
+
+// Negotiate restricts the decoder output as closely to sink as the linked
+// libmpg123 allows and returns the pipeline completing the conversion. It
+// must be called before the stream is opened; Pipeline.Reader then returns
+// the audio in exactly the sink format.
+//
+// Channel changes are always done by libmpg123. The rate is forced in the
+// library if it has the NtoM decoder and resampled in Go otherwise. An
+// encoding the library cannot produce is decoded to float (or 16 bit) and
+// converted in Go, with dither when bits are lost.
+func (d *Decoder) Negotiate(sink Format) (*Pipeline, error) {
+	if sink.Rate <= 0 {
+		return nil, fmt.Errorf("mpg123 error: invalid sink rate %d", sink.Rate)
+	}
+	p := &Pipeline{Sink: sink, d: d, encoding: sink.Encoding}
+
+	var channels int
+	switch sink.Channels {
+	case 1:
+		channels = MONO
+		if err := d.Param(ADD_FLAGS, MONO_MIX, 0); err != nil {
+			return nil, err
+		}
+		p.libStages = append(p.libStages, "mix to mono (libmpg123)")
+	case 2:
+		channels = STEREO
+		if err := d.Param(ADD_FLAGS, FORCE_STEREO, 0); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("mpg123 error: unsupported channel count %d", sink.Channels)
+	}
+
+	if f, ok := encodingFeature(sink.Encoding); !ok || d.require(f) != nil {
+		if _, err := codecFor(sink.Encoding, nativeEndian); err != nil {
+			return nil, err
+		}
+		p.encoding = ENC_SIGNED_16
+		if d.require(FEATURE_OUTPUT_FLOAT32) == nil {
+			p.encoding = ENC_FLOAT_32
+		}
+	}
+
+	rates := SupportedRates()
+	if d.require(FEATURE_DECODE_NTOM) == nil {
+		if err := d.Param(FORCE_RATE, int64(sink.Rate), 0); err != nil {
+			return nil, err
+		}
+		rates = []int{sink.Rate}
+		p.libStages = append(p.libStages, fmt.Sprintf("resample to %d Hz (libmpg123)", sink.Rate))
+	}
+
+	d.FormatNone()
+	for _, rate := range rates {
+		d.Format(rate, channels, p.encoding)
+	}
+	return p, nil
+}
+
+// Reader returns the audio of the opened stream in the sink format and fills
+// in Source and Stages. It needs the output format, so for feed input it can
+// only be called once enough data was fed.
+func (p *Pipeline) Reader() (io.Reader, error) {
+	f, err := p.d.readFormat()
+	if err != nil {
+		return nil, err
+	}
+	p.Source = f
+	p.Stages = append([]string{fmt.Sprintf("decode to %v", f)}, p.libStages...)
+
+	var r io.Reader = p.d
+	order := p.d.ByteOrder()
+	if f.Rate != p.Sink.Rate {
+		res, err := newResampler(r, f.Rate, p.Sink.Rate, f.Channels, f.Encoding, order)
+		if err != nil {
+			return nil, err
+		}
+		r = res
+		p.Stages = append(p.Stages, fmt.Sprintf("resample %d Hz to %d Hz (Go)", f.Rate, p.Sink.Rate))
+	}
+	if f.Encoding != p.Sink.Encoding {
+		c, err := newConverter(f.Encoding, p.Sink.Encoding, order, true)
+		if err != nil {
+			return nil, err
+		}
+		r = &convertReader{src: r, c: c}
+		p.Stages = append(p.Stages, fmt.Sprintf("convert %v to %v (Go)", Encoding(f.Encoding), Encoding(p.Sink.Encoding)))
+	}
+	return r, nil
+}
+
+// String describes the pipeline, e.g.
+// "decode to 44100 Hz, 2 channels, f32 -> convert f32 to s24le (Go)"
+func (p *Pipeline) String() string {
+	if p.Stages == nil {
+		return strings.Join(append([]string{"decode"}, p.libStages...), " -> ")
+	}
+	return strings.Join(p.Stages, " -> ")
+}
+
+// convertReader is an io.Reader applying a Converter to the data read from src
+type convertReader struct {
+	src io.Reader
+	c   *Converter
+	raw []byte // partial input sample carried over between reads
+	out []byte // converted data not yet returned
+	err error
+}
+
+func (cr *convertReader) Read(p []byte) (int, error) {
+	for len(cr.out) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+		buf := make([]byte, OUT_MAX_BUFFER_SIZE)
+		n, err := cr.src.Read(buf)
+		cr.raw = append(cr.raw, buf[:n]...)
+		whole := len(cr.raw) - len(cr.raw)%cr.c.from.size
+		cr.out = cr.c.Convert(cr.raw[:whole])
+		cr.raw = append(cr.raw[:0], cr.raw[whole:]...)
+		cr.err = err
+	}
+	n := copy(p, cr.out)
+	cr.out = cr.out[n:]
+	return n, nil
+}
@@ -0,0 +1,134 @@
+// newreader.go contains NewReader, which creates, configures and opens a
+// decoder in one call
+
+package mpg123
+
+import (
+	"errors"
+	"io"
+)
+
+// Option configures the decoder created by NewReader
+type Option func(*readerConfig)
+
+type readerConfig struct {
+	decoder string
+	output  ConvertOptions
+	mono    MonoMode
+	tags    TagOptions
+}
+
+// WithDecoder selects the mpg123 decoder engine by name, see CurrentDecoder
+func WithDecoder(name string) Option {
+	return func(c *readerConfig) { c.decoder = name }
+}
+
+// WithRate resamples the output to rate
+func WithRate(rate int) Option {
+	return func(c *readerConfig) { c.output.Rate = rate }
+}
+
+// WithChannels sets the number of output channels, 1 or 2
+func WithChannels(channels int) Option {
+	return func(c *readerConfig) { c.output.Channels = channels }
+}
+
+// WithEncoding sets the output encoding, one of the ENC_* constants. The
+// default is ENC_SIGNED_16.
+func WithEncoding(encoding int) Option {
+	return func(c *readerConfig) { c.output.Encoding = encoding }
+}
+
+// WithGapless removes encoder delay and padding
+func WithGapless() Option {
+	return func(c *readerConfig) { c.output.Gapless = true }
+}
+
+// WithTelephony selects 8 kHz mono µ-law output, see Telephony
+func WithTelephony() Option {
+	return func(c *readerConfig) {
+		c.output.Rate = Telephony.Rate
+		c.output.Channels = Telephony.Channels
+		c.output.Encoding = Telephony.Encoding
+	}
+}
+
+// WithMono mixes the output down to one channel using mode
+func WithMono(mode MonoMode) Option {
+	return func(c *readerConfig) { c.mono = mode }
+}
+
+// NewReader creates a decoder for the mp3 data read from src, configured by
+// opts, and returns the decoded PCM data as an io.ReadCloser together with
+// its format:
+//
+//	r, format, err := mpg123.NewReader(f, mpg123.WithRate(48000))
+//	defer r.Close()
+//	io.Copy(out, r)
+//
+// Reads end with io.EOF. Closing the reader frees the decoder but does not
+// close src.
+func NewReader(src io.Reader, opts ...Option) (io.ReadCloser, Format, error) {
+	var c readerConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	d, err := NewDecoder(c.decoder)
+	if err != nil {
+		return nil, Format{}, err
+	}
+	if err := d.SetOutput(c.output); err != nil {
+		d.Delete()
+		return nil, Format{}, err
+	}
+	if c.tags != 0 {
+		if err := d.SetTagOptions(c.tags); err != nil {
+			d.Delete()
+			return nil, Format{}, err
+		}
+	}
+	if c.mono != MonoOff {
+		if err := d.SetMono(c.mono); err != nil {
+			d.Delete()
+			return nil, Format{}, err
+		}
+	}
+	if err := d.OpenReader(src); err != nil {
+		d.Delete()
+		return nil, Format{}, err
+	}
+	f, err := d.readFormat()
+	if err != nil {
+		d.Close()
+		d.Delete()
+		return nil, Format{}, err
+	}
+	return &pcmReader{d}, f, nil
+}
+
+// pcmReader adapts a Decoder to io.ReadCloser
+type pcmReader struct {
+	d *Decoder
+}
+
+var errReaderClosed = errors.New("mpg123 error: read from closed reader")
+
+func (r *pcmReader) Read(p []byte) (int, error) {
+	if r.d == nil {
+		return 0, errReaderClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return r.d.Read(p)
+}
+
+func (r *pcmReader) Close() error {
+	if r.d == nil {
+		return nil
+	}
+	err := r.d.Close()
+	r.d.Delete()
+	r.d = nil
+	return err
+}
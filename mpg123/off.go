@@ -0,0 +1,24 @@
+// off.go contains the conversion of int64 offsets to the off_t of the
+// libmpg123 API. off_t is 64 bits wide everywhere but on Windows, where it
+// stays 32 bits even on amd64 (lfs.go checks the other platforms).
+
+package mpg123
+
+// #include <sys/types.h>
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// offT converts v to an off_t, reporting whether it fits
+func offT(v int64) (C.off_t, bool) {
+	o := C.off_t(v)
+	return o, int64(o) == v
+}
+
+// offsetError is returned for an offset that does not fit in off_t
+func offsetError(v int64) error {
+	return fmt.Errorf("mpg123 error: offset %d does not fit the %d bit off_t of this platform", v, 8*unsafe.Sizeof(C.off_t(0)))
+}
@@ -0,0 +1,51 @@
+// pace.go contains real-time pacing: Read can be throttled to the playback
+// speed of the audio, for simulators and senders replaying files
+
+package mpg123
+
+import (
+	"fmt"
+	"time"
+)
+
+// SetPacing throttles Read (and WriteTo, Stream, ReadBlock and ReadFloat64,
+// which use it) so audio is returned no faster than it plays: each read
+// returns when the first sample it decoded is due. speed multiplies the
+// playback speed, so 2 replays twice as fast; 0 turns pacing off. The clock
+// starts with the first read and restarts after Seek or when a stream is
+// opened. A reader that falls behind catches up without waiting.
+func (d *Decoder) SetPacing(speed float64) error {
+	if speed < 0 {
+		return fmt.Errorf("mpg123 error: negative pacing speed %g", speed)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paceSpeed = speed
+	d.resetPacing()
+	return nil
+}
+
+// resetPacing restarts the pacing clock at the next read. It is called with
+// d locked.
+func (d *Decoder) resetPacing() {
+	d.paceStart = time.Time{}
+}
+
+// paceWait returns how long a read decoding from sample on has to wait. It
+// is called with d locked.
+func (d *Decoder) paceWait(sample int64) time.Duration {
+	if d.paceSpeed == 0 {
+		return 0
+	}
+	rate, _, _ := d.getFormat()
+	if rate <= 0 || sample < 0 {
+		return 0
+	}
+	now := time.Now()
+	if d.paceStart.IsZero() {
+		d.paceStart, d.paceBase = now, sample
+		return 0
+	}
+	due := time.Duration(float64(sample-d.paceBase) / float64(rate) / d.paceSpeed * float64(time.Second))
+	return d.paceStart.Add(due).Sub(now)
+}
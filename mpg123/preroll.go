@@ -0,0 +1,80 @@
+// preroll.go contains seek pre-roll: after a seek the decoder starts a few
+// MPEG frames early and throws their audio away, so the Layer III bit
+// reservoir is filled and the first audio returned is clean
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"fmt"
+	"io"
+)
+
+// SetSeekPreroll makes Seek start decoding frames MPEG frames before the
+// target and discard the audio up to it. libmpg123 already decodes a few
+// frames ahead of a seek (the PREFRAMES parameter); streams that still start
+// with garbled audio after seeking need more; 1 or 2 frames cover the Layer
+// III bit reservoir. 0 turns pre-roll off.
+func (d *Decoder) SetSeekPreroll(frames int) error {
+	if frames < 0 {
+		return fmt.Errorf("mpg123 error: negative seek pre-roll %d", frames)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.preroll = frames
+	return nil
+}
+
+// prerollTo moves from the seek target back by the pre-roll and decodes
+// forward to target again, discarding the audio. If that fails the decoder
+// is left at target without pre-roll. It is called with d locked.
+func (d *Decoder) prerollTo(target int64) (int64, error) {
+	return d.prerollFrames(target, d.preroll)
+}
+
+// prerollFrames does the work of prerollTo with a pre-roll of frames MPEG
+// frames. It is called with d locked.
+func (d *Decoder) prerollFrames(target int64, frames int) (int64, error) {
+	spf := int64(C.mpg123_spf(d.handle))
+	rate, channels, enc := d.getFormat()
+	frameSize := int64(Format{rate, channels, enc}.BytesPerFrame())
+	if frames == 0 || spf <= 0 || frameSize <= 0 || target == 0 {
+		return target, nil
+	}
+	from := target - int64(frames)*spf
+	if from < 0 {
+		from = 0
+	}
+	if pos := int64(C.mpg123_seek(d.handle, C.off_t(from), C.int(io.SeekStart))); pos < 0 {
+		return d.seekDirect(target)
+	}
+	discard := (target - from) * frameSize
+	buf := make([]byte, OUT_MAX_BUFFER_SIZE)
+	for discard > 0 {
+		size := int64(len(buf)) - int64(len(buf))%frameSize
+		if size > discard {
+			size = discard
+		}
+		done, code := d.readRaw(buf[:size])
+		discard -= int64(done)
+		if code == C.MPG123_NEW_FORMAT {
+			d.events(code)
+			continue
+		}
+		if code != C.MPG123_OK || done == 0 {
+			return d.seekDirect(target)
+		}
+	}
+	return target, nil
+}
+
+// seekDirect seeks to target without pre-roll
+func (d *Decoder) seekDirect(target int64) (int64, error) {
+	pos := int64(C.mpg123_seek(d.handle, C.off_t(target), C.int(io.SeekStart)))
+	if pos < 0 {
+		return pos, fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	return pos, nil
+}
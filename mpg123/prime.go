@@ -0,0 +1,84 @@
+// prime.go contains Prime, which does the work before the first audio ahead
+// of time so the first Read returns at once
+
+package mpg123
+
+/*
+#include "compat.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// primeMaxFrames bounds the frames Prime decodes looking for audio, as
+// gapless decoding can trim the whole first frame
+const primeMaxFrames = 4
+
+// Prime parses the stream headers and decodes the first frame of audio,
+// keeping it in the decoder, so that the output format is known and the next
+// Read (or ReadAudioFrames) returns immediately. Interactive applications
+// call it right after opening, while nothing waits for audio yet. No audio
+// is lost; positions reported by TellCurrentSample account for the kept
+// frame. In feed mode, enough data must have been fed.
+func (d *Decoder) Prime() (Format, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return Format{}, ErrDeleted
+	}
+	start := time.Now()
+	for i := 0; len(d.primed) == 0 && i < primeMaxFrames; i++ {
+		var num C.off_t
+		var audio *C.uchar
+		var bytes C.size_t
+		code := C.mpg123_decode_frame(d.handle, &num, &audio, &bytes)
+		if code == C.MPG123_NEW_FORMAT {
+			d.events(code)
+			i--
+			continue
+		}
+		if code == C.MPG123_DONE {
+			d.events(code)
+			return Format{}, EOF
+		}
+		if code == C.MPG123_NEED_MORE {
+			return Format{}, ErrFormatUnknown
+		}
+		if code != C.MPG123_OK {
+			return Format{}, fmt.Errorf("mpg123 error: %s", d.strerror())
+		}
+		if bytes > 0 {
+			d.primed = C.GoBytes(unsafe.Pointer(audio), C.int(bytes))
+		}
+	}
+	d.decoded(start, 0, C.MPG123_OK)
+	return d.outputFormat()
+}
+
+// takePrimed moves audio kept by Prime into buf and returns its length. It
+// is called with d locked.
+func (d *Decoder) takePrimed(buf []byte) int {
+	n := copy(buf, d.primed)
+	d.primed = d.primed[n:]
+	if len(d.primed) == 0 {
+		d.primed = nil
+	}
+	return n
+}
+
+// primedFrames returns the PCM frames kept by Prime and not read yet. It is
+// called with d locked.
+func (d *Decoder) primedFrames() int64 {
+	if len(d.primed) == 0 {
+		return 0
+	}
+	rate, channels, enc := d.getFormat()
+	if frameSize := (Format{rate, channels, enc}).BytesPerFrame(); frameSize > 0 {
+		return int64(len(d.primed) / frameSize)
+	}
+	return 0
+}
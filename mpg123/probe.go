@@ -0,0 +1,58 @@
+// probe.go contains sniffing of a stream's format without decoding it
+
+package mpg123
+
+import (
+	"fmt"
+	"io"
+)
+
+// probeLimit bounds how much input Probe reads; it has to cover large ID3v2
+// tags (cover art) in front of the first frame
+const probeLimit = 4 << 20
+
+// Probe reads just enough of r to parse the first MPEG frame header and
+// returns the output format and frame information, e.g. to sniff content
+// types or reject unsupported uploads before committing to a full decode.
+// The data read from r is consumed.
+func Probe(r io.Reader) (Format, FrameInfo, error) {
+	d, err := NewDecoder("")
+	if err != nil {
+		return Format{}, FrameInfo{}, err
+	}
+	defer d.Delete()
+	if err := d.Param(ADD_FLAGS, QUIET, 0); err != nil {
+		return Format{}, FrameInfo{}, err
+	}
+	if err := d.OpenFeed(); err != nil {
+		return Format{}, FrameInfo{}, err
+	}
+	defer d.Close()
+
+	buf := make([]byte, IN_MAX_BUFFER_SIZE)
+	total := 0
+	for total < probeLimit {
+		n, rerr := r.Read(buf)
+		total += n
+		if n > 0 {
+			if err := d.Feed(buf[:n]); err != nil {
+				return Format{}, FrameInfo{}, err
+			}
+			f, needMore, err := d.feedFormat()
+			if err != nil {
+				return Format{}, FrameInfo{}, err
+			}
+			if !needMore {
+				info, err := d.FrameInfo()
+				return f, info, err
+			}
+		}
+		if rerr == io.EOF {
+			return Format{}, FrameInfo{}, fmt.Errorf("mpg123 error: no MPEG frame found in %d bytes", total)
+		}
+		if rerr != nil {
+			return Format{}, FrameInfo{}, rerr
+		}
+	}
+	return Format{}, FrameInfo{}, fmt.Errorf("mpg123 error: no MPEG frame found in the first %d bytes", probeLimit)
+}
@@ -0,0 +1,139 @@
+package mpg123
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentUse runs Read against the seeking, query and setter methods
+// from other goroutines, then closes and deletes the decoder while they are
+// still running. Run it with -race.
+func TestConcurrentUse(t *testing.T) {
+	d := openSilence(t, 200)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	loop := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					f()
+				}
+			}
+		}()
+	}
+
+	buf := make([]byte, 4608)
+	loop(func() { d.Read(buf) })
+	loop(func() { d.Seek(0, io.SeekStart) })
+	loop(func() {
+		d.GetFormat()
+		d.TellCurrentSample()
+		d.TellCurrentFrame()
+		d.TellStream()
+		d.TellTime()
+		d.FramePos()
+		d.FrameInfo()
+		d.GetParam(FLAGS)
+		d.LengthInPCMFrames()
+		d.ByteOrder()
+	})
+	loop(func() {
+		d.Param(ADD_FLAGS, QUIET, 0)
+		d.SetMono(MonoGo)
+		d.SetMono(MonoOff)
+		d.SetProgress(func(done, total time.Duration) {})
+		d.Tee(io.Discard)
+		d.Tee(nil)
+		d.SetDucker(nil)
+	})
+	loop(func() {
+		d.FormatNone()
+		d.FormatAll()
+		d.Format(44100, STEREO, ENC_SIGNED_16)
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	d.Close()
+	time.Sleep(10 * time.Millisecond)
+	d.Delete()
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}
+
+// TestDeletedDecoder checks that the methods of a deleted decoder report
+// ErrDeleted or zero values instead of passing a nil handle to libmpg123
+func TestDeletedDecoder(t *testing.T) {
+	d := newTestDecoder(t)
+	d.Delete()
+
+	if err := d.Param(ADD_FLAGS, QUIET, 0); err != ErrDeleted {
+		t.Errorf("Param: got %v, want ErrDeleted", err)
+	}
+	if _, _, err := d.GetParam(FLAGS); err != ErrDeleted {
+		t.Errorf("GetParam: got %v, want ErrDeleted", err)
+	}
+	if _, err := d.FrameInfo(); err != ErrDeleted {
+		t.Errorf("FrameInfo: got %v, want ErrDeleted", err)
+	}
+	if _, _, err := d.FrameData(); err != ErrDeleted {
+		t.Errorf("FrameData: got %v, want ErrDeleted", err)
+	}
+	if _, _, err := d.State(ACCURATE); err != ErrDeleted {
+		t.Errorf("State: got %v, want ErrDeleted", err)
+	}
+	if rate, channels, enc := d.GetFormat(); rate != 0 || channels != 0 || enc != 0 {
+		t.Errorf("GetFormat: got %d, %d, %d", rate, channels, enc)
+	}
+	if pos := d.TellCurrentSample(); pos != 0 {
+		t.Errorf("TellCurrentSample: got %d", pos)
+	}
+	if pos := d.TellCurrentFrame(); pos != 0 {
+		t.Errorf("TellCurrentFrame: got %d", pos)
+	}
+	if pos := d.TellStream(); pos != 0 {
+		t.Errorf("TellStream: got %d", pos)
+	}
+	if pos := d.FramePos(); pos != 0 {
+		t.Errorf("FramePos: got %d", pos)
+	}
+	if _, err := d.Read(make([]byte, 16)); err != ErrDeleted {
+		t.Errorf("Read: got %v, want ErrDeleted", err)
+	}
+	for name, f := range map[string]func() error{
+		"Volume":       func() error { return d.Volume(0.5) },
+		"VolumeChange": func() error { return d.VolumeChange(0.1) },
+		"SetSound":     func() error { return d.SetSound(Sound{Volume: 1}) },
+		"EQ":           func() error { return d.EQ(LR, 0, 1) },
+		"ResetEQ":      d.ResetEQ,
+		"SetRVA":       func() error { return d.SetRVA(RVA_OFF) },
+		"FrameMap": func() error {
+			_, err := d.FrameMap()
+			return err
+		},
+		"Verify": func() error { return d.Verify().Err },
+	} {
+		if err := f(); err != ErrDeleted {
+			t.Errorf("%s: got %v, want ErrDeleted", name, err)
+		}
+	}
+	if base, really, rva := d.GetVolume(); base != 0 || really != 0 || rva != 0 {
+		t.Errorf("GetVolume: got %v, %v, %v", base, really, rva)
+	}
+	if gain := d.GetEQ(LR, 0); gain != 0 {
+		t.Errorf("GetEQ: got %v", gain)
+	}
+	if _, _, ok := d.measuredBitrate(); ok {
+		t.Error("measuredBitrate: got a bitrate")
+	}
+	d.FormatNone()
+	d.FormatAll()
+	d.Format(44100, STEREO, ENC_SIGNED_16)
+}
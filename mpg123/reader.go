@@ -0,0 +1,130 @@
+// reader.go contains the Go side of the custom reader callbacks that let
+// mpg123 decode from an io.Reader
+
+package mpg123
+
+/*
+#include <stdint.h>
+#include "compat.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"unsafe"
+)
+
+// maxEmptyReads is how many reads in a row may return no data and no error
+// before the input is given up with io.ErrNoProgress, as bufio does
+const maxEmptyReads = 100
+
+var (
+	readersMu  sync.Mutex
+	readers    = map[uintptr]*inputReader{}
+	nextReader uintptr
+)
+
+// inputReader is an io.Reader registered for the decoder d. mpg123 calls
+// back into it from decoder calls made with d locked, so it may set the
+// decoder's inputErr and write to its tee.
+type inputReader struct {
+	r io.Reader
+	d *Decoder
+}
+
+// registerReader stores r, the input of d, under a token that can be passed
+// through C
+func registerReader(d *Decoder, r io.Reader) uintptr {
+	readersMu.Lock()
+	defer readersMu.Unlock()
+	nextReader++
+	readers[nextReader] = &inputReader{r: r, d: d}
+	return nextReader
+}
+
+func unregisterReader(h uintptr) {
+	readersMu.Lock()
+	delete(readers, h)
+	readersMu.Unlock()
+}
+
+func lookupReader(h uintptr) *inputReader {
+	readersMu.Lock()
+	defer readersMu.Unlock()
+	return readers[h]
+}
+
+//export goReaderRead
+func goReaderRead(h C.uintptr_t, buf unsafe.Pointer, count C.size_t) (ret C.mpg123_ssize_t) {
+	defer func() {
+		if p := recover(); p != nil {
+			recovered(p)
+			ret = -1
+		}
+	}()
+	in := lookupReader(uintptr(h))
+	if in == nil {
+		return -1
+	}
+	n := int(count)
+	if f, ok := fault(OpReaderRead); ok {
+		if f.Code != OK {
+			return -1
+		}
+		n = limitFault(f, n)
+	}
+	p := unsafe.Slice((*byte)(buf), n)
+	for i := 0; i < maxEmptyReads; i++ {
+		n, err := in.r.Read(p)
+		if n > 0 {
+			if err := in.d.teeInput(p[:n]); err != nil {
+				in.d.inputErr = err
+				return -1
+			}
+			return C.mpg123_ssize_t(n)
+		}
+		if err == io.EOF {
+			return 0
+		}
+		if err != nil {
+			in.d.inputErr = fmt.Errorf("mpg123 error: reading input: %w", err)
+			return -1
+		}
+	}
+	in.d.inputErr = fmt.Errorf("mpg123 error: reading input: %w", io.ErrNoProgress)
+	return -1
+}
+
+//export goReaderSeek
+func goReaderSeek(h C.uintptr_t, offset C.off_t, whence C.int) (ret C.off_t) {
+	defer func() {
+		if p := recover(); p != nil {
+			recovered(p)
+			ret = -1
+		}
+	}()
+	in := lookupReader(uintptr(h))
+	if in == nil {
+		return -1
+	}
+	s, ok := in.r.(io.Seeker)
+	if !ok {
+		return -1
+	}
+	pos, err := s.Seek(int64(offset), int(whence))
+	if err != nil {
+		return -1
+	}
+	off, ok := offT(pos)
+	if !ok {
+		return -1
+	}
+	return off
+}
+
+//export goReaderCleanup
+func goReaderCleanup(h C.uintptr_t) {
+	unregisterReader(uintptr(h))
+}
@@ -0,0 +1,30 @@
+package mpg123
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+// stallReader returns no data and no error forever
+type stallReader struct{ reads int }
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	r.reads++
+	return 0, nil
+}
+
+func TestOpenReaderNoProgress(t *testing.T) {
+	d := newTestDecoder(t)
+	r := &stallReader{}
+	if err := d.OpenReader(r); err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	_, err := d.Read(make([]byte, 4608))
+	if !errors.Is(err, io.ErrNoProgress) {
+		t.Errorf("Read: got %v, want io.ErrNoProgress", err)
+	}
+	if r.reads == 0 || r.reads > maxEmptyReads {
+		t.Errorf("the reader was called %d times, want 1 to %d", r.reads, maxEmptyReads)
+	}
+}
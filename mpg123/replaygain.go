@@ -0,0 +1,105 @@
+// replaygain.go contains ReplayGain, the loudness adjustments stored in the
+// tags of a stream, for players applying track or album gain themselves
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// ReplayGain holds the ReplayGain values of a stream. Gains are in dB,
+// peaks are linear with 1 for full scale and 0 when not known.
+type ReplayGain struct {
+	TrackGain float64
+	TrackPeak float64
+	AlbumGain float64
+	AlbumPeak float64
+	HasTrack  bool // TrackGain is known
+	HasAlbum  bool // AlbumGain is known
+}
+
+// ReplayGain returns the ReplayGain values of the opened stream, taken from
+// the replaygain_* TXXX frames of the ID3v2 tag, else from what libmpg123
+// found in RVA2 frames or the LAME tag. Players can apply them themselves,
+// or leave that to the decoder with SetRVA(RVA_MIX) for track gain or
+// SetRVA(RVA_ALBUM) for album gain. Like ID3, it reads the first frame if
+// that has not happened yet.
+func (d *Decoder) ReplayGain() (ReplayGain, error) {
+	if _, err := d.readFormat(); err != nil {
+		return ReplayGain{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ReplayGain{}, ErrDeleted
+	}
+	rg := d.replayGainTags()
+	if !rg.HasTrack {
+		rg.TrackGain, rg.HasTrack = d.rvaGain(RVA_MIX)
+	}
+	if !rg.HasAlbum {
+		// libmpg123 gives the track gain when there is no album gain
+		if gain, ok := d.rvaGain(RVA_ALBUM); ok && (!rg.HasTrack || gain != rg.TrackGain) {
+			rg.AlbumGain, rg.HasAlbum = gain, true
+		}
+	}
+	return rg, nil
+}
+
+// replayGainTags reads the replaygain_* TXXX frames. It is called with d
+// locked.
+func (d *Decoder) replayGainTags() ReplayGain {
+	var rg ReplayGain
+	var v1 *C.mpg123_id3v1
+	var v2 *C.mpg123_id3v2
+	if C.mpg123_id3(d.handle, &v1, &v2) != C.MPG123_OK || v2 == nil {
+		return rg
+	}
+	text := mpgString
+	if d.plainID3Text() {
+		text = id3Text
+	}
+	for _, f := range unsafe.Slice(v2.extra, int(v2.extras)) {
+		// values look like "-6.48 dB" and "0.988553"
+		value := strings.TrimSpace(text(&f.text))
+		value = strings.TrimSpace(strings.TrimSuffix(strings.ToLower(value), "db"))
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		switch strings.ToLower(text(&f.description)) {
+		case "replaygain_track_gain":
+			rg.TrackGain, rg.HasTrack = v, true
+		case "replaygain_track_peak":
+			rg.TrackPeak = v
+		case "replaygain_album_gain":
+			rg.AlbumGain, rg.HasAlbum = v, true
+		case "replaygain_album_peak":
+			rg.AlbumPeak = v
+		}
+	}
+	return rg
+}
+
+// rvaGain returns the gain libmpg123 applies in RVA mode, briefly switching
+// to that mode. A gain of exactly 0 dB is taken as none. It is called with
+// d locked.
+func (d *Decoder) rvaGain(mode int) (float64, bool) {
+	var old C.long
+	var fval C.double
+	if C.mpg123_getparam(d.handle, C.MPG123_RVA, &old, &fval) != C.MPG123_OK {
+		return 0, false
+	}
+	defer C.mpg123_param(d.handle, C.MPG123_RVA, old, 0)
+	if C.mpg123_param(d.handle, C.MPG123_RVA, C.long(mode), 0) != C.MPG123_OK {
+		return 0, false
+	}
+	var db C.double
+	C.mpg123_getvolume(d.handle, nil, nil, &db)
+	return float64(db), db != 0
+}
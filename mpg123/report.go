@@ -0,0 +1,139 @@
+// report.go contains a frame by frame integrity check of a stream, reporting
+// skipped frames, resyncs and CRC failures
+
+package mpg123
+
+import "fmt"
+
+// Resync is a position where the decoder lost and regained frame sync
+type Resync struct {
+	Offset  int64 // input byte offset where the expected frame was missing
+	Skipped int64 // bytes skipped until the next valid frame
+}
+
+// StreamReport summarizes the integrity of a decoded stream
+type StreamReport struct {
+	Frames         int64    // MPEG frames decoded
+	SkippedFrames  int64    // frames the decoder dropped (gaps in frame numbering)
+	Resyncs        []Resync // places where junk data was skipped between frames
+	CRCChecked     int64    // Layer III frames carrying a CRC that was verified
+	CRCFailures    int64    // frames whose CRC did not match
+	Samples        int64    // PCM frames produced
+	ClaimedFrames  int64    // frame count claimed by the header (Xing/Info or estimate)
+	ClaimedSamples int64    // sample count claimed by the header
+	ClaimExact     bool     // the claims came from a Xing/Info header rather than an estimate
+	LengthMatched  bool     // the decoded frame count equals the claimed one
+	Err            error    // decoding error that ended the check early, if any
+}
+
+// CheckStream decodes the rest of the opened stream frame by frame and
+// reports on its integrity. Decoding errors end the check and are recorded in
+// the report rather than returned; the returned error is for misuse only.
+func (d *Decoder) CheckStream() (*StreamReport, error) {
+	r := &StreamReport{
+		ClaimedFrames:  int64(d.GetLengthInMPEGFrames()),
+		ClaimedSamples: d.LengthInPCMFrames(),
+	}
+	if accurate, _, err := d.State(ACCURATE); err == nil {
+		r.ClaimExact = accurate != 0
+	}
+
+	var nextPos int64 = -1
+	var lastNum int64 = -1
+	for {
+		if _, err := d.FrameByFrameNext(); err != nil {
+			if err != EOF {
+				r.Err = err
+			}
+			break
+		}
+		header, body, err := d.FrameData()
+		if err != nil {
+			r.Err = err
+			break
+		}
+		pos := d.FramePos()
+		if nextPos >= 0 && pos > nextPos {
+			r.Resyncs = append(r.Resyncs, Resync{Offset: nextPos, Skipped: pos - nextPos})
+		}
+		nextPos = pos + 4 + int64(len(body))
+
+		if ok, checked := checkLayer3CRC(header, body); checked {
+			r.CRCChecked++
+			if !ok {
+				r.CRCFailures++
+			}
+		}
+
+		num, audio, err := d.FrameByFrameDecode()
+		if err != nil {
+			r.Err = err
+			break
+		}
+		if lastNum >= 0 && num > lastNum+1 {
+			r.SkippedFrames += num - lastNum - 1
+		}
+		lastNum = num
+		r.Frames++
+		rate, channels, encoding := d.GetFormat()
+		if frameSize := (Format{rate, channels, encoding}).BytesPerFrame(); frameSize > 0 {
+			r.Samples += int64(len(audio) / frameSize)
+		}
+	}
+	r.LengthMatched = r.ClaimedFrames > 0 && r.Frames+r.SkippedFrames == r.ClaimedFrames
+	return r, nil
+}
+
+// String formats the report for logs
+func (r *StreamReport) String() string {
+	s := fmt.Sprintf("%d frames (%d skipped), %d samples, %d resyncs, %d/%d CRC failures, length matched: %v",
+		r.Frames, r.SkippedFrames, r.Samples, len(r.Resyncs), r.CRCFailures, r.CRCChecked, r.LengthMatched)
+	if r.Err != nil {
+		s += ", error: " + r.Err.Error()
+	}
+	return s
+}
+
+// checkLayer3CRC verifies the CRC-16 of a Layer III frame, which covers the
+// last two header bytes and the side information. checked is false for
+// frames without a CRC and for other layers.
+func checkLayer3CRC(header uint32, body []byte) (ok bool, checked bool) {
+	protected := header>>16&1 == 0
+	layer := 4 - int(header>>17&3)
+	if !protected || layer != 3 {
+		return false, false
+	}
+	mpeg1 := header>>19&3 == 3
+	mono := header>>6&3 == 3
+	var sideInfo int
+	switch {
+	case mpeg1 && mono:
+		sideInfo = 17
+	case mpeg1:
+		sideInfo = 32
+	case mono:
+		sideInfo = 9
+	default:
+		sideInfo = 17
+	}
+	if len(body) < 2+sideInfo {
+		return false, true
+	}
+	crc := crc16Update(0xffff, []byte{byte(header >> 8), byte(header)})
+	crc = crc16Update(crc, body[2:2+sideInfo])
+	return crc == uint16(body[0])<<8|uint16(body[1]), true
+}
+
+// crc16Update runs the MPEG audio CRC-16 (polynomial 0x8005) over data
+func crc16Update(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		for bit := 7; bit >= 0; bit-- {
+			top := crc>>15&1 != 0
+			crc <<= 1
+			if (b>>uint(bit)&1 != 0) != top {
+				crc ^= 0x8005
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,218 @@
+// resample.go contains a windowed sinc sample rate converter implemented in Go,
+// for cases where MPG123_FORCE_RATE or the NtoM decoder are not suitable
+
+package mpg123
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	resampleZeroCrossings = 16   // half width of the filter in input samples
+	resampleTableDensity  = 512  // filter table entries per input sample
+	resampleKaiserBeta    = 8.6  // stopband attenuation of roughly 90dB
+	resampleRolloff       = 0.95 // fraction of the lower nyquist rate that is kept
+)
+
+// Resampler is an io.Reader converting PCM audio read from src to another
+// sample rate. It works on any encoding supported by NewConverter.
+type Resampler struct {
+	src      io.Reader
+	codec    *sampleCodec
+	channels int
+	step     float64   // input frames per output frame
+	scale    float64   // filter scale, below 1 when downsampling
+	table    []float64 // one side of the windowed sinc filter
+
+	raw      []byte    // partial input frame carried over between reads
+	in       []float64 // buffered input samples, interleaved
+	pos      float64   // position of the next output frame in in
+	out      []byte    // encoded output not yet returned
+	inFrames int64
+	produced int64
+	eof      bool
+	padded   bool
+}
+
+// NewResampler creates a Resampler converting interleaved audio of the given
+// channel count and encoding from fromRate to toRate.
+// Samples are in host byte order.
+func NewResampler(src io.Reader, fromRate int, toRate int, channels int, encoding int) (*Resampler, error) {
+	return newResampler(src, fromRate, toRate, channels, encoding, nativeEndian)
+}
+
+// newResampler creates a Resampler for samples in the given byte order
+func newResampler(src io.Reader, fromRate int, toRate int, channels int, encoding int, order binary.ByteOrder) (*Resampler, error) {
+	if fromRate <= 0 || toRate <= 0 || channels <= 0 {
+		return nil, fmt.Errorf("mpg123 error: invalid resampler setup %d Hz -> %d Hz, %d channels", fromRate, toRate, channels)
+	}
+	codec, err := codecFor(encoding, order)
+	if err != nil {
+		return nil, err
+	}
+	r := &Resampler{
+		src:      src,
+		codec:    codec,
+		channels: channels,
+		step:     float64(fromRate) / float64(toRate),
+		scale:    math.Min(1, float64(toRate)/float64(fromRate)) * resampleRolloff,
+	}
+	r.table = resampleTable()
+	// start with silence so the first output frame can look back
+	r.pos = float64(r.reach())
+	r.in = make([]float64, r.reach()*channels)
+	return r, nil
+}
+
+// resampleTable builds one side of a Kaiser windowed sinc, sampled
+// resampleTableDensity times per zero crossing
+func resampleTable() []float64 {
+	n := resampleZeroCrossings*resampleTableDensity + 1
+	table := make([]float64, n)
+	norm := besselI0(resampleKaiserBeta)
+	for i := range table {
+		x := float64(i) / resampleTableDensity
+		r := x / resampleZeroCrossings
+		w := besselI0(resampleKaiserBeta*math.Sqrt(1-r*r)) / norm
+		if x == 0 {
+			table[i] = w
+		} else {
+			table[i] = w * math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+	}
+	return table
+}
+
+// besselI0 is the zeroth order modified Bessel function of the first kind
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; k < 50; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+		if term < sum*1e-12 {
+			break
+		}
+	}
+	return sum
+}
+
+// kernel evaluates the filter at distance x (in filter time) from its center
+func (r *Resampler) kernel(x float64) float64 {
+	x = math.Abs(x) * resampleTableDensity
+	i := int(x)
+	if i >= len(r.table)-1 {
+		return 0
+	}
+	frac := x - float64(i)
+	return r.table[i] + frac*(r.table[i+1]-r.table[i])
+}
+
+// Read fills p with resampled audio. It only returns whole frames.
+func (r *Resampler) Read(p []byte) (int, error) {
+	frameSize := r.channels * r.codec.size
+	if len(p) < frameSize {
+		return 0, io.ErrShortBuffer
+	}
+	for len(r.out) == 0 {
+		if r.produce() {
+			continue
+		}
+		if r.eof {
+			if r.padded {
+				return 0, io.EOF
+			}
+			// flush the filter with trailing silence
+			r.in = append(r.in, make([]float64, (r.reach()+1)*r.channels)...)
+			r.padded = true
+			continue
+		}
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p[:len(p)/frameSize*frameSize], r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// fill reads more input from src
+func (r *Resampler) fill() error {
+	buf := make([]byte, IN_MAX_BUFFER_SIZE)
+	n, err := r.src.Read(buf)
+	r.raw = append(r.raw, buf[:n]...)
+	frameSize := r.channels * r.codec.size
+	frames := len(r.raw) / frameSize
+	for i := 0; i < frames*r.channels; i++ {
+		r.in = append(r.in, r.codec.get(r.raw[i*r.codec.size:(i+1)*r.codec.size]))
+	}
+	r.raw = r.raw[frames*frameSize:]
+	r.inFrames += int64(frames)
+	if err == io.EOF {
+		r.eof = true
+		return nil
+	}
+	return err
+}
+
+// produce converts as many output frames as the buffered input allows and
+// reports whether any were produced
+func (r *Resampler) produce() bool {
+	avail := len(r.in) / r.channels
+	total := int64(math.Ceil(float64(r.inFrames) / r.step))
+	var out []float64
+	for {
+		if r.eof && r.produced >= total {
+			break
+		}
+		if int(r.pos)+r.reach() >= avail {
+			break
+		}
+		r.frame(&out)
+		r.produced++
+		r.pos += r.step
+	}
+	if len(out) == 0 {
+		return false
+	}
+	r.out = make([]byte, len(out)*r.codec.size)
+	for i, v := range out {
+		r.codec.put(r.out[i*r.codec.size:(i+1)*r.codec.size], v)
+	}
+	// drop input that no future output frame can reach
+	drop := int(r.pos) - r.reach()
+	if drop > 0 {
+		r.in = append(r.in[:0], r.in[drop*r.channels:]...)
+		r.pos -= float64(drop)
+	}
+	return true
+}
+
+// reach is the number of input frames the filter extends to either side
+func (r *Resampler) reach() int {
+	return int(math.Ceil(resampleZeroCrossings / r.scale))
+}
+
+// frame computes one output frame at r.pos and appends it to out
+func (r *Resampler) frame(out *[]float64) {
+	reach := r.reach()
+	center := int(r.pos)
+	first := center - reach + 1
+	if first < 0 {
+		first = 0
+	}
+	last := center + reach
+	acc := make([]float64, r.channels)
+	for k := first; k <= last; k++ {
+		w := r.scale * r.kernel((r.pos-float64(k))*r.scale)
+		if w == 0 {
+			continue
+		}
+		for ch := range acc {
+			acc[ch] += w * r.in[k*r.channels+ch]
+		}
+	}
+	*out = append(*out, acc...)
+}
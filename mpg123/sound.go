@@ -0,0 +1,127 @@
+// sound.go contains the sound controls of a decoder: equalizer, volume and
+// RVA. They may be changed while another goroutine reads, for the live
+// controls of players and servers.
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import "fmt"
+
+// Channels of the equalizer
+const (
+	LEFT  = C.MPG123_LEFT
+	RIGHT = C.MPG123_RIGHT
+	LR    = C.MPG123_LR
+)
+
+// RVA modes, the replay gain libmpg123 applies from the tags
+const (
+	RVA_OFF   = C.MPG123_RVA_OFF
+	RVA_MIX   = C.MPG123_RVA_MIX // track gain
+	RVA_ALBUM = C.MPG123_RVA_ALBUM
+)
+
+// EQBands is the number of equalizer bands
+const EQBands = 32
+
+// Sound is a set of sound settings applied at once by SetSound
+type Sound struct {
+	Volume float64   // linear, 1 for the original level
+	RVA    int       // RVA_OFF, RVA_MIX or RVA_ALBUM
+	EQ     []float64 // linear gain of the first bands, for both channels; the others are flat
+}
+
+// SetSound applies s as a whole between two reads: a Read running in
+// another goroutine finishes with the old settings and the next one uses
+// all of the new ones. Invalid settings are rejected before anything
+// changes.
+func (d *Decoder) SetSound(s Sound) error {
+	if s.Volume < 0 {
+		return fmt.Errorf("mpg123 error: negative volume %v", s.Volume)
+	}
+	if s.RVA < RVA_OFF || s.RVA > RVA_ALBUM {
+		return fmt.Errorf("mpg123 error: invalid RVA mode %d", s.RVA)
+	}
+	if len(s.EQ) > EQBands {
+		return fmt.Errorf("mpg123 error: %d equalizer bands, at most %d", len(s.EQ), EQBands)
+	}
+	for band, gain := range s.EQ {
+		if gain < 0 {
+			return fmt.Errorf("mpg123 error: negative gain %v in band %d", gain, band)
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	if err := C.mpg123_reset_eq(d.handle); err != C.MPG123_OK {
+		return fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	for band, gain := range s.EQ {
+		if err := C.mpg123_eq(d.handle, C.MPG123_LR, C.int(band), C.double(gain)); err != C.MPG123_OK {
+			return fmt.Errorf("mpg123 error: %s", d.strerror())
+		}
+	}
+	if err := C.mpg123_param(d.handle, C.MPG123_RVA, C.long(s.RVA), 0); err != C.MPG123_OK {
+		return fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	if err := C.mpg123_volume(d.handle, C.double(s.Volume)); err != C.MPG123_OK {
+		return fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	return nil
+}
+
+// EQ sets the linear gain of an equalizer band (0 to EQBands-1) of channel
+// LEFT, RIGHT or LR, taking effect with the next read
+func (d *Decoder) EQ(channel int, band int, gain float64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	if err := C.mpg123_eq(d.handle, uint32(channel), C.int(band), C.double(gain)); err != C.MPG123_OK {
+		return fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	return nil
+}
+
+// GetEQ returns the linear gain of an equalizer band of channel LEFT or
+// RIGHT, or the mean of both for LR
+func (d *Decoder) GetEQ(channel int, band int) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return 0
+	}
+	return float64(C.mpg123_geteq(d.handle, uint32(channel), C.int(band)))
+}
+
+// ResetEQ makes the equalizer flat again
+func (d *Decoder) ResetEQ() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	if err := C.mpg123_reset_eq(d.handle); err != C.MPG123_OK {
+		return fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	return nil
+}
+
+// SetRVA selects the replay gain applied from the tags: RVA_OFF, RVA_MIX or
+// RVA_ALBUM
+func (d *Decoder) SetRVA(mode int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handle == nil {
+		return ErrDeleted
+	}
+	if err := C.mpg123_param(d.handle, C.MPG123_RVA, C.long(mode), 0); err != C.MPG123_OK {
+		return fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	return nil
+}
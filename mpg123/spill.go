@@ -0,0 +1,214 @@
+// spill.go contains SpillBuffer, a bounded buffer between a fast producer,
+// such as a live stream being recorded, and a decoder that falls behind,
+// keeping a little in memory and spilling the rest to a temporary file
+
+package mpg123
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrSpillClosed is returned by a SpillBuffer after Close
+var ErrSpillClosed = errors.New("mpg123 error: spill buffer closed")
+
+// SpillBuffer is a FIFO of bytes holding up to a memory limit in memory and
+// up to a disk limit more in a temporary file, created when first needed
+// and used as a ring. A writer blocks while both are full, so nothing is
+// dropped and neither grows without bound; a reader blocks while it is
+// empty. Writing and reading may happen in different goroutines.
+type SpillBuffer struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	mem      []byte // bytes in memory, oldest first, starting at memOff
+	memOff   int
+	memLimit int
+
+	dir       string
+	file      *os.File
+	diskLimit int64
+	head      int64 // ring offset of the oldest byte on disk
+	size      int64 // bytes on disk
+
+	writeErr error // set by CloseWrite: reads return it once drained
+	closed   bool
+}
+
+// NewSpillBuffer returns a SpillBuffer keeping up to memory bytes in memory
+// and disk bytes in a temporary file in dir ("" for os.TempDir()).
+func NewSpillBuffer(memory int, disk int64, dir string) (*SpillBuffer, error) {
+	if memory <= 0 || disk < 0 {
+		return nil, fmt.Errorf("mpg123 error: invalid spill buffer limits %d/%d", memory, disk)
+	}
+	b := &SpillBuffer{memLimit: memory, dir: dir, diskLimit: disk}
+	b.cond = sync.NewCond(&b.mu)
+	return b, nil
+}
+
+// SpillReader returns a SpillBuffer filled from r in a new goroutine until r
+// ends. Reading it returns the data of r, then the error r ended with, or
+// io.EOF. Close it to stop the copy.
+func SpillReader(r io.Reader, memory int, disk int64, dir string) (*SpillBuffer, error) {
+	b, err := NewSpillBuffer(memory, disk, dir)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				b.CloseWrite(recovered(p))
+			}
+		}()
+		_, err := io.Copy(b, r)
+		b.CloseWrite(err)
+	}()
+	return b, nil
+}
+
+// Buffered returns the number of bytes held in memory and on disk
+func (b *SpillBuffer) Buffered() (memory int, disk int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.mem) - b.memOff, b.size
+}
+
+// full reports whether a write has to wait. It is called with b locked.
+func (b *SpillBuffer) full() bool {
+	memFull := b.size > 0 || len(b.mem)-b.memOff >= b.memLimit
+	return memFull && b.size >= b.diskLimit
+}
+
+// Write appends p, blocking while the buffer is full. Data goes to memory
+// unless it is full or older data waits on disk, to keep the order.
+func (b *SpillBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for len(p) > 0 {
+		for !b.closed && b.writeErr == nil && b.full() {
+			b.cond.Wait()
+		}
+		if b.closed || b.writeErr != nil {
+			return n, ErrSpillClosed
+		}
+		var k int
+		if held := len(b.mem) - b.memOff; b.size == 0 && held < b.memLimit {
+			k = min(len(p), b.memLimit-held)
+			if b.memOff > 0 && len(b.mem)+k > b.memLimit {
+				// move the unread bytes to the front rather than grow
+				b.mem = append(b.mem[:0], b.mem[b.memOff:]...)
+				b.memOff = 0
+			}
+			b.mem = append(b.mem, p[:k]...)
+		} else {
+			var err error
+			if k, err = b.spill(p); err != nil {
+				return n, err
+			}
+		}
+		p = p[k:]
+		n += k
+		b.cond.Broadcast()
+	}
+	return n, nil
+}
+
+// spill writes as much of p to the ring file as fits and returns how much
+// it wrote. It is called with b locked.
+func (b *SpillBuffer) spill(p []byte) (int, error) {
+	if b.file == nil {
+		f, err := os.CreateTemp(b.dir, "mpg123-spill-*")
+		if err != nil {
+			return 0, fmt.Errorf("mpg123 error: spill file: %w", err)
+		}
+		b.file = f
+	}
+	tail := (b.head + b.size) % b.diskLimit
+	k := int(min(int64(len(p)), b.diskLimit-b.size, b.diskLimit-tail))
+	if _, err := b.file.WriteAt(p[:k], tail); err != nil {
+		return 0, fmt.Errorf("mpg123 error: spill file: %w", err)
+	}
+	b.size += int64(k)
+	return k, nil
+}
+
+// Read reads the oldest buffered bytes, blocking while the buffer is empty.
+// After CloseWrite it returns the rest, then the error passed to it, or
+// io.EOF.
+func (b *SpillBuffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for !b.closed && b.writeErr == nil && len(b.mem) == b.memOff && b.size == 0 {
+		b.cond.Wait()
+	}
+	switch {
+	case b.closed:
+		return 0, ErrSpillClosed
+	case len(b.mem) > b.memOff:
+		n := copy(p, b.mem[b.memOff:])
+		b.memOff += n
+		if b.memOff == len(b.mem) {
+			b.mem, b.memOff = b.mem[:0], 0
+		}
+		b.cond.Broadcast()
+		return n, nil
+	case b.size > 0:
+		k := int(min(int64(len(p)), b.size, b.diskLimit-b.head))
+		n, err := b.file.ReadAt(p[:k], b.head)
+		b.head = (b.head + int64(n)) % b.diskLimit
+		b.size -= int64(n)
+		if b.size == 0 {
+			b.head = 0
+		}
+		b.cond.Broadcast()
+		if err != nil && n < k {
+			return n, fmt.Errorf("mpg123 error: spill file: %w", err)
+		}
+		return n, nil
+	}
+	return 0, b.writeErr
+}
+
+// CloseWrite ends the data: reads return what is buffered, then err, or
+// io.EOF if err is nil. Further writes fail.
+func (b *SpillBuffer) CloseWrite(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.writeErr == nil {
+		b.writeErr = err
+	}
+	b.cond.Broadcast()
+}
+
+// Close discards the buffered data, removes the spill file and makes
+// blocked and later reads and writes fail with ErrSpillClosed
+func (b *SpillBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	b.mem = nil
+	b.cond.Broadcast()
+	if b.file == nil {
+		return nil
+	}
+	name := b.file.Name()
+	err := b.file.Close()
+	if rerr := os.Remove(name); err == nil {
+		err = rerr
+	}
+	b.file = nil
+	return err
+}
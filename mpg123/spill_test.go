@@ -0,0 +1,212 @@
+package mpg123
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// pattern returns n bytes that do not repeat within 251 bytes, so data read
+// out of order or from the wrong ring offset shows up
+func pattern(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+func readN(t *testing.T, b *SpillBuffer, n int) []byte {
+	t.Helper()
+	got := make([]byte, n)
+	if _, err := io.ReadFull(b, got); err != nil {
+		t.Fatalf("reading %d bytes: %v", n, err)
+	}
+	return got
+}
+
+func checkBuffered(t *testing.T, b *SpillBuffer, memory int, disk int64) {
+	t.Helper()
+	if m, d := b.Buffered(); m != memory || d != disk {
+		t.Errorf("Buffered: got %d/%d, want %d/%d", m, d, memory, disk)
+	}
+}
+
+// TestSpillWraparound fills memory and the ring file, frees the start of the
+// ring and writes again, so the new data wraps to offset 0 of the file
+func TestSpillWraparound(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewSpillBuffer(2, 5, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pattern(10)
+	if n, err := b.Write(data[:7]); n != 7 || err != nil {
+		t.Fatalf("Write: %d, %v", n, err)
+	}
+	checkBuffered(t, b, 2, 5)
+	if got := readN(t, b, 5); !bytes.Equal(got, data[:5]) {
+		t.Fatalf("got % x, want % x", got, data[:5])
+	}
+	checkBuffered(t, b, 0, 2)
+	// memory is free, but older data on disk keeps the new bytes out of it
+	if n, err := b.Write(data[7:]); n != 3 || err != nil {
+		t.Fatalf("Write: %d, %v", n, err)
+	}
+	checkBuffered(t, b, 0, 5)
+	if got := readN(t, b, 5); !bytes.Equal(got, data[5:]) {
+		t.Errorf("got % x, want % x", got, data[5:])
+	}
+	checkBuffered(t, b, 0, 0)
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("spill file left behind: %v", entries)
+	}
+}
+
+// TestSpillOrder pushes data through a small buffer with a slower reader,
+// so it passes through memory and the ring file many times
+func TestSpillOrder(t *testing.T) {
+	b, err := NewSpillBuffer(7, 13, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	data := pattern(5000)
+	go func() {
+		for p := data; len(p) > 0; {
+			k := min(len(p), 3+len(p)%11)
+			if _, err := b.Write(p[:k]); err != nil {
+				b.CloseWrite(err)
+				return
+			}
+			p = p[k:]
+		}
+		b.CloseWrite(nil)
+	}()
+	var got []byte
+	buf := make([]byte, 5)
+	for {
+		n, err := b.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got, data) {
+		for i := range got {
+			if i >= len(data) || got[i] != data[i] {
+				t.Fatalf("data differs at byte %d of %d (read %d)", i, len(data), len(got))
+			}
+		}
+		t.Fatalf("read %d of %d bytes", len(got), len(data))
+	}
+}
+
+// blocked runs f, checks that it is still waiting a little later, then
+// calls release and returns the error f ended with
+func blocked(t *testing.T, f func() error, release func()) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- f() }()
+	select {
+	case err := <-done:
+		t.Fatalf("returned without blocking: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("still blocked after release")
+	}
+	return nil
+}
+
+func TestSpillUnblock(t *testing.T) {
+	newBuffer := func(t *testing.T) *SpillBuffer {
+		b, err := NewSpillBuffer(2, 2, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { b.Close() })
+		return b
+	}
+	read := func(b *SpillBuffer) func() error {
+		return func() error {
+			_, err := b.Read(make([]byte, 1))
+			return err
+		}
+	}
+	errStream := errors.New("stream ended")
+
+	t.Run("read CloseWrite", func(t *testing.T) {
+		b := newBuffer(t)
+		if err := blocked(t, read(b), func() { b.CloseWrite(nil) }); err != io.EOF {
+			t.Errorf("got %v, want io.EOF", err)
+		}
+	})
+	t.Run("read CloseWrite error", func(t *testing.T) {
+		b := newBuffer(t)
+		if err := blocked(t, read(b), func() { b.CloseWrite(errStream) }); err != errStream {
+			t.Errorf("got %v, want %v", err, errStream)
+		}
+	})
+	t.Run("read Close", func(t *testing.T) {
+		b := newBuffer(t)
+		if err := blocked(t, read(b), func() { b.Close() }); err != ErrSpillClosed {
+			t.Errorf("got %v, want ErrSpillClosed", err)
+		}
+	})
+	t.Run("write Close", func(t *testing.T) {
+		b := newBuffer(t)
+		var n int
+		write := func() (err error) {
+			n, err = b.Write(pattern(6))
+			return err
+		}
+		if err := blocked(t, write, func() { b.Close() }); err != ErrSpillClosed {
+			t.Errorf("got %v, want ErrSpillClosed", err)
+		}
+		if n != 4 {
+			t.Errorf("wrote %d bytes, want the 4 that fit", n)
+		}
+	})
+	t.Run("write CloseWrite", func(t *testing.T) {
+		b := newBuffer(t)
+		write := func() error {
+			_, err := b.Write(pattern(6))
+			return err
+		}
+		if err := blocked(t, write, func() { b.CloseWrite(nil) }); err != ErrSpillClosed {
+			t.Errorf("got %v, want ErrSpillClosed", err)
+		}
+		// what was written before is still delivered
+		if got := readN(t, b, 4); !bytes.Equal(got, pattern(4)) {
+			t.Errorf("got % x, want % x", got, pattern(4))
+		}
+		if _, err := b.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("read after the data: got %v, want io.EOF", err)
+		}
+	})
+	t.Run("after Close", func(t *testing.T) {
+		b := newBuffer(t)
+		b.Close()
+		if _, err := b.Write([]byte{1}); err != ErrSpillClosed {
+			t.Errorf("Write: got %v, want ErrSpillClosed", err)
+		}
+		if _, err := b.Read(make([]byte, 1)); err != ErrSpillClosed {
+			t.Errorf("Read: got %v, want ErrSpillClosed", err)
+		}
+	})
+}
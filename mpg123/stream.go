@@ -0,0 +1,72 @@
+// stream.go contains decoding into a channel, for programs built around
+// select rather than blocking Read loops
+
+package mpg123
+
+import "context"
+
+// Chunk is a piece of decoded audio sent by Stream
+type Chunk struct {
+	Block             // Data is owned by the receiver
+	Format     Format // output format of Data
+	Generation uint64 // increases whenever the output format changes
+}
+
+// streamBuffer is the size of the channel returned by Stream, so decoding
+// can run a little ahead of a slow receiver
+const streamBuffer = 4
+
+// Stream decodes the rest of the stream in a new goroutine and sends it as
+// chunks. The chunk channel is closed at the end of the stream, after a
+// decoding error or when ctx is done; the error channel then yields the
+// error, if any, and is closed too. ctx.Err() is reported when ctx ends the
+// stream. The decoder must not be used otherwise until the chunk channel is
+// closed.
+func (d *Decoder) Stream(ctx context.Context) (<-chan Chunk, <-chan error) {
+	chunks := make(chan Chunk, streamBuffer)
+	errc := make(chan error, 1)
+	d.goLabeled(func() {
+		defer close(errc)
+		defer close(chunks)
+		defer func() {
+			if p := recover(); p != nil {
+				errc <- recovered(p)
+			}
+		}()
+		for {
+			if err := ctx.Err(); err != nil {
+				errc <- err
+				return
+			}
+			buf := make([]byte, OUT_MAX_BUFFER_SIZE)
+			b, err := d.ReadBlock(buf)
+			if len(b.Data) > 0 {
+				c := Chunk{Block: b}
+				c.Format, c.Generation = d.streamFormat()
+				select {
+				case chunks <- c:
+				case <-ctx.Done():
+					errc <- ctx.Err()
+					return
+				}
+			}
+			if err == EOF {
+				return
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	})
+	return chunks, errc
+}
+
+// streamFormat returns the output format of the data Read returns, with its
+// generation
+func (d *Decoder) streamFormat() (Format, uint64) {
+	f, _ := d.readFormat()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return f, d.formatGen
+}
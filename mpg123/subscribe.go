@@ -0,0 +1,98 @@
+// subscribe.go contains event subscriptions, delivering format changes,
+// metadata updates, end of stream and errors to the application whichever
+// read API it uses
+
+package mpg123
+
+import "errors"
+
+// EventKind selects events for Subscribe. Kinds can be or-ed together.
+type EventKind int
+
+const (
+	// EventFormatChange is sent when the output format changes, with the
+	// new format
+	EventFormatChange EventKind = 1 << iota
+	// EventMeta is sent when the stream carries new ID3 tags or, for HTTP
+	// streams, new ICY metadata
+	EventMeta
+	// EventEOF is sent when the end of the stream is reached
+	EventEOF
+	// EventError is sent for every error libmpg123 reports
+	EventError
+	// EventTrack is sent when decoding reaches the next of several chained
+	// streams, see SetChained
+	EventTrack
+)
+
+// Event is delivered to the handlers passed to Subscribe
+type Event struct {
+	Kind   EventKind
+	Format Format      // EventFormatChange: the new output format
+	ICY    *ICYMeta    // EventMeta: the new ICY metadata, nil if only the tags changed
+	ID3    *ID3Tag     // EventMeta: the new ID3 tags, nil if only the ICY metadata changed
+	Code   int         // EventError: the libmpg123 error code
+	Err    error       // EventError: the error
+	Track  int         // EventTrack: the number of the new track, counting from 0
+	Tags   *TagSummary // EventTrack: the tags of the new track
+}
+
+// subscription is one handler registered with Subscribe
+type subscription struct {
+	kinds   EventKind
+	handler func(Event)
+}
+
+// Subscribe calls handler for the events selected by kinds and returns a
+// function that ends the subscription. Handlers run on the goroutine that
+// triggered the event, often while the decoder is locked, so they must not
+// call methods of the decoder; hand the event over to another goroutine if
+// they need to.
+func (d *Decoder) Subscribe(kinds EventKind, handler func(Event)) (cancel func()) {
+	s := &subscription{kinds: kinds, handler: handler}
+	d.subMu.Lock()
+	d.subs = append(d.subs, s)
+	d.subMu.Unlock()
+	return func() {
+		d.subMu.Lock()
+		defer d.subMu.Unlock()
+		for i, t := range d.subs {
+			if t == s {
+				d.subs = append(d.subs[:i:i], d.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// subscribed reports whether any handler wants events of kind
+func (d *Decoder) subscribed(kind EventKind) bool {
+	d.subMu.Lock()
+	defer d.subMu.Unlock()
+	for _, s := range d.subs {
+		if s.kinds&kind != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// emit delivers e to the handlers subscribed to its kind
+func (d *Decoder) emit(e Event) {
+	d.subMu.Lock()
+	var handlers []func(Event)
+	for _, s := range d.subs {
+		if s.kinds&e.Kind != 0 {
+			handlers = append(handlers, s.handler)
+		}
+	}
+	d.subMu.Unlock()
+	for _, h := range handlers {
+		h(e)
+	}
+}
+
+// emitError sends an EventError for a libmpg123 error code and message
+func (d *Decoder) emitError(code int, msg string) {
+	d.emit(Event{Kind: EventError, Code: code, Err: errors.New("mpg123 error: " + msg)})
+}
@@ -0,0 +1,60 @@
+// tagoptions.go contains SetTagOptions, choosing how much of the tags
+// libmpg123 parses and keeps, so jobs that ignore tags do not pay for them
+
+package mpg123
+
+// TagOptions selects how libmpg123 treats tags. Options can be or-ed
+// together; the zero value is the default of parsing ID3v2 tags into UTF-8
+// text without pictures.
+type TagOptions int
+
+const (
+	// TagSkipID3v2 skips ID3v2 tags without parsing or storing them,
+	// saving the time and memory of large tags with cover art. ID3v1 tags
+	// and ICY metadata are still read.
+	TagSkipID3v2 TagOptions = 1 << iota
+	// TagPlainText keeps ID3v2 text in its original encoding inside
+	// libmpg123; ID3 and Metadata still return UTF-8
+	TagPlainText
+	// TagPictures also parses attached pictures (APIC frames)
+	TagPictures
+	// TagStoreRaw keeps the raw tags for RawID3, even with TagSkipID3v2
+	TagStoreRaw
+)
+
+// tagFlags maps each TagOptions bit to its libmpg123 flag
+var tagFlags = []struct {
+	opt  TagOptions
+	flag int64
+}{
+	{TagSkipID3v2, SKIP_ID3V2},
+	{TagPlainText, PLAIN_ID3TEXT},
+	{TagPictures, PICTURE},
+	{TagStoreRaw, STORE_RAW_ID3},
+}
+
+// SetTagOptions sets how the tags of the next stream opened are treated,
+// setting the flags of the options in o and clearing the others. It must be
+// called before the stream is opened. TagStoreRaw needs FEATURE_RAW_ID3.
+func (d *Decoder) SetTagOptions(o TagOptions) error {
+	if o&TagStoreRaw != 0 {
+		if err := d.require(FEATURE_RAW_ID3); err != nil {
+			return err
+		}
+	}
+	for _, t := range tagFlags {
+		param := REMOVE_FLAGS
+		if o&t.opt != 0 {
+			param = ADD_FLAGS
+		}
+		if err := d.Param(param, t.flag, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithTagOptions sets how the tags are treated, see SetTagOptions
+func WithTagOptions(o TagOptions) Option {
+	return func(c *readerConfig) { c.tags = o }
+}
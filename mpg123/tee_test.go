@@ -0,0 +1,23 @@
+package mpg123
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestTeeOpenReader(t *testing.T) {
+	input := silentMP3(20)
+	d := newTestDecoder(t)
+	var copied bytes.Buffer
+	d.Tee(&copied)
+	if err := d.OpenReader(bytes.NewReader(input)); err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	if _, err := io.Copy(io.Discard, d); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	if !bytes.Equal(copied.Bytes(), input) {
+		t.Errorf("tee copied %d bytes, want the %d bytes of input", copied.Len(), len(input))
+	}
+}
@@ -0,0 +1,63 @@
+// text.go contains the conversion of tag and ICY text to UTF-8, so Go
+// strings are valid whatever encoding the text was stored in
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"strings"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// utf8Text converts b, text in encoding enc, to UTF-8 with
+// mpg123_store_utf8. Should that fail, invalid bytes are replaced.
+func utf8Text(b []byte, enc C.enum_mpg123_text_encoding) string {
+	if len(b) == 0 {
+		return ""
+	}
+	var sb C.mpg123_string
+	C.mpg123_init_string(&sb)
+	defer C.mpg123_free_string(&sb)
+	if C.mpg123_store_utf8(&sb, enc, (*C.uchar)(unsafe.Pointer(&b[0])), C.size_t(len(b))) == 0 {
+		return strings.ToValidUTF8(string(b), "\uFFFD")
+	}
+	return mpgString(&sb)
+}
+
+// latin1Text converts text of unknown 8 bit encoding, as found in ID3v1
+// tags: UTF-8 is kept, anything else is read as CP1252, the superset of
+// Latin-1 most taggers actually write
+func latin1Text(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return utf8Text(b, C.mpg123_text_cp1252)
+}
+
+// icyText converts ICY metadata, which is UTF-8 or else CP1252
+func icyText(b []byte) string {
+	return utf8Text(b, C.mpg123_text_icy)
+}
+
+// id3Text converts an ID3v2 text field kept raw because of PLAIN_ID3TEXT:
+// its first byte names the encoding of the rest
+func id3Text(s *C.mpg123_string) string {
+	if s == nil || s.p == nil || s.fill == 0 {
+		return ""
+	}
+	b := C.GoBytes(unsafe.Pointer(s.p), C.int(s.fill))
+	text := utf8Text(b[1:], C.mpg123_enc_from_id3(C.uchar(b[0])))
+	return strings.TrimRight(text, "\x00")
+}
+
+// plainID3Text reports whether PLAIN_ID3TEXT is set, leaving ID3v2 text in
+// its original encoding. It is called with d locked.
+func (d *Decoder) plainID3Text() bool {
+	var flags C.long
+	var fval C.double
+	return C.mpg123_getparam(d.handle, C.MPG123_FLAGS, &flags, &fval) == C.MPG123_OK &&
+		flags&C.MPG123_PLAIN_ID3TEXT != 0
+}
@@ -0,0 +1,226 @@
+// timeout.go contains watchdog timeouts for decoder operations waiting on
+// their input, so a server is not held up forever by a stalled upload or
+// network source
+
+package mpg123
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Timeouts bounds how long decoder operations wait for input. Zero fields
+// leave an operation unbounded.
+type Timeouts struct {
+	Open       time.Duration // connecting in OpenURL, and the input read by an Open call
+	FirstFrame time.Duration // from opening a stream until Read first returns audio
+	Read       time.Duration // each Read, including the input it waits for
+}
+
+// TimeoutError is returned by an operation that ran out of time waiting for
+// its input. It matches os.ErrDeadlineExceeded with errors.Is.
+type TimeoutError struct {
+	Op    string        // "open", "first frame" or "read"
+	After time.Duration // the timeout that expired
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("mpg123 error: %s timed out after %v", e.Op, e.After)
+}
+
+// Timeout reports true, as net.Error does for timeouts
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == os.ErrDeadlineExceeded
+}
+
+// watchdog is the state of the timeouts set by SetTimeouts
+type watchdog struct {
+	limits   Timeouts
+	opened   time.Time // when the stream was opened
+	gotAudio bool      // Read returned audio since
+	deadline time.Time // of the running operation, zero if none
+	op       *TimeoutError
+	expired  *TimeoutError // set when an input read missed the deadline
+}
+
+// SetTimeouts sets the timeouts of the decoder. A timed out read of an
+// io.Reader keeps running in the background if the reader has no
+// SetReadDeadline method; its data is used by the next read, but the
+// decoder is best closed, as a stalled input rarely recovers.
+func (d *Decoder) SetTimeouts(t Timeouts) error {
+	if t.Open < 0 || t.FirstFrame < 0 || t.Read < 0 {
+		return fmt.Errorf("mpg123 error: negative timeout")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.watch.limits = t
+	return nil
+}
+
+// timeouts returns the timeouts set by SetTimeouts
+func (d *Decoder) timeouts() Timeouts {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.watch.limits
+}
+
+// watchStart sets the deadline of an operation, "open" or "read", and the
+// first frame deadline while no audio was read yet. It is called with d
+// locked.
+func (d *Decoder) watchStart(op string) {
+	w := &d.watch
+	w.deadline, w.op, w.expired = time.Time{}, nil, nil
+	now := time.Now()
+	limit := w.limits.Read
+	if op == "open" {
+		limit = w.limits.Open
+	}
+	if limit > 0 {
+		w.deadline, w.op = now.Add(limit), &TimeoutError{Op: op, After: limit}
+	}
+	if op == "read" && !w.gotAudio && w.limits.FirstFrame > 0 {
+		if first := w.opened.Add(w.limits.FirstFrame); w.deadline.IsZero() || first.Before(w.deadline) {
+			w.deadline, w.op = first, &TimeoutError{Op: "first frame", After: w.limits.FirstFrame}
+		}
+	}
+}
+
+// watchEnd ends the operation, which returned n bytes of audio, and returns
+// the timeout error if it ran out of time. It is called with d locked.
+func (d *Decoder) watchEnd(n int) error {
+	w := &d.watch
+	if n > 0 {
+		w.gotAudio = true
+	}
+	w.deadline, w.op = time.Time{}, nil
+	if w.expired != nil {
+		err := w.expired
+		w.expired = nil
+		return err
+	}
+	return nil
+}
+
+// watchClear drops the deadline of an operation that returned early, so it
+// cannot expire during a later call. It is called with d locked.
+func (d *Decoder) watchClear() {
+	d.watch.deadline, d.watch.op, d.watch.expired = time.Time{}, nil, nil
+}
+
+// watchReset restarts the first frame timeout when a stream is opened. It is
+// called with d locked.
+func (d *Decoder) watchReset() {
+	d.watch.opened = time.Now()
+	d.watch.gotAudio = false
+}
+
+// readResult is the outcome of a read left running in the background
+type readResult struct {
+	n   int
+	err error
+}
+
+// deadlineReader reads the decoder input, giving up at the watchdog
+// deadline. Readers with a SetReadDeadline method, like network
+// connections and pipes, are interrupted; others are read in a goroutine
+// that is left running, whose data the next read returns.
+type deadlineReader struct {
+	r       io.Reader
+	d       *Decoder
+	w       *watchdog
+	armed   bool            // a read deadline is set on r
+	pending chan readResult // read left running after a timeout
+	buf     []byte          // its buffer
+	left    []byte          // data of a finished background read not returned yet
+	leftErr error
+}
+
+// watched wraps the input r of d in the watchdog
+func (d *Decoder) watched(r io.Reader) *deadlineReader {
+	return &deadlineReader{r: r, d: d, w: &d.watch}
+}
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if len(r.left) > 0 || r.leftErr != nil {
+		n := copy(p, r.left)
+		r.left = r.left[n:]
+		if len(r.left) > 0 {
+			return n, nil
+		}
+		err := r.leftErr
+		r.left, r.leftErr = nil, nil
+		return n, err
+	}
+	deadline := r.w.deadline
+	if r.pending == nil {
+		if dl, ok := r.r.(readDeadliner); ok && (r.armed || !deadline.IsZero()) {
+			if dl.SetReadDeadline(deadline) == nil {
+				r.armed = !deadline.IsZero()
+				n, err := r.r.Read(p)
+				if errors.Is(err, os.ErrDeadlineExceeded) {
+					r.w.expired = r.w.op
+				}
+				return n, err
+			}
+		}
+		if deadline.IsZero() {
+			return r.r.Read(p)
+		}
+		r.buf = make([]byte, len(p))
+		c := make(chan readResult, 1)
+		src, buf := r.r, r.buf
+		r.d.goLabeled(func() {
+			defer func() {
+				if p := recover(); p != nil {
+					c <- readResult{0, recovered(p)}
+				}
+			}()
+			n, err := src.Read(buf)
+			c <- readResult{n, err}
+		})
+		r.pending = c
+	}
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case res := <-r.pending:
+		r.pending = nil
+		n := copy(p, r.buf[:res.n])
+		if n < res.n {
+			r.left, r.leftErr = r.buf[n:res.n], res.err
+			return n, nil
+		}
+		return n, res.err
+	case <-timeout:
+		r.w.expired = r.w.op
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+// Seek seeks the input if it is an io.Seeker and no read is left running
+func (r *deadlineReader) Seek(offset int64, whence int) (int64, error) {
+	s, ok := r.r.(io.Seeker)
+	if !ok {
+		return 0, errors.New("mpg123 error: input is not seekable")
+	}
+	if r.pending != nil {
+		return 0, errors.New("mpg123 error: input read still running")
+	}
+	r.left, r.leftErr = nil, nil
+	return s.Seek(offset, whence)
+}
@@ -0,0 +1,86 @@
+// total.go contains TotalSamples, the exact length of a stream found by one
+// scan and remembered for the source, so progress bars and duration
+// displays do not pay for it again
+
+package mpg123
+
+import (
+	"io"
+	"os"
+	"reflect"
+)
+
+// sourceKey identifies the input a stream was opened from
+type sourceKey struct {
+	info   os.FileInfo // files, by identity, size and modification time
+	reader io.Reader   // other readers, by pointer identity
+}
+
+// fileKey returns the key of a file opened by name or as an *os.File
+func fileKey(info os.FileInfo, err error) sourceKey {
+	if err != nil {
+		return sourceKey{}
+	}
+	return sourceKey{info: info}
+}
+
+// readerKey returns the key of the reader r
+func readerKey(r io.Reader) sourceKey {
+	if f, ok := r.(*os.File); ok {
+		return fileKey(f.Stat())
+	}
+	if t := reflect.TypeOf(r); t != nil && t.Kind() == reflect.Pointer {
+		return sourceKey{reader: r}
+	}
+	return sourceKey{}
+}
+
+// same reports whether k and o identify the same unchanged source
+func (k sourceKey) same(o sourceKey) bool {
+	switch {
+	case k.info != nil && o.info != nil:
+		return os.SameFile(k.info, o.info) && k.info.Size() == o.info.Size() &&
+			k.info.ModTime().Equal(o.info.ModTime())
+	case k.reader != nil:
+		return k.reader == o.reader
+	}
+	return false
+}
+
+// totalCache is the length found by TotalSamples
+type totalCache struct {
+	source  sourceKey
+	samples int64 // PCM frames at rate
+	rate    int
+}
+
+// TotalSamples returns the exact number of PCM frames of the opened stream
+// at the output rate. The first call scans the stream, which must be
+// seekable; the result is kept and returned at no cost for later calls,
+// across seeks and when the same unchanged file, or the same reader, is
+// opened again.
+func (d *Decoder) TotalSamples() (int64, error) {
+	rate, _, _ := d.GetFormat()
+	if rate <= 0 {
+		return 0, ErrFormatUnknown
+	}
+	d.mu.Lock()
+	source, c := d.source, d.total
+	d.mu.Unlock()
+	if c != nil && c.source.same(source) {
+		return c.samples * int64(rate) / int64(c.rate), nil
+	}
+	if err := d.Scan(); err != nil {
+		return 0, err
+	}
+	samples := d.LengthInPCMFrames()
+	if samples < 0 {
+		return 0, ErrLengthUnknown
+	}
+	if source != (sourceKey{}) {
+		d.mu.Lock()
+		d.total = &totalCache{source: source, samples: samples, rate: rate}
+		d.mu.Unlock()
+	}
+	return samples, nil
+}
@@ -0,0 +1,313 @@
+// transcode.go contains high level helpers converting whole mp3 streams to
+// raw PCM, WAV or AIFF with a chosen output format
+
+package mpg123
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Container selects the file format Transcode writes
+type Container int
+
+const (
+	ContainerRaw  Container = iota // bare PCM samples in host byte order
+	ContainerWAV                   // RIFF WAVE, see WAVWriter
+	ContainerAIFF                  // AIFF, see AIFFWriter
+)
+
+// TranscodeOptions selects the output of Transcode.
+type TranscodeOptions struct {
+	ConvertOptions
+	Container Container
+	Gain      float64 // volume change in dB, 0 keeps the level
+}
+
+// ConvertOptions selects the output format of a conversion. Zero values keep
+// the format of the stream.
+type ConvertOptions struct {
+	Rate     int  // output sample rate, resampled by mpg123 if it differs from the stream
+	Channels int  // 1 mixes down to mono, 2 duplicates mono streams to stereo
+	Encoding int  // output encoding, ENC_SIGNED_16 if 0
+	Gapless  bool // remove encoder delay and padding (needs a LAME/Xing header)
+	SkipTags bool // skip ID3v2 tags without parsing them, see TagSkipID3v2
+
+	// Progress, if set, is called by WriteTo as decoding proceeds, see
+	// SetProgress
+	Progress func(done, total time.Duration)
+}
+
+// Telephony is the output PBX and SIP systems take: 8 kHz mono µ-law. With
+// SetOutput it combines mixing to mono, forcing the rate and µ-law output,
+// which needs a libmpg123 with the NtoM decoder and 8 bit output; Negotiate
+// with FormatULaw works with any build.
+var Telephony = ConvertOptions{Rate: 8000, Channels: 1, Encoding: ENC_ULAW_8}
+
+// progressInterval is the least wall time between two progress calls
+const progressInterval = 100 * time.Millisecond
+
+// SetOutput configures the output format of the decoder according to opts.
+// It must be called before the stream is opened. If the library lacks the
+// requested encoding or resampling, a *FeatureError is returned.
+func (d *Decoder) SetOutput(opts ConvertOptions) error {
+	gapless := REMOVE_FLAGS
+	if opts.Gapless {
+		gapless = ADD_FLAGS
+	}
+	if err := d.Param(gapless, GAPLESS, 0); err != nil {
+		return err
+	}
+	if opts.SkipTags {
+		if err := d.Param(ADD_FLAGS, SKIP_ID3V2, 0); err != nil {
+			return err
+		}
+	}
+
+	channels := MONO | STEREO
+	switch opts.Channels {
+	case 0:
+	case 1:
+		channels = MONO
+		if err := d.Param(ADD_FLAGS, MONO_MIX, 0); err != nil {
+			return err
+		}
+	case 2:
+		channels = STEREO
+		if err := d.Param(ADD_FLAGS, FORCE_STEREO, 0); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("mpg123 error: unsupported channel count %d", opts.Channels)
+	}
+
+	encoding := opts.Encoding
+	if encoding == 0 {
+		encoding = ENC_SIGNED_16
+	}
+	if f, ok := encodingFeature(encoding); ok {
+		if err := d.require(f); err != nil {
+			return err
+		}
+	}
+	rates := SupportedRates()
+	if opts.Rate > 0 {
+		if err := d.require(FEATURE_DECODE_NTOM); err != nil {
+			return err
+		}
+		if err := d.Param(FORCE_RATE, int64(opts.Rate), 0); err != nil {
+			return err
+		}
+		rates = []int{opts.Rate}
+	}
+
+	d.FormatNone()
+	for _, rate := range rates {
+		d.Format(rate, channels, encoding)
+	}
+	d.SetProgress(opts.Progress)
+	return nil
+}
+
+// SetProgress sets a function WriteTo calls about ten times a second with
+// the position reached and the length of the stream, and once more at the
+// end with done equal to total. Before that, total is 0 if the length is
+// unknown, and an estimate for streams without a Xing/Info header. Passing
+// nil disables the calls.
+func (d *Decoder) SetProgress(fn func(done, total time.Duration)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.progress = fn
+}
+
+// reportProgress calls the progress function if one is set and either
+// final is true or progressInterval has passed since the last call
+func (d *Decoder) reportProgress(last *time.Time, final bool) {
+	d.mu.Lock()
+	progress := d.progress
+	d.mu.Unlock()
+	if progress == nil || (!final && time.Since(*last) < progressInterval) {
+		return
+	}
+	*last = time.Now()
+	var total time.Duration
+	if rate, _, _ := d.GetFormat(); rate > 0 {
+		if samples := d.LengthInPCMFrames(); samples > 0 {
+			total = time.Duration(samples) * time.Second / time.Duration(rate)
+		}
+	}
+	done := d.TellTime()
+	if final {
+		// at the end the length is known exactly
+		total = done
+	}
+	progress(done, total)
+}
+
+// WriteTo decodes the rest of the stream and writes the PCM data to w,
+// reporting progress to the function set with SetProgress.
+func (d *Decoder) WriteTo(w io.Writer) (int64, error) {
+	return d.writeTo(context.Background(), w)
+}
+
+// writeTo is WriteTo, stopping with ctx.Err() once ctx is done. It decodes
+// at most OUT_MAX_BUFFER_SIZE bytes between checks.
+func (d *Decoder) writeTo(ctx context.Context, w io.Writer) (int64, error) {
+	buf := make([]byte, OUT_MAX_BUFFER_SIZE)
+	var total int64
+	var reported time.Time
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := d.Read(buf)
+		if n > 0 {
+			written, werr := w.Write(buf[:n])
+			total += int64(written)
+			if werr != nil {
+				return total, werr
+			}
+			d.reportProgress(&reported, false)
+		}
+		if err != nil && ctx.Err() != nil {
+			// a read error or end of stream caused by the cancelled source
+			return total, ctx.Err()
+		}
+		if err == EOF {
+			d.reportProgress(&reported, true)
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// containerWriter is implemented by WAVWriter and AIFFWriter
+type containerWriter interface {
+	io.WriteCloser
+	SetByteOrder(order binary.ByteOrder)
+}
+
+// Transcode decodes the mp3 stream read from src and writes it to dst in the
+// container and format selected by opts. For ContainerAIFF the encoding must
+// be a signed integer one.
+func Transcode(dst io.Writer, src io.Reader, opts TranscodeOptions) error {
+	return TranscodeContext(context.Background(), dst, src, opts)
+}
+
+// TranscodeContext is Transcode for job queues: it works in chunks of at
+// most OUT_MAX_BUFFER_SIZE bytes, reports progress through opts.Progress and
+// stops with ctx.Err() when ctx is cancelled. Cancellation is checked
+// between reads of src; a read blocked in src is only interrupted if src
+// has a SetReadDeadline method, like network connections and pipes, so
+// other sources should be closed on cancellation by the caller.
+// The decoder is freed however it returns; dst then holds a partial file,
+// and WAV or AIFF headers are not finalized.
+func TranscodeContext(ctx context.Context, dst io.Writer, src io.Reader, opts TranscodeOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	d, err := NewDecoder("")
+	if err != nil {
+		return err
+	}
+	defer d.Delete()
+	if err := d.SetOutput(opts.ConvertOptions); err != nil {
+		return err
+	}
+	if opts.Gain != 0 {
+		if err := d.Volume(math.Pow(10, opts.Gain/20)); err != nil {
+			return err
+		}
+	}
+	if dl, ok := src.(readDeadliner); ok {
+		// fail a read waiting for src when the job is cancelled, and clear
+		// the expired deadline again so src stays usable for the caller
+		expired := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			dl.SetReadDeadline(time.Now())
+			close(expired)
+		})
+		defer func() {
+			if !stop() {
+				<-expired
+				dl.SetReadDeadline(time.Time{})
+			}
+		}()
+	}
+	if err := d.OpenReader(&ctxReader{ctx: ctx, r: src}); err != nil {
+		return err
+	}
+	defer d.Close()
+
+	rate, channels, encoding := d.GetFormat()
+	if rate == 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("mpg123 error: %s", d.strerror())
+	}
+	var cw containerWriter
+	switch opts.Container {
+	case ContainerRaw:
+		_, err := d.writeTo(ctx, dst)
+		return err
+	case ContainerWAV:
+		cw, err = NewWAVWriter(dst, rate, channels, encoding)
+	case ContainerAIFF:
+		cw, err = NewAIFFWriter(dst, rate, channels, encoding)
+	default:
+		return fmt.Errorf("mpg123 error: unknown container %d", opts.Container)
+	}
+	if err != nil {
+		return err
+	}
+	cw.SetByteOrder(d.ByteOrder())
+	if _, err := d.writeTo(ctx, cw); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// ctxReader fails reads with ctx.Err() once ctx is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// ConvertToWAV decodes the mp3 stream read from src and writes it to dst as
+// a WAV file in the format selected by opts.
+func ConvertToWAV(dst io.Writer, src io.Reader, opts ConvertOptions) error {
+	return Transcode(dst, src, TranscodeOptions{ConvertOptions: opts, Container: ContainerWAV})
+}
+
+// ConvertFileToWAV converts the mp3 file src to the WAV file dst.
+func ConvertFileToWAV(dst string, src string, opts ConvertOptions) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := ConvertToWAV(out, in, opts); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
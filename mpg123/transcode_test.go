@@ -0,0 +1,46 @@
+package mpg123
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestTranscodeContextBlockedRead cancels a transcode whose source blocks
+// with no data, which a pipe with a read deadline lets it interrupt
+func TestTranscodeContextBlockedRead(t *testing.T) {
+	newTestDecoder(t) // skips without libmpg123
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+	if _, err := pw.Write(silentMP3(4)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- TranscodeContext(ctx, io.Discard, pr, TranscodeOptions{}) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("TranscodeContext kept waiting for the source after cancellation")
+	}
+
+	// the deadline set to interrupt the read must not outlive the call
+	if _, err := pw.Write([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pr.Read(make([]byte, 1)); err != nil {
+		t.Errorf("reading the source after the transcode: %v", err)
+	}
+}
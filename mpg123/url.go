@@ -0,0 +1,193 @@
+// url.go contains decoding of MP3 streams fetched over HTTP, including
+// Icecast/SHOUTcast radio streams with ICY metadata
+
+package mpg123
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URLOptions controls how OpenURL connects to a stream. The zero value is usable.
+type URLOptions struct {
+	// Client is used for requests, http.DefaultClient if nil
+	Client *http.Client
+	// OnMeta is called from the reading goroutine whenever the server sends
+	// new ICY metadata. The latest metadata is also kept for
+	// DecoderReader.ICY.
+	OnMeta func(ICYMeta)
+	// Reconnect is the number of consecutive reconnection attempts made when
+	// the connection drops, 0 disables reconnection. A file of known length
+	// without ICY metadata is resumed where it dropped with a Range request;
+	// a live stream continues at the live point. Either way the same decoder
+	// goes on decoding, keeping its output format. A response of unknown
+	// length without ICY metadata is not reconnected after it ended cleanly,
+	// as a new request would start it over.
+	Reconnect int
+	// ReconnectDelay is the pause between reconnection attempts
+	ReconnectDelay time.Duration
+}
+
+// OpenURL prepares the decoder for feeding and connects to an HTTP stream,
+// returning a DecoderReader producing the decoded audio in the stream's own
+// format (query it with GetFormat once data has been read).
+func (d *Decoder) OpenURL(url string, opts *URLOptions) (*DecoderReader, error) {
+	if opts == nil {
+		opts = &URLOptions{}
+	}
+	src := &urlReader{url: url, opts: opts, log: d.logger(), dec: d}
+	if err := src.connect(); err != nil {
+		return nil, err
+	}
+	if err := d.OpenFeed(); err != nil {
+		src.Close()
+		return nil, err
+	}
+	return &DecoderReader{decoder: d, src: d.watched(src), paranoid: true, owned: src}, nil
+}
+
+// urlReader reads the audio data of an HTTP stream, stripping ICY metadata
+// and reconnecting when the connection drops
+type urlReader struct {
+	url      string
+	opts     *URLOptions
+	body     io.ReadCloser
+	audio    io.Reader
+	failures int
+	log      *slog.Logger
+	dec      *Decoder // receives EventMeta
+	cancel   func()   // ends the request context of the open timeout
+
+	offset int64 // audio bytes read, where a ranged reconnect resumes
+	length int64 // size of a ranged resource
+	ranged bool  // the resource can be resumed with a Range request
+	icy    bool  // the server sends ICY metadata, so the stream is live
+}
+
+func (r *urlReader) connect() (err error) {
+	client := r.opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", r.url, err)
+	}
+	// servers without metadata ignore the request
+	req.Header.Set("Icy-MetaData", "1")
+	resume := r.ranged && r.offset > 0
+	if resume {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	}
+	if limit := r.dec.timeouts().Open; limit > 0 {
+		// the context stays live after the headers arrive, as canceling it
+		// would cut the body off; Close releases it
+		ctx, cancel := context.WithCancel(req.Context())
+		r.cancel = cancel
+		req = req.WithContext(ctx)
+		timer := time.AfterFunc(limit, cancel)
+		defer func() {
+			if !timer.Stop() {
+				if err == nil {
+					// the headers came in just as the timer fired
+					r.body.Close()
+				}
+				err = &TimeoutError{Op: "open", After: limit}
+			}
+		}()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", r.url, err)
+	}
+	switch {
+	case resume && resp.StatusCode == http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", r.offset)) {
+			resp.Body.Close()
+			return fmt.Errorf("error opening %s: unexpected range %q", r.url, resp.Header.Get("Content-Range"))
+		}
+	case resp.StatusCode != http.StatusOK:
+		resp.Body.Close()
+		return fmt.Errorf("error opening %s: %s", r.url, resp.Status)
+	case resume:
+		// the server ignored the range; skip what was decoded already
+		if _, err := io.CopyN(io.Discard, resp.Body, r.offset); err != nil {
+			resp.Body.Close()
+			return fmt.Errorf("error opening %s: %w", r.url, err)
+		}
+	}
+	r.body = resp.Body
+	r.audio = resp.Body
+	r.icy = false
+	if interval, err := strconv.Atoi(resp.Header.Get("Icy-Metaint")); err == nil && interval > 0 {
+		r.audio = newICYReader(resp.Body, interval, r.onMeta)
+		r.icy = true
+	} else if !resume && resp.ContentLength > 0 {
+		r.ranged, r.length = true, resp.ContentLength
+	}
+	if resume {
+		r.log.Info("stream resumed", "url", r.url, "offset", r.offset)
+	}
+	return nil
+}
+
+func (r *urlReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.audio.Read(p)
+		r.offset += int64(n)
+		if err == nil || n > 0 {
+			r.failures = 0
+			return n, nil
+		}
+		if err == io.EOF && r.complete() {
+			return 0, io.EOF
+		}
+		if r.failures >= r.opts.Reconnect {
+			return 0, err
+		}
+		r.failures++
+		r.log.Warn("stream dropped", "url", r.url, "err", err)
+		r.Close()
+		time.Sleep(r.opts.ReconnectDelay)
+		if cerr := r.connect(); cerr != nil {
+			// keep the closed body; the next Read fails and retries again
+			r.log.Error("reconnect failed", "url", r.url, "err", cerr)
+		}
+	}
+}
+
+// complete reports whether a clean EOF is the end of the stream rather than
+// a dropped connection: a ranged resource read to its length, or a response
+// of unknown length that is not a live ICY stream
+func (r *urlReader) complete() bool {
+	if r.ranged {
+		return r.offset >= r.length
+	}
+	return !r.icy
+}
+
+// onMeta logs new ICY metadata and passes it on to the EventMeta subscribers
+// and the OnMeta callback
+func (r *urlReader) onMeta(m ICYMeta) {
+	r.log.Info("metadata updated", "title", m.StreamTitle, "url", m.StreamURL)
+	r.dec.mu.Lock()
+	r.dec.icy = &m
+	r.dec.mu.Unlock()
+	r.dec.emit(Event{Kind: EventMeta, ICY: &m})
+	if r.opts.OnMeta != nil {
+		r.opts.OnMeta(m)
+	}
+}
+
+func (r *urlReader) Close() error {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	return r.body.Close()
+}
@@ -0,0 +1,40 @@
+package mpg123
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// TestOpenURLUnknownLengthEnds checks that a response without Content-Length
+// or ICY metadata ends at its EOF instead of being requested again
+func TestOpenURLUnknownLengthEnds(t *testing.T) {
+	const frames = 20
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// flushing before the end sends the body chunked, without a length
+		w.(http.Flusher).Flush()
+		w.Write(silentMP3(frames))
+	}))
+	defer srv.Close()
+
+	d := newTestDecoder(t)
+	r, err := d.OpenURL(srv.URL, &URLOptions{Reconnect: 3})
+	if err != nil {
+		t.Fatalf("OpenURL: %v", err)
+	}
+	defer r.Nuke()
+	pcm, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+	if want := frames * 1152 * 4; len(pcm) != want {
+		t.Errorf("got %d bytes of audio, want %d", len(pcm), want)
+	}
+}
@@ -0,0 +1,19 @@
+// version.go reports which libmpg123 API the package was built against
+
+package mpg123
+
+// #include "compat.h"
+import "C"
+
+// APIVersion is MPG123_API_VERSION of the mpg123.h the package was compiled
+// with. Bindings for functions newer than this fall back as described in
+// compat.h.
+const APIVersion = C.MPG123_API_VERSION
+
+// HaveForceEndian reports whether the library supports FORCE_ENDIAN and
+// BIG_ENDIAN (API version 46 and later)
+const HaveForceEndian = C.HAVE_FORCE_ENDIAN != 0
+
+// HaveRawID3 reports whether the library can keep the raw tags for RawID3
+// (API version 45 and later)
+const HaveRawID3 = C.HAVE_ID3_RAW != 0
@@ -0,0 +1,134 @@
+// wav.go contains a writer for RIFF WAVE files holding decoded audio
+
+package mpg123
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	wavFormatPCM   = 1
+	wavFormatALAW  = 6
+	wavFormatULAW  = 7
+	wavFormatFloat = 3
+	wavHeaderSize  = 44
+)
+
+// WAVWriter writes PCM audio as a WAV file. Samples are expected in the
+// byte order produced by the decoder and are stored little endian.
+type WAVWriter struct {
+	w          io.Writer
+	rate       int
+	channels   int
+	encoding   int
+	sampleSize int
+	written    int64
+	swap       bool
+}
+
+// NewWAVWriter writes a WAV header for the given format to w and returns a
+// writer for the audio data. If w is an io.WriteSeeker the header is updated
+// with the final sizes on Close; otherwise the sizes are left at their maximum,
+// which players treat as a stream of unknown length.
+func NewWAVWriter(w io.Writer, rate int, channels int, encoding int) (*WAVWriter, error) {
+	size := GetEncodingBitsPerSample(encoding) / 8
+	if _, err := wavFormatTag(encoding); err != nil {
+		return nil, err
+	}
+	ww := &WAVWriter{
+		w:          w,
+		rate:       rate,
+		channels:   channels,
+		encoding:   encoding,
+		sampleSize: size,
+		swap:       nativeEndian != binary.LittleEndian && size > 1,
+	}
+	if err := ww.writeHeader(0xffffffff - wavHeaderSize + 8); err != nil {
+		return nil, err
+	}
+	return ww, nil
+}
+
+func wavFormatTag(encoding int) (uint16, error) {
+	switch encoding {
+	case ENC_UNSIGNED_8, ENC_SIGNED_16, ENC_SIGNED_24, ENC_SIGNED_32:
+		return wavFormatPCM, nil
+	case ENC_FLOAT_32, ENC_FLOAT_64:
+		return wavFormatFloat, nil
+	case ENC_ULAW_8:
+		return wavFormatULAW, nil
+	case ENC_ALAW_8:
+		return wavFormatALAW, nil
+	}
+	return 0, fmt.Errorf("mpg123 error: encoding %v cannot be stored in WAV", Encoding(encoding))
+}
+
+func (ww *WAVWriter) writeHeader(dataSize uint32) error {
+	tag, _ := wavFormatTag(ww.encoding)
+	var h [wavHeaderSize]byte
+	le := binary.LittleEndian
+	copy(h[0:], "RIFF")
+	le.PutUint32(h[4:], dataSize+wavHeaderSize-8)
+	copy(h[8:], "WAVEfmt ")
+	le.PutUint32(h[16:], 16)
+	le.PutUint16(h[20:], tag)
+	le.PutUint16(h[22:], uint16(ww.channels))
+	le.PutUint32(h[24:], uint32(ww.rate))
+	le.PutUint32(h[28:], uint32(ww.rate*ww.channels*ww.sampleSize))
+	le.PutUint16(h[32:], uint16(ww.channels*ww.sampleSize))
+	le.PutUint16(h[34:], uint16(ww.sampleSize*8))
+	copy(h[36:], "data")
+	le.PutUint32(h[40:], dataSize)
+	_, err := ww.w.Write(h[:])
+	return err
+}
+
+// Write appends audio data to the file.
+func (ww *WAVWriter) Write(p []byte) (int, error) {
+	data := p
+	if ww.swap {
+		data = make([]byte, len(p))
+		copy(data, p)
+		swapSamples(data, ww.sampleSize)
+	}
+	n, err := ww.w.Write(data)
+	ww.written += int64(n)
+	return n, err
+}
+
+// Close fixes up the header sizes if the underlying writer is seekable.
+// It does not close the underlying writer.
+func (ww *WAVWriter) Close() error {
+	ws, ok := ww.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	if _, err := ws.Seek(0, io.SeekStart); err != nil {
+		// not actually seekable (e.g. a pipe), leave the streaming header
+		return nil
+	}
+	if err := ww.writeHeader(uint32(ww.written)); err != nil {
+		return err
+	}
+	_, err := ws.Seek(0, io.SeekEnd)
+	return err
+}
+
+// SetByteOrder sets the byte order of the samples passed to Write, which
+// defaults to the host byte order (see Decoder.ByteOrder). Samples are
+// converted to the little endian order of WAV files as needed.
+func (ww *WAVWriter) SetByteOrder(order binary.ByteOrder) {
+	ww.swap = order != binary.LittleEndian && ww.sampleSize > 1
+}
+
+// swapSamples reverses the byte order of every sample in buf
+func swapSamples(buf []byte, size int) {
+	for i := 0; i+size <= len(buf); i += size {
+		s := buf[i : i+size]
+		for a, b := 0, size-1; a < b; a, b = a+1, b-1 {
+			s[a], s[b] = s[b], s[a]
+		}
+	}
+}
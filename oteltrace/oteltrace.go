@@ -0,0 +1,122 @@
+// oteltrace.go contains an OpenTelemetry tracing wrapper for mpg123
+// decoders. Like prommetrics it is a separate package, so only programs
+// using it depend on OpenTelemetry.
+
+// Package oteltrace wraps an mpg123.Decoder so that opening, scanning,
+// seeking and decoding record OpenTelemetry spans:
+//
+//	td := oteltrace.Wrap(decoder, nil)
+//	if err := td.Open(ctx, "in.mp3"); err != nil {
+//		return err
+//	}
+//	io.Copy(w, td.Reader(ctx))
+//
+// Decode spans carry the number of bytes decoded in the mpg123.bytes
+// attribute. Errors are recorded on the span and mark it as failed; EOF is
+// not an error.
+package oteltrace
+
+import (
+	"context"
+	"io"
+
+	"github.com/SiloCityLabs/go-mpg123/mpg123"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/SiloCityLabs/go-mpg123/oteltrace"
+
+// Decoder is an mpg123.Decoder whose Open, Scan, Seek, Read and Decode
+// calls take a context and record a span each. The other methods of the
+// wrapped decoder are available unchanged.
+type Decoder struct {
+	*mpg123.Decoder
+	tracer trace.Tracer
+}
+
+// Wrap returns a traced view of d. With a nil provider the global one from
+// otel.GetTracerProvider is used.
+func Wrap(d *mpg123.Decoder, tp trace.TracerProvider) *Decoder {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Decoder{Decoder: d, tracer: tp.Tracer(instrumentationName)}
+}
+
+// Open opens the named mp3 file
+func (d *Decoder) Open(ctx context.Context, file string) error {
+	_, span := d.tracer.Start(ctx, "mpg123.Open",
+		trace.WithAttributes(attribute.String("mpg123.file", file)))
+	defer span.End()
+	return record(span, d.Decoder.Open(file))
+}
+
+// OpenReader opens r for decoding
+func (d *Decoder) OpenReader(ctx context.Context, r io.Reader) error {
+	_, span := d.tracer.Start(ctx, "mpg123.OpenReader")
+	defer span.End()
+	return record(span, d.Decoder.OpenReader(r))
+}
+
+// Scan scans the whole input for exact length information
+func (d *Decoder) Scan(ctx context.Context) error {
+	_, span := d.tracer.Start(ctx, "mpg123.Scan")
+	defer span.End()
+	return record(span, d.Decoder.Scan())
+}
+
+// Seek moves to the given sample offset
+func (d *Decoder) Seek(ctx context.Context, offset int64, whence int) (int64, error) {
+	_, span := d.tracer.Start(ctx, "mpg123.Seek",
+		trace.WithAttributes(attribute.Int64("mpg123.offset", offset), attribute.Int("mpg123.whence", whence)))
+	defer span.End()
+	pos, err := d.Decoder.Seek(offset, whence)
+	span.SetAttributes(attribute.Int64("mpg123.position", pos))
+	return pos, record(span, err)
+}
+
+// Read decodes one chunk of audio into buf
+func (d *Decoder) Read(ctx context.Context, buf []byte) (int, error) {
+	_, span := d.tracer.Start(ctx, "mpg123.Read")
+	defer span.End()
+	n, err := d.Decoder.Read(buf)
+	span.SetAttributes(attribute.Int("mpg123.bytes", n))
+	return n, record(span, err)
+}
+
+// Decode feeds buf to the decoder and returns the audio decoded from it
+func (d *Decoder) Decode(ctx context.Context, buf []byte) ([]byte, error) {
+	_, span := d.tracer.Start(ctx, "mpg123.Decode",
+		trace.WithAttributes(attribute.Int("mpg123.input_bytes", len(buf))))
+	defer span.End()
+	out, err := d.Decoder.Decode(buf)
+	span.SetAttributes(attribute.Int("mpg123.bytes", len(out)))
+	return out, record(span, err)
+}
+
+// Reader returns an io.Reader whose reads are traced under ctx, for use
+// with io.Copy and friends.
+func (d *Decoder) Reader(ctx context.Context) io.Reader {
+	return reader{d, ctx}
+}
+
+type reader struct {
+	d   *Decoder
+	ctx context.Context
+}
+
+func (r reader) Read(buf []byte) (int, error) {
+	return r.d.Read(r.ctx, buf)
+}
+
+// record marks span as failed if err is a real error and returns err
+func record(span trace.Span, err error) error {
+	if err != nil && err != mpg123.EOF && err != io.EOF {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
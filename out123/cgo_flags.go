@@ -0,0 +1,17 @@
+//go:build nopkgconfig
+
+// cgo_flags.go contains fallback search paths for libout123 on systems
+// without pkg-config. On macOS both Homebrew prefixes (/opt/homebrew on
+// Apple silicon, /usr/local on Intel) and MacPorts are searched.
+// CGO_CFLAGS and CGO_LDFLAGS can add further paths.
+
+package out123
+
+// #cgo LDFLAGS: -lout123
+// #cgo darwin CFLAGS: -I/opt/homebrew/include -I/usr/local/include -I/opt/local/include
+// #cgo darwin LDFLAGS: -L/opt/homebrew/lib -L/usr/local/lib -L/opt/local/lib
+// #cgo freebsd openbsd netbsd CFLAGS: -I/usr/local/include
+// #cgo freebsd openbsd netbsd LDFLAGS: -L/usr/local/lib
+// #cgo windows CFLAGS: -I/ucrt64/include -I/mingw64/include
+// #cgo windows LDFLAGS: -L/ucrt64/lib -L/mingw64/lib
+import "C"
@@ -0,0 +1,9 @@
+//go:build !nopkgconfig
+
+// cgo_pkgconfig.go locates libout123 through pkg-config. Build with the
+// nopkgconfig tag to use the fixed paths in cgo_flags.go instead.
+
+package out123
+
+// #cgo pkg-config: libout123
+import "C"
@@ -0,0 +1,21 @@
+// compat.h detects what the installed out123.h provides and stubs out
+// anything missing, so the package builds against older libout123 releases.
+// The HAVE_* macros are visible to Go as C.HAVE_*.
+
+#ifndef GO_OUT123_COMPAT_H
+#define GO_OUT123_COMPAT_H
+
+#include <stdlib.h>
+#include <out123.h>
+
+// device enumeration arrived in out123 API version 4 (mpg123 1.27)
+#if OUT123_API_VERSION >= 4
+#define HAVE_DEVICES 1
+#else
+#define HAVE_DEVICES 0
+static int out123_devices(out123_handle *ao, const char *driver, char ***names, char ***descr, char **active_driver) {
+	return -1;
+}
+#endif
+
+#endif
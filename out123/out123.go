@@ -0,0 +1,371 @@
+// out123.go contains bindings to libout123, the audio output library shipped
+// with mpg123
+
+package out123
+
+/*
+#include "compat.h"
+
+// free_list frees a string list returned by out123_drivers or out123_devices
+static void free_list(char **list, int count) {
+	if (list == NULL) {
+		return;
+	}
+	for (int i = 0; i < count; i++) {
+		free(list[i]);
+	}
+	free(list);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Parameters for Param and GetParam
+const (
+	FLAGS        = C.OUT123_FLAGS
+	PRELOAD      = C.OUT123_PRELOAD
+	GAIN         = C.OUT123_GAIN
+	VERBOSE      = C.OUT123_VERBOSE
+	DEVICEBUFFER = C.OUT123_DEVICEBUFFER
+	PROPFLAGS    = C.OUT123_PROPFLAGS
+	NAME         = C.OUT123_NAME
+	BINDIR       = C.OUT123_BINDIR
+)
+
+// Flags for the FLAGS parameter
+const (
+	HEADPHONES       = C.OUT123_HEADPHONES
+	INTERNAL_SPEAKER = C.OUT123_INTERNAL_SPEAKER
+	LINE_OUT         = C.OUT123_LINE_OUT
+	QUIET            = C.OUT123_QUIET
+	KEEP_PLAYING     = C.OUT123_KEEP_PLAYING
+)
+
+// Output is an instance of an out123 audio output
+type Output struct {
+	handle   *C.out123_handle
+	volume   atomic.Uint64 // float64 bits of the software volume
+	encoding int           // encoding passed to Start
+	scaled   []byte        // scratch buffer for Write at reduced volume
+}
+
+// New creates a new audio output. Call Open to select a driver and device.
+func New() (*Output, error) {
+	ao := C.out123_new()
+	if ao == nil {
+		return nil, fmt.Errorf("error initializing out123")
+	}
+	o := &Output{handle: ao}
+	o.volume.Store(math.Float64bits(1))
+	return o, nil
+}
+
+// Delete closes the output and frees the instance. Calling it again does
+// nothing.
+func (o *Output) Delete() {
+	if o.handle == nil {
+		return
+	}
+	C.out123_del(o.handle)
+	o.handle = nil
+}
+
+// returns the most recent error message of the output
+func (o *Output) strerror() string {
+	return C.GoString(C.out123_strerror(o.handle))
+}
+
+// cstring converts s to a C string, or NULL for an empty string
+func cstring(s string) *C.char {
+	if s == "" {
+		return nil
+	}
+	return C.CString(s)
+}
+
+// Open opens an output driver and device. Empty strings select the defaults;
+// driver may also be a comma separated list of drivers to try in order.
+func (o *Output) Open(driver string, device string) error {
+	cdriver, cdevice := cstring(driver), cstring(device)
+	defer C.free(unsafe.Pointer(cdriver))
+	defer C.free(unsafe.Pointer(cdevice))
+	if err := C.out123_open(o.handle, cdriver, cdevice); err != C.OUT123_OK {
+		return fmt.Errorf("out123 error: %s", o.strerror())
+	}
+	return nil
+}
+
+// Param sets a parameter of the output, see the constants above. Most
+// parameters only take effect when set before Open.
+func (o *Output) Param(code int, value int64, fvalue float64, svalue string) error {
+	csvalue := cstring(svalue)
+	defer C.free(unsafe.Pointer(csvalue))
+	if err := C.out123_param(o.handle, uint32(code), C.long(value), C.double(fvalue), csvalue); err != C.OUT123_OK {
+		return fmt.Errorf("out123 error: %s", o.strerror())
+	}
+	return nil
+}
+
+// GetParam returns the current value of a parameter of the output
+func (o *Output) GetParam(code int) (value int64, fvalue float64, svalue string, err error) {
+	var cvalue C.long
+	var cfvalue C.double
+	var csvalue *C.char
+	if e := C.out123_getparam(o.handle, uint32(code), &cvalue, &cfvalue, &csvalue); e != C.OUT123_OK {
+		return 0, 0, "", fmt.Errorf("out123 error: %s", o.strerror())
+	}
+	// the string stays owned by the handle
+	return int64(cvalue), float64(cfvalue), C.GoString(csvalue), nil
+}
+
+// SetName sets the client name the output reports to the sound server. The
+// pulse driver (also used with PipeWire through pipewire-pulse) and jack
+// label the stream with it. It must be called before Open.
+func (o *Output) SetName(name string) error {
+	return o.Param(NAME, 0, 0, name)
+}
+
+// SetGain sets the device gain. Its meaning depends on the driver and most
+// drivers ignore it; use SetVolume for a volume that works everywhere.
+func (o *Output) SetGain(gain int) error {
+	return o.Param(GAIN, int64(gain), 0, "")
+}
+
+// Driver describes an output driver module
+type Driver struct {
+	Name        string // e.g. alsa, pulse, jack, coreaudio, win32
+	Description string
+}
+
+// Device describes a device of an output driver
+type Device struct {
+	Name        string // e.g. hw:1,0 for ALSA
+	Description string
+}
+
+// Drivers lists the output drivers available to libout123
+func (o *Output) Drivers() ([]Driver, error) {
+	var names, descr **C.char
+	n := int(C.out123_drivers(o.handle, &names, &descr))
+	if n < 0 {
+		return nil, fmt.Errorf("out123 error: %s", o.strerror())
+	}
+	defer C.free_list(names, C.int(n))
+	defer C.free_list(descr, C.int(n))
+	drivers := make([]Driver, n)
+	for i := range drivers {
+		drivers[i].Name, drivers[i].Description = listEntry(names, descr, i)
+	}
+	return drivers, nil
+}
+
+// Devices lists the devices of driver, or of the default driver if driver is
+// empty, and returns the name of the driver that was asked. Not every driver
+// can enumerate its devices.
+func (o *Output) Devices(driver string) (devices []Device, active string, err error) {
+	if !HaveDevices {
+		return nil, "", errors.New("out123 error: device enumeration needs a newer libout123")
+	}
+	cdriver := cstring(driver)
+	defer C.free(unsafe.Pointer(cdriver))
+	var names, descr **C.char
+	var cactive *C.char
+	n := int(C.out123_devices(o.handle, cdriver, &names, &descr, &cactive))
+	if n < 0 {
+		return nil, "", fmt.Errorf("out123 error: %s", o.strerror())
+	}
+	defer C.free_list(names, C.int(n))
+	defer C.free_list(descr, C.int(n))
+	if cactive != nil {
+		active = C.GoString(cactive)
+		C.free(unsafe.Pointer(cactive))
+	}
+	devices = make([]Device, n)
+	for i := range devices {
+		devices[i].Name, devices[i].Description = listEntry(names, descr, i)
+	}
+	return devices, active, nil
+}
+
+func listEntry(names **C.char, descr **C.char, i int) (string, string) {
+	var name, desc string
+	if names != nil {
+		name = C.GoString(unsafe.Slice(names, i+1)[i])
+	}
+	if descr != nil {
+		desc = C.GoString(unsafe.Slice(descr, i+1)[i])
+	}
+	return name, desc
+}
+
+// SplitDevice splits an output specification such as "alsa:hw:1,0" into the
+// driver and device names for Open. A spec without a colon names a driver.
+func SplitDevice(spec string) (driver string, device string) {
+	driver, device, _ = strings.Cut(spec, ":")
+	return driver, device
+}
+
+// Special port lists for OpenJACK
+const (
+	JACKAutoConnect = "auto" // connect to the physical playback ports
+	JACKNoConnect   = "none" // leave the ports unconnected for manual routing
+)
+
+// OpenJACK opens the jack driver as a client called name (the prefix of its
+// output ports in the session graph) and connects the outputs, one per
+// channel, to the given ports such as "system:playback_1". Without ports the
+// outputs go to the physical playback ports, see also JACKNoConnect.
+func (o *Output) OpenJACK(name string, ports ...string) error {
+	if name != "" {
+		if err := o.SetName(name); err != nil {
+			return err
+		}
+	}
+	device := JACKAutoConnect
+	if len(ports) > 0 {
+		device = strings.Join(ports, ",")
+	}
+	return o.Open("jack", device)
+}
+
+// Close closes the driver opened with Open
+func (o *Output) Close() {
+	C.out123_close(o.handle)
+}
+
+// DriverInfo returns the names of the driver and device in use
+func (o *Output) DriverInfo() (driver string, device string, err error) {
+	var cdriver, cdevice *C.char
+	if e := C.out123_driver_info(o.handle, &cdriver, &cdevice); e != C.OUT123_OK {
+		return "", "", fmt.Errorf("out123 error: %s", o.strerror())
+	}
+	return C.GoString(cdriver), C.GoString(cdevice), nil
+}
+
+// Encodings returns the encodings the open device supports at the given rate
+// and channel count, as a bit set of the mpg123 ENC_* values.
+func (o *Output) Encodings(rate int, channels int) (int, error) {
+	enc := int(C.out123_encodings(o.handle, C.long(rate), C.int(channels)))
+	if enc < 0 {
+		return 0, fmt.Errorf("out123 error: %s", o.strerror())
+	}
+	return enc, nil
+}
+
+// Format is a combination of rate and channel count with the encodings a
+// device supports for it
+type Format struct {
+	Rate      int
+	Channels  int
+	Encodings int // bit set of mpg123 ENC_* values
+}
+
+// Formats queries the open device for the given rates and channel counts.
+// The first entry is the device's default format, with -1 in fields the
+// driver does not know; the others follow in the order of rates.
+func (o *Output) Formats(rates []int, minChannels int, maxChannels int) ([]Format, error) {
+	crates := make([]C.long, len(rates))
+	for i, r := range rates {
+		crates[i] = C.long(r)
+	}
+	var ptr *C.long
+	if len(crates) > 0 {
+		ptr = &crates[0]
+	}
+	var list *C.struct_mpg123_fmt
+	n := int(C.out123_formats(o.handle, ptr, C.int(len(crates)), C.int(minChannels), C.int(maxChannels), &list))
+	if n < 0 {
+		return nil, fmt.Errorf("out123 error: %s", o.strerror())
+	}
+	defer C.free(unsafe.Pointer(list))
+	formats := make([]Format, n)
+	for i, f := range unsafe.Slice(list, n) {
+		formats[i] = Format{Rate: int(f.rate), Channels: int(f.channels), Encodings: int(f.encoding)}
+	}
+	return formats, nil
+}
+
+// commonRates are tried in order by NegotiateRate when neither the stream
+// rate nor the device default can be used
+var commonRates = []int{48000, 44100, 96000, 88200, 32000}
+
+// NegotiateRate returns the rate to start the open device with for audio of
+// the given rate, channels and encoding: rate itself if the device accepts
+// it, else the device's default rate, else the first common rate it
+// supports. Devices such as CoreAudio outputs often run at a fixed rate, in
+// which case the decoder has to resample (see mpg123 ConvertOptions.Rate).
+func (o *Output) NegotiateRate(rate int, channels int, encoding int) (int, error) {
+	if enc, err := o.Encodings(rate, channels); err == nil && enc&encoding == encoding {
+		return rate, nil
+	}
+	candidates := append([]int{}, commonRates...)
+	if formats, err := o.Formats(nil, channels, channels); err == nil && len(formats) > 0 && formats[0].Rate > 0 {
+		candidates = append([]int{formats[0].Rate}, candidates...)
+	}
+	for _, r := range candidates {
+		if enc, err := o.Encodings(r, channels); err == nil && enc&encoding == encoding {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("out123 error: device supports no rate for %d channels with encoding 0x%x", channels, encoding)
+}
+
+// Start begins playback with the given format. The encoding uses the same
+// values as the decoder, e.g. mpg123.ENC_SIGNED_16.
+func (o *Output) Start(rate int, channels int, encoding int) error {
+	if err := C.out123_start(o.handle, C.long(rate), C.int(channels), C.int(encoding)); err != C.OUT123_OK {
+		return fmt.Errorf("out123 error: %s", o.strerror())
+	}
+	o.encoding = encoding
+	return nil
+}
+
+// Write plays buf at the volume set with SetVolume, blocking until all of it
+// has been handed to the device.
+func (o *Output) Write(buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	if volume := o.Volume(); volume != 1 {
+		o.scaled = scale(o.scaled, buf, o.encoding, volume)
+		buf = o.scaled
+	}
+	n := int(C.out123_play(o.handle, unsafe.Pointer(&buf[0]), C.size_t(len(buf))))
+	if n < len(buf) {
+		return n, fmt.Errorf("out123 error: %s", o.strerror())
+	}
+	return n, nil
+}
+
+// Pause pauses playback, keeping the device open
+func (o *Output) Pause() {
+	C.out123_pause(o.handle)
+}
+
+// Continue resumes playback after Pause
+func (o *Output) Continue() {
+	C.out123_continue(o.handle)
+}
+
+// Stop stops playback, finishing what is buffered
+func (o *Output) Stop() {
+	C.out123_stop(o.handle)
+}
+
+// Drop discards buffered audio, e.g. after seeking
+func (o *Output) Drop() {
+	C.out123_drop(o.handle)
+}
+
+// Drain waits until all buffered audio has been played
+func (o *Output) Drain() {
+	C.out123_drain(o.handle)
+}
@@ -0,0 +1,14 @@
+// version.go reports which libout123 API the package was built against
+
+package out123
+
+// #include "compat.h"
+import "C"
+
+// APIVersion is OUT123_API_VERSION of the out123.h the package was compiled
+// with
+const APIVersion = C.OUT123_API_VERSION
+
+// HaveDevices reports whether Output.Devices can enumerate devices (API
+// version 4 and later)
+const HaveDevices = C.HAVE_DEVICES != 0
@@ -0,0 +1,124 @@
+// volume.go contains the software volume of an Output, applied to the audio
+// in Write because the device gain set with SetGain is ignored by most
+// drivers
+
+package out123
+
+// #include "compat.h"
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// nativeLittleEndian reports the byte order of the samples given to Write
+var nativeLittleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// SetVolume sets the software volume of the output, a linear factor applied
+// to the samples in Write: 0 mutes, 1 (the default) plays the audio
+// unchanged and larger values amplify it, clipping integer samples at full
+// scale. Unlike SetGain it works with every driver, and it can be changed
+// during playback from another goroutine. Audio in µ-law or A-law is played
+// unchanged.
+func (o *Output) SetVolume(volume float64) error {
+	if volume < 0 || math.IsNaN(volume) || math.IsInf(volume, 0) {
+		return fmt.Errorf("out123 error: invalid volume %v", volume)
+	}
+	o.volume.Store(math.Float64bits(volume))
+	return nil
+}
+
+// Volume returns the software volume set with SetVolume
+func (o *Output) Volume() float64 {
+	return math.Float64frombits(o.volume.Load())
+}
+
+// scale returns buf with its samples, in the given encoding, multiplied by
+// volume. buf itself is left alone; the result is written to dst, which is
+// grown as needed and returned.
+func scale(dst []byte, buf []byte, encoding int, volume float64) []byte {
+	if cap(dst) < len(buf) {
+		dst = make([]byte, len(buf))
+	}
+	dst = dst[:len(buf)]
+	copy(dst, buf)
+	switch encoding {
+	case C.MPG123_ENC_SIGNED_8:
+		scaleInt(dst, 1, true, volume)
+	case C.MPG123_ENC_UNSIGNED_8:
+		scaleInt(dst, 1, false, volume)
+	case C.MPG123_ENC_SIGNED_16:
+		scaleInt(dst, 2, true, volume)
+	case C.MPG123_ENC_UNSIGNED_16:
+		scaleInt(dst, 2, false, volume)
+	case C.MPG123_ENC_SIGNED_24:
+		scaleInt(dst, 3, true, volume)
+	case C.MPG123_ENC_UNSIGNED_24:
+		scaleInt(dst, 3, false, volume)
+	case C.MPG123_ENC_SIGNED_32:
+		scaleInt(dst, 4, true, volume)
+	case C.MPG123_ENC_UNSIGNED_32:
+		scaleInt(dst, 4, false, volume)
+	case C.MPG123_ENC_FLOAT_32:
+		for i := 0; i+4 <= len(dst); i += 4 {
+			f := math.Float32frombits(binary.NativeEndian.Uint32(dst[i:]))
+			binary.NativeEndian.PutUint32(dst[i:], math.Float32bits(float32(float64(f)*volume)))
+		}
+	case C.MPG123_ENC_FLOAT_64:
+		for i := 0; i+8 <= len(dst); i += 8 {
+			f := math.Float64frombits(binary.NativeEndian.Uint64(dst[i:]))
+			binary.NativeEndian.PutUint64(dst[i:], math.Float64bits(f*volume))
+		}
+	}
+	return dst
+}
+
+// scaleInt multiplies the native endian integer samples of the given width
+// in buf by volume, clipping at full scale. Unsigned samples are centred on
+// half their range.
+func scaleInt(buf []byte, width int, signed bool, volume float64) {
+	bits := uint(8 * width)
+	max := int64(1)<<(bits-1) - 1
+	min := -max - 1
+	var offset int64
+	if !signed {
+		offset = max + 1
+	}
+	for i := 0; i+width <= len(buf); i += width {
+		sample := buf[i : i+width]
+		var u uint64
+		for k, b := range sample {
+			u |= uint64(b) << byteShift(k, width)
+		}
+		var s int64
+		if signed {
+			s = int64(u<<(64-bits)) >> (64 - bits)
+		} else {
+			s = int64(u) - offset
+		}
+		v := math.Round(float64(s) * volume)
+		switch {
+		case v > float64(max):
+			s = max
+		case v < float64(min):
+			s = min
+		default:
+			s = int64(v)
+		}
+		u = uint64(s + offset)
+		for k := range sample {
+			sample[k] = byte(u >> byteShift(k, width))
+		}
+	}
+}
+
+// byteShift returns the bit position of the k-th byte of a native endian
+// integer of the given width
+func byteShift(k int, width int) uint {
+	if nativeLittleEndian {
+		return uint(8 * k)
+	}
+	return uint(8 * (width - 1 - k))
+}
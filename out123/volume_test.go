@@ -0,0 +1,70 @@
+package out123
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestScaleInt(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		width  int
+		signed bool
+		volume float64
+		in     []int64
+		want   []int64
+	}{
+		{"s16 half", 2, true, 0.5, []int64{1000, -1000, 32767, -32768, 1}, []int64{500, -500, 16384, -16384, 1}},
+		{"s16 mute", 2, true, 0, []int64{1000, -32768}, []int64{0, 0}},
+		{"s16 clip", 2, true, 2, []int64{20000, -20000, 100}, []int64{32767, -32768, 200}},
+		{"u8 half", 1, false, 0.5, []int64{128, 255, 0, 138}, []int64{128, 192, 64, 133}},
+		{"s24 half", 3, true, 0.5, []int64{-8388608, 8388607, 3}, []int64{-4194304, 4194304, 2}},
+		{"u32 clip", 4, false, 4, []int64{1 << 31, 1<<31 + 1<<30, 0}, []int64{1 << 31, 1<<32 - 1, 0}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := make([]byte, tc.width*len(tc.in))
+			for i, s := range tc.in {
+				putSample(buf[i*tc.width:], tc.width, s)
+			}
+			scaleInt(buf, tc.width, tc.signed, tc.volume)
+			for i, want := range tc.want {
+				if got := getSample(buf[i*tc.width:], tc.width, tc.signed); got != want {
+					t.Errorf("sample %d: got %d, want %d", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestScaleKeepsInput(t *testing.T) {
+	in := []byte{0x10, 0x20, 0x30, 0x40}
+	out := scale(nil, in, 0, 0.5)
+	if &out[0] == &in[0] {
+		t.Fatal("scale wrote to its input")
+	}
+	if string(out) != string(in) {
+		t.Errorf("unknown encoding changed the audio: % x", out)
+	}
+}
+
+// putSample stores the low width bytes of s in native byte order
+func putSample(b []byte, width int, s int64) {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], uint64(s))
+	for k := 0; k < width; k++ {
+		b[k] = tmp[byteShift(k, width)/8]
+	}
+}
+
+// getSample reads a native endian sample of the given width
+func getSample(b []byte, width int, signed bool) int64 {
+	var u uint64
+	for k := 0; k < width; k++ {
+		u |= uint64(b[k]) << byteShift(k, width)
+	}
+	bits := uint(8 * width)
+	if signed {
+		return int64(u<<(64-bits)) >> (64 - bits)
+	}
+	return int64(u)
+}
@@ -0,0 +1,148 @@
+// prommetrics.go contains a Prometheus adapter for the mpg123 package. It is
+// a separate package so that only programs using it depend on the
+// Prometheus client library.
+
+// Package prommetrics exposes mpg123 decoder metrics as Prometheus
+// collectors:
+//
+//	c := prommetrics.New()
+//	prometheus.MustRegister(c)
+//	c.Observe(decoder, "station-1")
+//
+// Decoders passed to Observe report bytes decoded, decode calls, errors and
+// call latency labelled with the given name. The package-level handle,
+// stream and byte counts of the mpg123 package are exported as well.
+package prommetrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/SiloCityLabs/go-mpg123/mpg123"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "mpg123"
+
+// Collector implements prometheus.Collector for mpg123 decoders
+type Collector struct {
+	bytes   *prometheus.CounterVec
+	calls   *prometheus.CounterVec
+	errors  *prometheus.CounterVec
+	latency *prometheus.HistogramVec
+
+	handles    *prometheus.Desc
+	streams    *prometheus.Desc
+	bytesTotal *prometheus.Desc
+	libErrors  *prometheus.Desc
+}
+
+// New returns a collector with the default latency buckets, which range
+// from 10µs to about 80ms.
+func New() *Collector {
+	return NewWithBuckets(prometheus.ExponentialBuckets(10e-6, 2, 14))
+}
+
+// NewWithBuckets returns a collector using the given latency histogram
+// buckets, in seconds.
+func NewWithBuckets(buckets []float64) *Collector {
+	labels := []string{"decoder"}
+	return &Collector{
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decoder_bytes_total",
+			Help:      "Bytes of decoded audio produced by the decoder.",
+		}, labels),
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decoder_calls_total",
+			Help:      "Decode calls made on the decoder.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decoder_errors_total",
+			Help:      "Decode calls on the decoder that returned an error.",
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "decoder_call_duration_seconds",
+			Help:      "Time spent in decode calls on the decoder.",
+			Buckets:   buckets,
+		}, labels),
+		handles: prometheus.NewDesc(namespace+"_handles",
+			"Live mpg123 decoder handles.", nil, nil),
+		streams: prometheus.NewDesc(namespace+"_streams",
+			"Open mpg123 input streams.", nil, nil),
+		bytesTotal: prometheus.NewDesc(namespace+"_bytes_decoded_total",
+			"Bytes of decoded audio produced by all decoders.", nil, nil),
+		libErrors: prometheus.NewDesc(namespace+"_errors_total",
+			"Errors reported by libmpg123, by error code.", []string{"code"}, nil),
+	}
+}
+
+// Observe reports the decode calls of d under the label name. Several
+// decoders may share a name, e.g. one per stream of the same station.
+func (c *Collector) Observe(d *mpg123.Decoder, name string) {
+	d.SetObserver(&observer{
+		bytes:   c.bytes.WithLabelValues(name),
+		calls:   c.calls.WithLabelValues(name),
+		errors:  c.errors.WithLabelValues(name),
+		latency: c.latency.WithLabelValues(name),
+	})
+}
+
+// Forget drops the series labelled name, e.g. once a stream has ended for
+// good. Decoders still observed under name recreate them.
+func (c *Collector) Forget(name string) {
+	c.bytes.DeleteLabelValues(name)
+	c.calls.DeleteLabelValues(name)
+	c.errors.DeleteLabelValues(name)
+	c.latency.DeleteLabelValues(name)
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.bytes.Describe(ch)
+	c.calls.Describe(ch)
+	c.errors.Describe(ch)
+	c.latency.Describe(ch)
+	ch <- c.handles
+	ch <- c.streams
+	ch <- c.bytesTotal
+	ch <- c.libErrors
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.bytes.Collect(ch)
+	c.calls.Collect(ch)
+	c.errors.Collect(ch)
+	c.latency.Collect(ch)
+
+	s := mpg123.ReadStats()
+	ch <- prometheus.MustNewConstMetric(c.handles, prometheus.GaugeValue, float64(s.Handles))
+	ch <- prometheus.MustNewConstMetric(c.streams, prometheus.GaugeValue, float64(s.Streams))
+	ch <- prometheus.MustNewConstMetric(c.bytesTotal, prometheus.CounterValue, float64(s.BytesDecoded))
+	for code, n := range s.Errors {
+		ch <- prometheus.MustNewConstMetric(c.libErrors, prometheus.CounterValue, float64(n), strconv.Itoa(code))
+	}
+}
+
+// observer feeds the decode calls of one decoder into the collector
+type observer struct {
+	bytes   prometheus.Counter
+	calls   prometheus.Counter
+	errors  prometheus.Counter
+	latency prometheus.Observer
+}
+
+func (o *observer) ObserveDecode(n int, took time.Duration, failed bool) {
+	o.calls.Inc()
+	if n > 0 {
+		o.bytes.Add(float64(n))
+	}
+	if failed {
+		o.errors.Inc()
+	}
+	o.latency.Observe(took.Seconds())
+}